@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/RATIU5/fjrd/internal/backup"
+	"github.com/RATIU5/fjrd/internal/config"
+	"github.com/RATIU5/fjrd/internal/logger"
+	"github.com/RATIU5/fjrd/internal/macos/section"
+)
+
+// stringList is a flag that may be repeated or given comma separated values.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*s = append(*s, v)
+		}
+	}
+	return nil
+}
+
+func createBackup(ctx context.Context, backups *backup.Manager, cfg *config.FjrdConfig, source string, w io.Writer) error {
+	domains, err := cfg.Domains()
+	if err != nil {
+		return err
+	}
+	if len(domains) == 0 {
+		return fmt.Errorf("configuration does not touch any domains")
+	}
+
+	created, err := backups.Create(ctx, domains, source)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", created.ID)
+	return err
+}
+
+func listBackups(backups *backup.Manager, w io.Writer) error {
+	list, err := backups.List()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCREATED\tDOMAINS\tSOURCE")
+	for _, b := range list {
+		names := make([]string, len(b.Domains))
+		for i, d := range b.Domains {
+			names[i] = d.Domain
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", b.ID, b.Created.Local().Format("2006-01-02 15:04:05"), strings.Join(names, ","), b.Source)
+	}
+	return tw.Flush()
+}
+
+func restoreBackup(ctx context.Context, log *logger.Logger, backups *backup.Manager, id string, domains, keys []string, noRestart bool) error {
+	b, err := backups.Get(id)
+	if err != nil {
+		return err
+	}
+
+	selection := backup.Selection{Domains: domains}
+	for _, k := range keys {
+		ref, err := backup.ParseKeyRef(k)
+		if err != nil {
+			return err
+		}
+		selection.Keys = append(selection.Keys, ref)
+	}
+
+	restored, err := backups.Restore(ctx, b, selection)
+	if err != nil {
+		return err
+	}
+
+	for _, restart := range section.RestartsForDomains(restored) {
+		if noRestart {
+			log.Info("Skipping restart, restart manually for changes to take effect", "process", restart.Process)
+			continue
+		}
+		if err := restart.Execute(ctx); err != nil {
+			return fmt.Errorf("failed to restart %s: %w", restart.Process, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/RATIU5/fjrd/internal/config"
+	"github.com/RATIU5/fjrd/internal/journal"
+	"github.com/RATIU5/fjrd/internal/logger"
+	"github.com/RATIU5/fjrd/internal/macos/defaults"
+	"github.com/RATIU5/fjrd/internal/macos/section"
+)
+
+// recordRun appends the apply to the journal. A journal failure is logged but
+// does not fail the apply.
+func recordRun(runs *journal.Journal, cfg *config.FjrdConfig, result defaults.Result, applyErr error, log *logger.Logger) {
+	run, err := journal.NewRun(cfg.Source(), cfg.Hash(), result, applyErr)
+	if err == nil {
+		err = runs.Append(run)
+	}
+	if err != nil {
+		log.Warn("Failed to record run in journal", "error", err)
+		return
+	}
+	log.Debug("Recorded run in journal", "run_id", run.ID, "path", runs.Path())
+}
+
+func showHistory(runs *journal.Journal, id string, w io.Writer) error {
+	if id != "" {
+		run, err := runs.Get(id)
+		if err != nil {
+			return err
+		}
+		return showRun(run, w)
+	}
+
+	list, err := runs.Runs()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIME\tCOMMAND\tCHANGED\tSTATUS\tSOURCE")
+	for _, run := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", run.ID, run.Time.Local().Format("2006-01-02 15:04:05"),
+			runCommand(run), len(run.Changed()), runStatus(run), run.Source)
+	}
+	return tw.Flush()
+}
+
+func showRun(run *journal.Run, w io.Writer) error {
+	fmt.Fprintf(w, "Run %s: %s at %s (%s)\n", run.ID, runCommand(run), run.Time.Local().Format("2006-01-02 15:04:05"), runStatus(run))
+	if run.Source != "" {
+		fmt.Fprintf(w, "Source: %s\n", run.Source)
+	}
+	if run.ConfigHash != "" {
+		fmt.Fprintf(w, "Config hash: %s\n", run.ConfigHash)
+	}
+	if run.Error != "" {
+		fmt.Fprintf(w, "Error: %s\n", run.Error)
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DOMAIN\tKEY\tPREVIOUS\tNEW\tRESULT")
+	for _, entry := range run.Entries {
+		key := entry.Key
+		if entry.Host != defaults.AnyHost {
+			key = fmt.Sprintf("%s (%s)", key, entry.Host)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", entry.Domain, key, entry.Previous, entry.New, entry.Result)
+	}
+	return tw.Flush()
+}
+
+func runCommand(run *journal.Run) string {
+	if run.Undoes != "" {
+		return fmt.Sprintf("%s %s", run.Command, run.Undoes)
+	}
+	return run.Command
+}
+
+func runStatus(run *journal.Run) string {
+	switch {
+	case run.RolledBack:
+		return "rolled back"
+	case run.Error != "":
+		return "failed"
+	default:
+		return "ok"
+	}
+}
+
+func undoRun(ctx context.Context, log *logger.Logger, runs *journal.Journal, id string, noRestart bool) error {
+	if id == "" {
+		id = journal.Last
+	}
+	run, err := runs.Get(id)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Undoing run", "run_id", run.ID, "keys", len(run.Changed()))
+	undo, undoErr := journal.Undo(ctx, run, log)
+	if err := runs.Append(undo); err != nil {
+		log.Warn("Failed to record undo in journal", "error", err)
+	}
+	if undoErr != nil {
+		return undoErr
+	}
+
+	var restarts []defaults.Restart
+	for _, entry := range run.Changed() {
+		restarts = append(restarts, section.RestartsForKey(entry.Domain, entry.Key)...)
+	}
+	for _, restart := range defaults.CoalesceRestarts(restarts) {
+		if noRestart {
+			log.Info("Skipping restart, restart manually for changes to take effect", "process", restart.Process)
+			continue
+		}
+		if err := restart.Execute(ctx); err != nil {
+			return fmt.Errorf("failed to restart %s: %w", restart.Process, err)
+		}
+	}
+
+	log.Info("Run undone successfully", "run_id", run.ID)
+	return nil
+}
@@ -5,11 +5,15 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/RATIU5/fjrd/internal/backup"
 	"github.com/RATIU5/fjrd/internal/config"
 	"github.com/RATIU5/fjrd/internal/interaction"
+	"github.com/RATIU5/fjrd/internal/journal"
 	"github.com/RATIU5/fjrd/internal/logger"
+	"github.com/RATIU5/fjrd/internal/macos/defaults"
 )
 
 func main() {
@@ -18,32 +22,88 @@ func main() {
 		logFormat = flag.String("log-format", "text", "Log format (text, json)")
 		timeout   = flag.Duration("timeout", 30*time.Second, "Operation timeout")
 		quiet     = flag.Bool("quiet", false, "Suppress non-error output")
+		yes       = flag.Bool("yes", false, "Approve raw defaults and privileged writes without asking")
 		verbose   = flag.Bool("verbose", false, "Enable verbose logging (equivalent to -log-level=debug)")
 		help      = flag.Bool("help", false, "Show help message")
+		backend   = flag.String("backend", "cli", "Preferences backend (cli, memory, dir:<path>)")
+		noRestart = flag.Bool("no-restart", false, "Do not restart Dock, Finder and other processes after applying")
+		atomic    = flag.Bool("atomic", false, "Roll back every change if any part of the apply fails or times out")
+		strict    = flag.Bool("strict", false, "Refuse to apply if a write would change the type a key is stored with")
+		lenient   = flag.Bool("lenient", false, "Warn about unknown configuration keys instead of failing")
+		backupDir = flag.String("backup-dir", backup.DefaultDir(), "Directory backups are stored in")
+		keep      = flag.Int("max-backups", backup.DefaultMaxBackups, "Number of backups to keep")
+		list      = flag.Bool("list", false, "List backups instead of creating one (backup)")
+		resolved  = flag.Bool("resolved", false, "Annotate every value with the file it came from (show)")
+		stateDir  = flag.String("state-dir", journal.DefaultDir(), "Directory the apply journal is kept in")
+		format    = flag.String("format", "text", "Output format of diagnostics (text, json, sarif) (validate)")
+		domains   stringList
+		keys      stringList
+		profiles  stringList
 	)
+	flag.Var(&domains, "domain", "Restore only this domain, may be repeated (restore)")
+	flag.Var(&keys, "key", "Restore only this domain:key, may be repeated (restore)")
+	flag.Var(&profiles, "profile", "Apply this profile instead of the ones matching this machine, may be repeated")
 
 	const appName string = "fjrd"
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] <config-path>\n\n", appName)
+		fmt.Fprintf(os.Stderr, "Usage: %s [command] [options] <config-path>\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s backup [options] <config-path>\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s backup -list\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s restore [options] <backup-id|latest>\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s show [-resolved] <config-path>\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s validate [-format=text|json|sarif] <config-path>\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s migrate <config-file>\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s schema\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s history [run-id]\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s undo [run-id]\n\n", appName)
 		fmt.Fprintf(os.Stderr, "A macOS configuration management tool that applies system settings via TOML files.\n\n")
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  apply    Apply the configuration (default)\n")
+		fmt.Fprintf(os.Stderr, "  plan     Show current vs desired values without applying anything\n")
+		fmt.Fprintf(os.Stderr, "  backup   Back up every domain the configuration touches, or list backups\n")
+		fmt.Fprintf(os.Stderr, "  restore  Restore a backup, optionally only some domains or keys\n")
+		fmt.Fprintf(os.Stderr, "  show     Print the configuration with its includes merged\n")
+		fmt.Fprintf(os.Stderr, "  validate Report every problem in the configuration, with its position\n")
+		fmt.Fprintf(os.Stderr, "  migrate  Rewrite a configuration file to the current schema version\n")
+		fmt.Fprintf(os.Stderr, "  schema   Print a JSON Schema of the configuration format for editors\n")
+		fmt.Fprintf(os.Stderr, "  history  List past runs, or show the keys a run changed\n")
+		fmt.Fprintf(os.Stderr, "  undo     Revert the keys changed by a run (default: the last one)\n\n")
+		printSections(os.Stderr)
+		fmt.Fprintf(os.Stderr, "\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  %s config.toml\n", appName)
 		fmt.Fprintf(os.Stderr, "  %s -verbose owner/repo\n", appName)
 		fmt.Fprintf(os.Stderr, "  %s -log-level=debug https://example.com/config.toml\n", appName)
-		fmt.Fprintf(os.Stderr, "  %s -quiet -timeout=60s config.toml\n", appName)
+		fmt.Fprintf(os.Stderr, "  %s -quiet -yes -timeout=60s config.toml\n", appName)
+		fmt.Fprintf(os.Stderr, "  %s -backend=dir:./prefs config.toml\n", appName)
+		fmt.Fprintf(os.Stderr, "  %s plan config.toml\n", appName)
+		fmt.Fprintf(os.Stderr, "  %s backup config.toml\n", appName)
+		fmt.Fprintf(os.Stderr, "  %s show -resolved config.toml\n", appName)
+		fmt.Fprintf(os.Stderr, "  %s validate -format=sarif config.toml\n", appName)
+		fmt.Fprintf(os.Stderr, "  %s migrate config.toml\n", appName)
+		fmt.Fprintf(os.Stderr, "  %s schema > fjrd.schema.json\n", appName)
+		fmt.Fprintf(os.Stderr, "  %s restore -key com.apple.dock:autohide latest\n", appName)
+		fmt.Fprintf(os.Stderr, "  %s undo 12\n", appName)
 	}
 
-	flag.Parse()
+	command, args := parseCommand(os.Args[1:])
+	flag.CommandLine.Parse(args)
 
 	if *help {
 		flag.Usage()
 		os.Exit(0)
 	}
 
-	if flag.NArg() < 1 {
+	switch {
+	case command == "history" || command == "undo" || command == "schema" || (command == "backup" && *list):
+	case flag.NArg() < 1 && command == "restore":
+		fmt.Fprintf(os.Stderr, "Error: backup-id is required\n\n")
+		flag.Usage()
+		os.Exit(1)
+	case flag.NArg() < 1:
 		fmt.Fprintf(os.Stderr, "Error: config-path is required\n\n")
 		flag.Usage()
 		os.Exit(1)
@@ -64,23 +124,122 @@ func main() {
 		log = logger.New(level, os.Stderr)
 	}
 
+	prefsBackend, err := defaults.NewBackend(*backend)
+	if err != nil {
+		log.Error("Invalid backend", "error", err)
+		os.Exit(1)
+	}
+	defaults.SetBackend(prefsBackend)
+
 	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
 	defer cancel()
 
+	backups := backup.NewManager(log, *backupDir, *keep)
+	runs := journal.New(*stateDir)
+	switch {
+	case command == "history":
+		if err := showHistory(runs, flag.Arg(0), os.Stdout); err != nil {
+			log.Error("Failed to read history", "error", err)
+			os.Exit(1)
+		}
+		return
+	case command == "undo":
+		if err := undoRun(ctx, log, runs, flag.Arg(0), *noRestart); err != nil {
+			log.Error("Failed to undo run", "error", err)
+			os.Exit(1)
+		}
+		return
+	case command == "backup" && *list:
+		if err := listBackups(backups, os.Stdout); err != nil {
+			log.Error("Failed to list backups", "error", err)
+			os.Exit(1)
+		}
+		return
+	case command == "validate":
+		valid, err := validateConfig(ctx, log, flag.Arg(0), config.LoadOptions{Lenient: *lenient}, *format, os.Stdout)
+		if err != nil {
+			log.Error("Failed to validate config", "error", err)
+			os.Exit(1)
+		}
+		if !valid {
+			os.Exit(1)
+		}
+		return
+	case command == "schema":
+		if err := writeSchema(os.Stdout); err != nil {
+			log.Error("Failed to generate schema", "error", err)
+			os.Exit(1)
+		}
+		return
+	case command == "migrate":
+		if err := migrateConfig(flag.Arg(0), os.Stdout); err != nil {
+			log.Error("Failed to migrate config", "error", err)
+			os.Exit(1)
+		}
+		return
+	case command == "show":
+		if err := showConfig(ctx, log, flag.Arg(0), config.LoadOptions{Profiles: profiles, Lenient: *lenient}, *resolved, os.Stdout); err != nil {
+			log.Error("Failed to show config", "error", err)
+			os.Exit(1)
+		}
+		return
+	case command == "restore":
+		if err := restoreBackup(ctx, log, backups, flag.Arg(0), domains, keys, *noRestart); err != nil {
+			log.Error("Failed to restore backup", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	configPath := flag.Arg(0)
 
-	log.Debug("Starting fjrd", "config_path", configPath, "timeout", *timeout)
+	log.Debug("Starting fjrd", "command", command, "config_path", configPath, "timeout", *timeout, "backend", *backend)
 
-	cfg, err := config.LoadConfig(ctx, configPath, log)
+	cfg, err := config.LoadConfig(ctx, configPath, log, config.LoadOptions{Profiles: profiles, Lenient: *lenient})
 	if err != nil {
 		log.Error("Failed to load config", "error", err)
 		os.Exit(1)
 	}
 
 	log.Debug("Configuration loaded successfully")
+	if active := cfg.ActiveProfiles(); len(active) > 0 {
+		log.Info("Using profiles", "profiles", strings.Join(active, ","))
+	}
+
+	if command == "backup" {
+		if err := createBackup(ctx, backups, cfg, configPath, os.Stdout); err != nil {
+			log.Error("Failed to create backup", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if command == "plan" {
+		plan, err := cfg.Plan(ctx, log)
+		if err != nil {
+			log.Error("Failed to plan config", "error", err)
+			os.Exit(1)
+		}
+		if err := plan.Render(os.Stdout); err != nil {
+			log.Error("Failed to write plan", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// -quiet used to skip the approval prompts. It still approves them, with
+	// a warning, so that unattended runs keep working until they pass -yes.
+	warned := false
+	preapproved := func() bool {
+		if *quiet && !*yes && !warned {
+			fmt.Fprintf(os.Stderr, "Warning: approving with -quiet is deprecated, pass -yes to approve raw defaults and privileged writes\n")
+			warned = true
+		}
+		return *yes || *quiet
+	}
 
 	// Check if raw defaults require user approval
-	if cfg.RequiresRawDefaultsApproval() && !*quiet {
+	if cfg.RequiresRawDefaultsApproval() && !preapproved() {
 		log.Debug("Raw defaults detected, requesting user approval")
 		commands := cfg.ListRawDefaults()
 		approved, err := interaction.GetUserApproval(commands)
@@ -95,12 +254,53 @@ func main() {
 		log.Debug("User approved raw defaults execution")
 	}
 
-	if err := cfg.Execute(ctx, log); err != nil {
+	// System preferences are written in one privileged step, approved
+	// separately so that the user knows what sudo will be asked to run.
+	if !*yes {
+		plan, err := cfg.Plan(ctx, log)
+		if err != nil {
+			log.Error("Failed to plan config", "error", err)
+			os.Exit(1)
+		}
+		privileged, err := plan.Privileged()
+		if err != nil {
+			log.Error("Failed to plan config", "error", err)
+			os.Exit(1)
+		}
+		if len(privileged) > 0 && !preapproved() {
+			approved, err := interaction.GetApproval("The following system preferences will be written with administrator privileges:", privileged)
+			if err != nil {
+				log.Error("Failed to get user approval", "error", err)
+				os.Exit(1)
+			}
+			if !approved {
+				log.Info("Operation cancelled by user")
+				os.Exit(0)
+			}
+			log.Debug("User approved privileged writes", "count", len(privileged))
+		}
+	}
+
+	result, err := cfg.Apply(ctx, log, config.ApplyOptions{NoRestart: *noRestart, Atomic: *atomic, Strict: *strict})
+	recordRun(runs, cfg, result, err, log)
+	if err != nil {
 		log.Error("Failed to execute config", "error", err)
 		os.Exit(1)
 	}
 
 	if !*quiet {
-		log.Info("Configuration applied successfully")
+		log.Info(fmt.Sprintf("Configuration applied successfully: %s", result))
+	}
+}
+
+// parseCommand splits an optional leading subcommand from the remaining
+// arguments. Without one, the configuration is applied.
+func parseCommand(args []string) (string, []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "apply", "plan", "backup", "restore", "show", "validate", "migrate", "schema", "history", "undo":
+			return args[0], args[1:]
+		}
 	}
+	return "apply", args
 }
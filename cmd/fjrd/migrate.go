@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/RATIU5/fjrd/internal/config"
+)
+
+// migrateConfig rewrites the configuration file at location to the current
+// schema version, in place, and prints the keys it renamed. Included files
+// are left alone.
+func migrateConfig(location string, w io.Writer) error {
+	info, err := os.Stat(location)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(location)
+	if err != nil {
+		return err
+	}
+
+	migrated, deprecations, err := config.Migrate(content)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(migrated, content) {
+		_, err := fmt.Fprintf(w, "%s already uses schema %s\n", location, config.Current())
+		return err
+	}
+
+	tmp := location + ".tmp"
+	if err := os.WriteFile(tmp, migrated, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, location); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	fmt.Fprintf(w, "Migrated %s to schema %s\n", location, config.Current())
+	for _, d := range deprecations {
+		fmt.Fprintf(w, "  %s → %s\n", d.Key, d.Replacement)
+	}
+	return nil
+}
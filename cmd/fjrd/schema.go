@@ -0,0 +1,18 @@
+package main
+
+import (
+	"io"
+
+	"github.com/RATIU5/fjrd/internal/config"
+)
+
+// writeSchema writes the JSON Schema of the configuration file format, for
+// editors to complete and check configuration files with.
+func writeSchema(w io.Writer) error {
+	schema, err := config.JSONSchema()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(schema, '\n'))
+	return err
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/RATIU5/fjrd/internal/macos/section"
+)
+
+// printSections lists the sections a configuration can set below macos, in
+// the order they are applied, with the processes each of them restarts.
+func printSections(w io.Writer) {
+	fmt.Fprintf(w, "Sections:\n")
+	for _, r := range section.All() {
+		line := fmt.Sprintf("  %-16s %s", r.Key, r.Description)
+		if restarts := r.Empty().Restarts(); len(restarts) > 0 {
+			processes := make([]string, len(restarts))
+			for i, restart := range restarts {
+				processes[i] = restart.Process
+			}
+			line += fmt.Sprintf(" (restarts %s)", strings.Join(processes, ", "))
+		}
+		fmt.Fprintln(w, line)
+	}
+}
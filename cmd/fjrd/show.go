@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/RATIU5/fjrd/internal/config"
+	"github.com/RATIU5/fjrd/internal/logger"
+)
+
+// showConfig prints the configuration at location with its includes and
+// active profiles merged. With resolved, every value is printed as a dotted
+// key followed by the location it came from.
+func showConfig(ctx context.Context, log *logger.Logger, location string, opts config.LoadOptions, resolved bool, w io.Writer) error {
+	cfg, err := config.LoadConfig(ctx, location, log, opts)
+	if err != nil {
+		return err
+	}
+	doc := cfg.Document()
+	if resolved {
+		return doc.WriteResolved(w)
+	}
+
+	content, err := doc.Content()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, content)
+	return err
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+
+	"github.com/RATIU5/fjrd/internal/config"
+	"github.com/RATIU5/fjrd/internal/logger"
+)
+
+// ruleDescriptions describes every diagnostic code for SARIF consumers.
+var ruleDescriptions = map[string]string{
+	config.CodeSyntax:              "The file is not valid TOML",
+	config.CodeLoad:                "The file or one of its includes could not be read",
+	config.CodeUnknownKey:          "The key is not part of the schema",
+	config.CodeDeprecatedKey:       "The key was renamed in a newer schema version",
+	config.CodeInvalidReference:    "A ${...} reference is malformed or names an unknown variable",
+	config.CodeUnresolvedReference: "A ${...} reference cannot be resolved on this machine",
+	config.CodeInvalidWhen:         "A when expression is malformed",
+	config.CodeInvalidType:         "The value has the wrong type",
+	config.CodeInvalidVersion:      "The schema version is not supported",
+	config.CodeInvalidValue:        "The value is not allowed",
+}
+
+// validateConfig checks the configuration at location and writes every
+// problem found in format, which is text, json or sarif. It reports whether
+// the configuration is free of errors; warnings do not make it invalid.
+func validateConfig(ctx context.Context, log *logger.Logger, location string, opts config.LoadOptions, format string, w io.Writer) (bool, error) {
+	diagnostics := config.ValidateConfig(ctx, location, log, opts)
+	valid := !config.HasErrors(diagnostics)
+
+	switch format {
+	case "text":
+		return valid, writeDiagnosticsText(location, diagnostics, w)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return valid, enc.Encode(diagnostics)
+	case "sarif":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return valid, enc.Encode(newSarifLog(diagnostics))
+	default:
+		return false, fmt.Errorf("unknown format %q, must be text, json or sarif", format)
+	}
+}
+
+func writeDiagnosticsText(location string, diagnostics []config.Diagnostic, w io.Writer) error {
+	errs := 0
+	for _, d := range diagnostics {
+		if d.Severity == config.SeverityError {
+			errs++
+		}
+		fmt.Fprintln(w, d)
+	}
+	if len(diagnostics) == 0 {
+		_, err := fmt.Fprintf(w, "%s is valid\n", location)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d error(s), %d warning(s)\n", errs, len(diagnostics)-errs)
+	return err
+}
+
+// The subset of SARIF 2.1.0 that code scanning tools read.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+func newSarifLog(diagnostics []config.Diagnostic) sarifLog {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "fjrd",
+			InformationURI: "https://github.com/RATIU5/fjrd",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	var codes []string
+	for _, d := range diagnostics {
+		if !slices.Contains(codes, d.Code) {
+			codes = append(codes, d.Code)
+		}
+
+		result := sarifResult{
+			RuleID:  d.Code,
+			Level:   string(d.Severity),
+			Message: sarifMessage{Text: d.Message},
+		}
+		var loc sarifLocation
+		if d.Source != "" {
+			loc.PhysicalLocation = &sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(d.Source)}}
+			if d.Line > 0 {
+				loc.PhysicalLocation.Region = &sarifRegion{StartLine: d.Line, StartColumn: d.Column}
+			}
+		}
+		if d.Path != "" {
+			loc.LogicalLocations = []sarifLogicalLocation{{FullyQualifiedName: d.Path}}
+			result.Message.Text = d.Path + ": " + d.Message
+		}
+		if loc.PhysicalLocation != nil || loc.LogicalLocations != nil {
+			result.Locations = []sarifLocation{loc}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	slices.Sort(codes)
+	for _, code := range codes {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: code, ShortDescription: sarifMessage{Text: ruleDescriptions[code]}})
+	}
+	return sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	}
+}
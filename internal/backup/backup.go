@@ -0,0 +1,423 @@
+// Package backup stores typed snapshots of preference domains and restores
+// them, either whole or key by key.
+//
+// Every backup is a directory holding one plist file per domain, exactly as
+// exported by the active defaults backend, and a manifest.json describing it.
+// Because the plist files keep their types, restoring never has to guess
+// whether "1" was a bool, an int or a string.
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+	"github.com/RATIU5/fjrd/internal/logger"
+	"github.com/RATIU5/fjrd/internal/macos/defaults"
+	"github.com/RATIU5/fjrd/internal/plist"
+)
+
+const (
+	// DefaultMaxBackups is how many backups are kept when no limit is given.
+	DefaultMaxBackups = 10
+
+	manifestFile = "manifest.json"
+	idLayout     = "20060102-150405"
+)
+
+// Latest can be passed to Manager.Get in place of an ID.
+const Latest = "latest"
+
+// ErrNotFound is returned when a backup, domain or key is not in a backup.
+var ErrNotFound = errors.New("not found in backup")
+
+type Domain struct {
+	Domain string `json:"domain"`
+	File   string `json:"file"`
+	Keys   int    `json:"keys"`
+}
+
+// Backup is the manifest of a stored backup.
+type Backup struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Source  string    `json:"source,omitempty"`
+	Domains []Domain  `json:"domains"`
+
+	path string
+}
+
+func (b *Backup) Path() string {
+	return b.path
+}
+
+// Domain returns the manifest entry for domain.
+func (b *Backup) Domain(domain string) (Domain, bool) {
+	for _, d := range b.Domains {
+		if d.Domain == domain {
+			return d, true
+		}
+	}
+	return Domain{}, false
+}
+
+// Data returns the stored plist for domain.
+func (b *Backup) Data(domain string) ([]byte, error) {
+	d, ok := b.Domain(domain)
+	if !ok {
+		return nil, fmt.Errorf("domain %s: %w", domain, ErrNotFound)
+	}
+	return os.ReadFile(filepath.Join(b.path, d.File))
+}
+
+// Values decodes the stored plist for domain.
+func (b *Backup) Values(domain string) (plist.Dict, error) {
+	data, err := b.Data(domain)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDict(data)
+}
+
+// KeyRef names a single key in a domain.
+type KeyRef struct {
+	Domain string
+	Key    string
+}
+
+// ParseKeyRef parses "domain:key".
+func ParseKeyRef(s string) (KeyRef, error) {
+	domain, key, ok := strings.Cut(s, ":")
+	if !ok || domain == "" || key == "" {
+		return KeyRef{}, fmt.Errorf("invalid key %q, expected format: domain:key", s)
+	}
+	return KeyRef{Domain: domain, Key: key}, nil
+}
+
+func (k KeyRef) String() string {
+	return k.Domain + ":" + k.Key
+}
+
+// Selection limits a restore to some domains and keys. An empty selection
+// restores everything in the backup. A domain listed in Domains is restored
+// whole; keys listed in Keys are restored one by one and every other key in
+// their domain is left alone.
+type Selection struct {
+	Domains []string
+	Keys    []KeyRef
+}
+
+func (s Selection) IsEmpty() bool {
+	return len(s.Domains) == 0 && len(s.Keys) == 0
+}
+
+type Manager struct {
+	logger     *logger.Logger
+	backupDir  string
+	maxBackups int
+}
+
+func NewManager(logger *logger.Logger, backupDir string, maxBackups int) *Manager {
+	if backupDir == "" {
+		backupDir = DefaultDir()
+	}
+	if maxBackups <= 0 {
+		maxBackups = DefaultMaxBackups
+	}
+
+	return &Manager{
+		logger:     logger.WithComponent("backup"),
+		backupDir:  backupDir,
+		maxBackups: maxBackups,
+	}
+}
+
+// DefaultDir returns ~/.fjrd/backups.
+func DefaultDir() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".fjrd", "backups")
+}
+
+// Create exports every domain into a new backup and then removes the oldest
+// backups beyond the retention limit.
+func (m *Manager) Create(ctx context.Context, domains []string, source string) (*Backup, error) {
+	now := time.Now()
+	id, path, err := m.newBackupDir(now)
+	if err != nil {
+		return nil, errors.WrapConfigError("backup", "create", "", nil, err)
+	}
+
+	backup := &Backup{
+		ID:      id,
+		Created: now.UTC(),
+		Source:  source,
+		path:    path,
+	}
+
+	m.logger.Info("Creating backup", "backup_id", id, "domains", len(domains))
+
+	backend := defaults.GetBackend()
+	for _, domain := range domains {
+		data, err := backend.Export(ctx, domain)
+		if err != nil {
+			os.RemoveAll(path)
+			return nil, errors.WrapConfigError("backup", "export", domain, nil, err)
+		}
+		values, err := decodeDict(data)
+		if err != nil {
+			os.RemoveAll(path)
+			return nil, errors.WrapConfigError("backup", "decode", domain, nil, err)
+		}
+
+		file := url.PathEscape(domain) + ".plist"
+		if err := os.WriteFile(filepath.Join(path, file), data, 0600); err != nil {
+			os.RemoveAll(path)
+			return nil, errors.WrapConfigError("backup", "write", domain, nil, err)
+		}
+		backup.Domains = append(backup.Domains, Domain{Domain: domain, File: file, Keys: len(values)})
+		m.logger.Debug("Backed up domain", "domain", domain, "keys", len(values))
+	}
+
+	if err := writeManifest(backup); err != nil {
+		os.RemoveAll(path)
+		return nil, errors.WrapConfigError("backup", "write_manifest", id, nil, err)
+	}
+
+	if err := m.Prune(); err != nil {
+		m.logger.Warn("Failed to remove old backups", "error", err)
+	}
+
+	m.logger.Info("Backup created successfully", "backup_id", id)
+	return backup, nil
+}
+
+// List returns all backups, oldest first.
+func (m *Manager) List() ([]*Backup, error) {
+	entries, err := os.ReadDir(m.backupDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WrapConfigError("backup", "list", m.backupDir, nil, err)
+	}
+
+	var backups []*Backup
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		backup, err := readManifest(filepath.Join(m.backupDir, entry.Name()))
+		if err != nil {
+			m.logger.Debug("Skipping directory without a valid manifest", "path", entry.Name(), "error", err)
+			continue
+		}
+		backups = append(backups, backup)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].Created.Equal(backups[j].Created) {
+			return backups[i].Created.Before(backups[j].Created)
+		}
+		return backups[i].ID < backups[j].ID
+	})
+	return backups, nil
+}
+
+// Get loads the backup with the given ID, or the newest one for Latest.
+func (m *Manager) Get(id string) (*Backup, error) {
+	if id == Latest {
+		backups, err := m.List()
+		if err != nil {
+			return nil, err
+		}
+		if len(backups) == 0 {
+			return nil, fmt.Errorf("no backups in %s: %w", m.backupDir, ErrNotFound)
+		}
+		return backups[len(backups)-1], nil
+	}
+
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return nil, fmt.Errorf("invalid backup id %q", id)
+	}
+	backup, err := readManifest(filepath.Join(m.backupDir, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("backup %s: %w", id, ErrNotFound)
+		}
+		return nil, errors.WrapConfigError("backup", "read_manifest", id, nil, err)
+	}
+	return backup, nil
+}
+
+// Prune removes the oldest backups until at most maxBackups remain.
+func (m *Manager) Prune() error {
+	backups, err := m.List()
+	if err != nil {
+		return err
+	}
+
+	multiErr := errors.NewMultiError()
+	for i := 0; i < len(backups)-m.maxBackups; i++ {
+		if err := os.RemoveAll(backups[i].path); err != nil {
+			multiErr.Add(err)
+			continue
+		}
+		m.logger.Debug("Removed old backup", "backup_id", backups[i].ID)
+	}
+	return multiErr.ToError()
+}
+
+// Restore writes the selected parts of a backup back through the active
+// defaults backend and returns the domains it touched.
+func (m *Manager) Restore(ctx context.Context, backup *Backup, selection Selection) ([]string, error) {
+	m.logger.Info("Restoring backup", "backup_id", backup.ID)
+
+	domains := selection.Domains
+	if selection.IsEmpty() {
+		for _, d := range backup.Domains {
+			domains = append(domains, d.Domain)
+		}
+	}
+
+	backend := defaults.GetBackend()
+	var restored []string
+	for _, domain := range domains {
+		data, err := backup.Data(domain)
+		if err != nil {
+			return restored, err
+		}
+		if err := backend.Import(ctx, domain, data); err != nil {
+			return restored, errors.WrapConfigError("backup", "import", domain, nil, err)
+		}
+		m.logger.Debug("Restored domain", "domain", domain)
+		restored = append(restored, domain)
+	}
+
+	keysByDomain := make(map[string][]string)
+	var keyDomains []string
+	for _, ref := range selection.Keys {
+		if _, ok := keysByDomain[ref.Domain]; !ok {
+			keyDomains = append(keyDomains, ref.Domain)
+		}
+		keysByDomain[ref.Domain] = append(keysByDomain[ref.Domain], ref.Key)
+	}
+
+	for _, domain := range keyDomains {
+		if err := m.restoreKeys(ctx, backup, domain, keysByDomain[domain]); err != nil {
+			return restored, err
+		}
+		restored = append(restored, domain)
+	}
+
+	m.logger.Info("Backup restored successfully", "backup_id", backup.ID, "domains", len(restored))
+	return restored, nil
+}
+
+// restoreKeys patches individual keys into the current domain. Keys that were
+// not set when the backup was taken are deleted.
+func (m *Manager) restoreKeys(ctx context.Context, backup *Backup, domain string, keys []string) error {
+	saved, err := backup.Values(domain)
+	if err != nil {
+		return err
+	}
+
+	backend := defaults.GetBackend()
+	data, err := backend.Export(ctx, domain)
+	if err != nil {
+		return errors.WrapConfigError("backup", "export", domain, nil, err)
+	}
+	current, err := decodeDict(data)
+	if err != nil {
+		return errors.WrapConfigError("backup", "decode", domain, nil, err)
+	}
+
+	for _, key := range keys {
+		if value, ok := saved[key]; ok {
+			current[key] = value
+			m.logger.Debug("Restored key", "domain", domain, "key", key)
+		} else {
+			delete(current, key)
+			m.logger.Debug("Removed key not present in backup", "domain", domain, "key", key)
+		}
+	}
+
+	format := plist.DetectFormat(data)
+	if format == plist.FormatUnknown {
+		format = plist.FormatXML
+	}
+	patched, err := plist.Marshal(current, format)
+	if err != nil {
+		return errors.WrapConfigError("backup", "encode", domain, nil, err)
+	}
+	if err := backend.Import(ctx, domain, patched); err != nil {
+		return errors.WrapConfigError("backup", "import", domain, nil, err)
+	}
+	return nil
+}
+
+func (m *Manager) newBackupDir(now time.Time) (string, string, error) {
+	if err := os.MkdirAll(m.backupDir, 0755); err != nil {
+		return "", "", err
+	}
+
+	base := now.Format(idLayout)
+	for i := 0; ; i++ {
+		id := base
+		if i > 0 {
+			id = fmt.Sprintf("%s-%d", base, i)
+		}
+		path := filepath.Join(m.backupDir, id)
+		err := os.Mkdir(path, 0755)
+		if err == nil {
+			return id, path, nil
+		}
+		if !os.IsExist(err) {
+			return "", "", err
+		}
+	}
+}
+
+func writeManifest(backup *Backup) error {
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(backup.path, manifestFile), append(data, '\n'), 0644)
+}
+
+func readManifest(path string) (*Backup, error) {
+	data, err := os.ReadFile(filepath.Join(path, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var backup Backup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	backup.path = path
+	return &backup, nil
+}
+
+func decodeDict(data []byte) (plist.Dict, error) {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return plist.Dict{}, nil
+	}
+
+	decoded, _, err := plist.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := decoded.(plist.Dict)
+	if !ok {
+		return nil, errors.New("domain root is not a dictionary")
+	}
+	return dict, nil
+}
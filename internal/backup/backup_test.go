@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+	"github.com/RATIU5/fjrd/internal/logger"
+	"github.com/RATIU5/fjrd/internal/macos/defaults"
+)
+
+func useMemoryBackend(t *testing.T) *defaults.MemoryBackend {
+	t.Helper()
+	mem := defaults.NewMemoryBackend()
+	previous := defaults.GetBackend()
+	defaults.SetBackend(mem)
+	t.Cleanup(func() { defaults.SetBackend(previous) })
+	return mem
+}
+
+func testManager(t *testing.T, maxBackups int) *Manager {
+	return NewManager(logger.New(logger.LevelError, io.Discard), t.TempDir(), maxBackups)
+}
+
+func TestManager_CreateAndRestore(t *testing.T) {
+	mem := useMemoryBackend(t)
+	ctx := context.Background()
+	m := testManager(t, 0)
+
+	mem.Write(ctx, "com.apple.dock", "autohide", defaults.NewBoolValue(true))
+	mem.Write(ctx, "com.apple.dock", "tilesize", &defaults.IntValue{Value: 48})
+	mem.Write(ctx, "com.apple.finder", "FXPreferredViewStyle", defaults.NewStringValue("clmv"))
+
+	created, err := m.Create(ctx, []string{"com.apple.dock", "com.apple.finder"}, "config.toml")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if d, ok := created.Domain("com.apple.dock"); !ok || d.Keys != 2 {
+		t.Errorf("Create() dock manifest = %+v, %v", d, ok)
+	}
+
+	mem.Write(ctx, "com.apple.dock", "autohide", defaults.NewBoolValue(false))
+	mem.Write(ctx, "com.apple.dock", "orientation", defaults.NewStringValue("left"))
+	mem.Write(ctx, "com.apple.finder", "FXPreferredViewStyle", defaults.NewStringValue("icnv"))
+
+	latest, err := m.Get(Latest)
+	if err != nil || latest.ID != created.ID {
+		t.Fatalf("Get(latest) = %v, %v, want %s", latest, err, created.ID)
+	}
+
+	restored, err := m.Restore(ctx, latest, Selection{Domains: []string{"com.apple.dock"}})
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if len(restored) != 1 || restored[0] != "com.apple.dock" {
+		t.Errorf("Restore() domains = %v", restored)
+	}
+
+	got, err := mem.Read(ctx, "com.apple.dock", "autohide")
+	if err != nil || got.Type() != defaults.BoolType || got.String() != "true" {
+		t.Errorf("autohide after restore = %v, %v, want bool true", got, err)
+	}
+	if got, err := mem.Read(ctx, "com.apple.dock", "tilesize"); err != nil || got.Type() != defaults.IntType {
+		t.Errorf("tilesize after restore = %v, %v, want int", got, err)
+	}
+	if _, err := mem.Read(ctx, "com.apple.dock", "orientation"); !errors.Is(err, defaults.ErrKeyNotFound) {
+		t.Errorf("orientation should be removed by a domain restore, got %v", err)
+	}
+	if got, _ := mem.Read(ctx, "com.apple.finder", "FXPreferredViewStyle"); got.String() != "icnv" {
+		t.Errorf("unselected domain was restored: %s", got)
+	}
+}
+
+func TestManager_RestoreKeys(t *testing.T) {
+	mem := useMemoryBackend(t)
+	ctx := context.Background()
+	m := testManager(t, 0)
+
+	mem.Write(ctx, "com.apple.dock", "autohide", defaults.NewBoolValue(true))
+	created, err := m.Create(ctx, []string{"com.apple.dock"}, "")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	mem.Write(ctx, "com.apple.dock", "autohide", defaults.NewBoolValue(false))
+	mem.Write(ctx, "com.apple.dock", "orientation", defaults.NewStringValue("left"))
+	mem.Write(ctx, "com.apple.dock", "tilesize", &defaults.IntValue{Value: 64})
+
+	selection := Selection{Keys: []KeyRef{
+		{Domain: "com.apple.dock", Key: "autohide"},
+		{Domain: "com.apple.dock", Key: "orientation"},
+	}}
+	if _, err := m.Restore(ctx, created, selection); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	if got, _ := mem.Read(ctx, "com.apple.dock", "autohide"); got.String() != "true" {
+		t.Errorf("autohide = %s, want true", got)
+	}
+	if _, err := mem.Read(ctx, "com.apple.dock", "orientation"); !errors.Is(err, defaults.ErrKeyNotFound) {
+		t.Errorf("orientation should be deleted, got %v", err)
+	}
+	if got, _ := mem.Read(ctx, "com.apple.dock", "tilesize"); got.String() != "64" {
+		t.Errorf("unselected key tilesize = %s, want 64", got)
+	}
+
+	if _, err := m.Restore(ctx, created, Selection{Domains: []string{"com.apple.finder"}}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Restore() of missing domain error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestManager_Retention(t *testing.T) {
+	useMemoryBackend(t)
+	ctx := context.Background()
+	m := testManager(t, 2)
+
+	var ids []string
+	for i := 0; i < 4; i++ {
+		created, err := m.Create(ctx, []string{"com.apple.dock"}, "")
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		ids = append(ids, created.ID)
+	}
+
+	list, err := m.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(list) != 2 || list[0].ID != ids[2] || list[1].ID != ids[3] {
+		t.Errorf("List() kept %d backups, want the newest 2 of %v", len(list), ids)
+	}
+}
+
+func TestParseKeyRef(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    KeyRef
+		wantErr bool
+	}{
+		{input: "com.apple.dock:autohide", want: KeyRef{"com.apple.dock", "autohide"}},
+		{input: "NSGlobalDomain:com.apple.mouse.scaling", want: KeyRef{"NSGlobalDomain", "com.apple.mouse.scaling"}},
+		{input: "com.apple.dock", wantErr: true},
+		{input: ":autohide", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseKeyRef(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeyRef() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseKeyRef() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+	goToml "github.com/pelletier/go-toml/v2"
+)
+
+// Severity is how serious a Diagnostic is. Errors make a configuration
+// invalid; warnings do not.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Codes identify the check a Diagnostic comes from.
+const (
+	CodeSyntax              = "syntax"
+	CodeLoad                = "load"
+	CodeUnknownKey          = "unknown-key"
+	CodeDeprecatedKey       = "deprecated-key"
+	CodeInvalidReference    = "invalid-reference"
+	CodeUnresolvedReference = "unresolved-reference"
+	CodeInvalidWhen         = "invalid-when"
+	CodeInvalidType         = "invalid-type"
+	CodeInvalidVersion      = "invalid-version"
+	CodeInvalidValue        = "invalid-value"
+)
+
+// Diagnostic is a problem ValidateConfig found in a configuration.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	// Path is the dotted TOML path of the value, or "" if the problem is
+	// with the file as a whole.
+	Path string `json:"path,omitempty"`
+	// Source, Line and Column locate the value, or the closest table
+	// containing it. Line and Column are 0 if the position is unknown.
+	Source  string `json:"source,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// String formats the diagnostic like a compiler message, e.g.
+// config.toml:4:1: error: macos.dock.tilesize: value out of range
+// (value: 512, expected: 16 to 128) [invalid-value].
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	switch {
+	case d.Line > 0:
+		fmt.Fprintf(&b, "%s:%d:%d: ", d.Source, d.Line, d.Column)
+	case d.Source != "":
+		fmt.Fprintf(&b, "%s: ", d.Source)
+	}
+	fmt.Fprintf(&b, "%s: ", d.Severity)
+	if d.Path != "" {
+		fmt.Fprintf(&b, "%s: ", d.Path)
+	}
+	fmt.Fprintf(&b, "%s [%s]", d.Message, d.Code)
+	return b.String()
+}
+
+// HasErrors reports whether any of the diagnostics is an error.
+func HasErrors(diagnostics []Diagnostic) bool {
+	return slices.ContainsFunc(diagnostics, func(d Diagnostic) bool { return d.Severity == SeverityError })
+}
+
+// ValidateConfig checks the configuration at location and its includes, and
+// returns every problem it finds rather than stopping at the first one.
+// Every profile is checked whether or not it matches this machine, and when
+// expressions are parsed but not evaluated. Unknown keys are errors unless
+// opts.Lenient is set; opts.Profiles is not used.
+func ValidateConfig(ctx context.Context, location string, log interface {
+	Info(string, ...any)
+	Debug(string, ...any)
+	Warn(string, ...any)
+}, opts LoadOptions) []Diagnostic {
+	doc, err := LoadDocument(ctx, location, log)
+	if err != nil {
+		return []Diagnostic{loadDiagnostic(location, err)}
+	}
+
+	v := &validation{doc: doc, diagnostics: []Diagnostic{}}
+	for _, u := range doc.UnknownKeys {
+		severity := SeverityError
+		if opts.Lenient {
+			severity = SeverityWarning
+		}
+		message := "unknown key"
+		if u.Suggestion != "" {
+			message += fmt.Sprintf(", did you mean %s?", u.Suggestion)
+		}
+		v.diagnostics = append(v.diagnostics, Diagnostic{
+			Severity: severity,
+			Code:     CodeUnknownKey,
+			Path:     u.Key,
+			Source:   u.Source,
+			Line:     u.Line,
+			Column:   u.Column,
+			Message:  message,
+		})
+	}
+	for _, d := range doc.Deprecations {
+		// Positions are recorded under the current names.
+		pos, _ := doc.positionIn([]string{d.Source}, d.Replacement)
+		v.diagnostics = append(v.diagnostics, Diagnostic{
+			Severity: SeverityWarning,
+			Code:     CodeDeprecatedKey,
+			Path:     d.Key,
+			Source:   d.Source,
+			Line:     pos.line,
+			Column:   pos.column,
+			Message:  fmt.Sprintf("renamed to %s in %s, run fjrd migrate to update the file", d.Replacement, d.Version),
+		})
+	}
+
+	// Every profile is expanded, whether or not it would be applied here.
+	expandProfile, err := doc.interpolate(ctx, newCachedFacts(opts.Facts))
+	errs := []error{err}
+	if expandProfile != nil {
+		profiles, _ := doc.Values[profilesKey].(map[string]any)
+		for _, name := range slices.Sorted(maps.Keys(profiles)) {
+			errs = append(errs, expandProfile(name))
+		}
+	}
+	for _, err := range flattenErrors(errors.Combine(errs...)) {
+		var unavailable *unavailableError
+		if errors.As(err, &unavailable) {
+			v.add(SeverityWarning, CodeUnresolvedReference, varsKey, err)
+		} else {
+			v.add(SeverityError, CodeInvalidReference, varsKey, err)
+		}
+	}
+	for _, err := range flattenErrors(doc.checkWhen(false)) {
+		v.add(SeverityError, CodeInvalidWhen, "", err)
+	}
+
+	cfg, ok := v.decode()
+	if !ok {
+		return v.diagnostics
+	}
+	if err := cfg.Version.Validate(); err != nil {
+		v.add(SeverityError, CodeInvalidVersion, "version", err)
+	}
+
+	v.validateMacos(&cfg.Macos, "macos")
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+		profile := cfg.Profiles[name]
+		prefix := dottedKey([]string{profilesKey, name})
+		for _, err := range flattenErrors(profile.Match.Validate()) {
+			v.add(SeverityError, CodeInvalidValue, joinKey(prefix, "match"), err)
+		}
+		v.validateMacos(&profile.Macos, joinKey(prefix, "macos"))
+	}
+	return v.diagnostics
+}
+
+// loadDiagnostic reports a configuration that could not be read at all.
+func loadDiagnostic(location string, err error) Diagnostic {
+	var parseErr *parseError
+	if !errors.As(err, &parseErr) {
+		return Diagnostic{Severity: SeverityError, Code: CodeLoad, Source: location, Message: err.Error()}
+	}
+
+	d := Diagnostic{Severity: SeverityError, Code: CodeSyntax, Source: parseErr.source, Message: parseErr.err.Error()}
+	var decodeErr *goToml.DecodeError
+	if errors.As(parseErr.err, &decodeErr) {
+		d.Line, d.Column = decodeErr.Position()
+		d.Message = strings.TrimPrefix(decodeErr.Error(), "toml: ")
+	}
+	return d
+}
+
+type validation struct {
+	doc         *Document
+	diagnostics []Diagnostic
+}
+
+// add records err as a diagnostic at key. The key of a keyError takes
+// precedence.
+func (v *validation) add(severity Severity, code, key string, err error) {
+	message := err.Error()
+	var keyErr *keyError
+	if errors.As(err, &keyErr) {
+		key, message = keyErr.key, keyErr.err.Error()
+	}
+
+	d := Diagnostic{Severity: severity, Code: code, Path: key, Message: message}
+	if pos, ok := v.doc.position(key); ok {
+		d.Source, d.Line, d.Column = pos.source, pos.line, pos.column
+	} else {
+		d.Source = v.doc.Sources[len(v.doc.Sources)-1]
+	}
+	v.diagnostics = append(v.diagnostics, d)
+}
+
+// decode decodes the document. Every value that does not decode into its
+// field is reported and left out, so that the rest can still be checked.
+func (v *validation) decode() (*FjrdConfig, bool) {
+	for _, key := range v.doc.Keys() {
+		value := v.doc.lookup(key)
+		parts := splitKey(key)
+		for i := len(parts) - 1; i >= 0; i-- {
+			value = map[string]any{parts[i]: value}
+		}
+		b, err := goToml.Marshal(value)
+		if err == nil {
+			err = decodeConfig(b, &FjrdConfig{})
+		}
+		if err != nil {
+			v.add(SeverityError, CodeInvalidType, key, errors.New(strings.TrimPrefix(err.Error(), "toml: ")))
+			v.doc.remove(key)
+		}
+	}
+
+	content, err := v.doc.Content()
+	if err == nil {
+		var cfg FjrdConfig
+		if err = decodeConfig([]byte(content), &cfg); err == nil {
+			return &cfg, true
+		}
+	}
+	v.add(SeverityError, CodeInvalidType, "", err)
+	return nil, false
+}
+
+// validateMacos runs the validation of every section of a macos table, at
+// the dotted path prefix.
+func (v *validation) validateMacos(macos *MacosConfig, prefix string) {
+	for _, s := range macos.sections() {
+		for _, err := range flattenErrors(s.Validate()) {
+			key, message := sectionError(err, prefix, s.Key)
+			v.add(SeverityError, CodeInvalidValue, key, errors.New(message))
+		}
+	}
+}
+
+// sectionError returns the path and message of an error a section's
+// validation returned.
+func sectionError(err error, prefix, section string) (string, string) {
+	var validationErr *errors.ValidationError
+	var configErr *errors.ConfigurationError
+	switch {
+	case errors.As(err, &validationErr):
+		// Fields are named by their path below the top-level macos table.
+		key := prefix + strings.TrimPrefix(validationErr.Field, "macos")
+		if validationErr.Expected != "" {
+			return key, fmt.Sprintf("%v (value: %v, expected: %s)", validationErr.Err, validationErr.Value, validationErr.Expected)
+		}
+		return key, fmt.Sprintf("%v (value: %v)", validationErr.Err, validationErr.Value)
+	case errors.As(err, &configErr) && configErr.Field != "":
+		return joinKey(joinKey(prefix, section), configErr.Field), configErr.Err.Error()
+	}
+	return joinKey(prefix, section), err.Error()
+}
+
+// flattenErrors returns the errors combined in err, or err itself.
+func flattenErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	multi, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range multi.Unwrap() {
+		errs = append(errs, flattenErrors(e)...)
+	}
+	return errs
+}
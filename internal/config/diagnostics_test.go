@@ -0,0 +1,169 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	const base = `version = 1
+
+[macos.mouse]
+accelerate = true
+speed = 9.0
+`
+	const config = `version = 2
+include = ["base.toml"]
+
+[macos.dock]
+tilesize = 4096
+autohid = true
+orientation = "up"
+
+[macos.screenshots]
+format = "bmpx"
+create = true
+when = "os >> 14"
+
+[[macos.defaultsRaw.entries]]
+domain = "com.example.app"
+key = "a"
+type = "int"
+value = "${var:missing}"
+
+[profiles.work.macos.trackpad]
+click-weight = 7
+`
+	dir := writeConfigs(t, map[string]string{"config.toml": config, "base.toml": base})
+	location := filepath.Join(dir, "config.toml")
+	baseLocation := filepath.Join(dir, "base.toml")
+
+	diagnostics := ValidateConfig(context.Background(), location, testLogger(), LoadOptions{Facts: StaticFacts{}})
+	want := []struct {
+		severity Severity
+		code     string
+		path     string
+		source   string
+		line     int
+	}{
+		{SeverityError, CodeUnknownKey, "macos.dock.autohid", location, 6},
+		{SeverityWarning, CodeDeprecatedKey, "macos.mouse.accelerate", baseLocation, 4},
+		{SeverityError, CodeInvalidReference, "macos.defaultsRaw.entries[0].value", location, 18},
+		{SeverityError, CodeInvalidWhen, "macos.screenshots.when", location, 12},
+		{SeverityError, CodeInvalidType, "macos.dock.orientation", location, 7},
+		{SeverityError, CodeInvalidValue, "macos.dock.tilesize", location, 5},
+		{SeverityError, CodeInvalidValue, "macos.screenshots.format", location, 10},
+		{SeverityError, CodeInvalidValue, "macos.screenshots.create", location, 11},
+		{SeverityError, CodeInvalidValue, "macos.mouse.speed", baseLocation, 5},
+		{SeverityError, CodeInvalidValue, "macos.defaultsRaw", location, 14},
+		{SeverityError, CodeInvalidValue, "profiles.work.macos.trackpad.click-weight", location, 21},
+	}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("ValidateConfig() returned %d diagnostics, want %d: %v", len(diagnostics), len(want), diagnostics)
+	}
+	for i, w := range want {
+		d := diagnostics[i]
+		if d.Severity != w.severity || d.Code != w.code || d.Path != w.path || d.Source != w.source || d.Line != w.line {
+			t.Errorf("diagnostic %d = %s, want %s %s at %s:%d (%s)", i, d, w.severity, w.path, w.source, w.line, w.code)
+		}
+	}
+	if !HasErrors(diagnostics) {
+		t.Error("HasErrors() = false, want true")
+	}
+
+	lenient := ValidateConfig(context.Background(), location, testLogger(), LoadOptions{Facts: StaticFacts{}, Lenient: true})
+	if lenient[0].Severity != SeverityWarning {
+		t.Errorf("unknown key with Lenient = %s, want a warning", lenient[0])
+	}
+}
+
+func TestValidateConfig_Syntax(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{"config.toml": "version = 2\n[macos.dock]\ntilesize = \n"})
+	location := filepath.Join(dir, "config.toml")
+
+	diagnostics := ValidateConfig(context.Background(), location, testLogger(), LoadOptions{})
+	if len(diagnostics) != 1 {
+		t.Fatalf("ValidateConfig() = %v, want one diagnostic", diagnostics)
+	}
+	if d := diagnostics[0]; d.Code != CodeSyntax || d.Source != location || d.Line != 3 || d.Column != 12 {
+		t.Errorf("ValidateConfig() = %s, want a syntax error at %s:3:12", d, location)
+	}
+}
+
+func TestValidateConfig_RawType(t *testing.T) {
+	const config = `version = 2
+
+[macos.defaultsRaw]
+"com.apple.dock.tilesize" = { value = 48, type = "integer" }
+
+[[macos.defaultsRaw.entries]]
+domain = "com.apple.dock"
+key = "autohide"
+type = "boolean"
+value = true
+`
+	dir := writeConfigs(t, map[string]string{"config.toml": config})
+	location := filepath.Join(dir, "config.toml")
+
+	diagnostics := ValidateConfig(context.Background(), location, testLogger(), LoadOptions{Facts: StaticFacts{}})
+	want := []struct {
+		path         string
+		line, column int
+	}{
+		{`macos.defaultsRaw."com.apple.dock.tilesize".type`, 4, 43},
+		{"macos.defaultsRaw.entries[0].type", 9, 1},
+	}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("ValidateConfig() returned %d diagnostics, want %d: %v", len(diagnostics), len(want), diagnostics)
+	}
+	for i, w := range want {
+		d := diagnostics[i]
+		if d.Code != CodeInvalidValue || d.Path != w.path || d.Line != w.line || d.Column != w.column || !strings.Contains(d.Message, "must be one of: string, bool, int") {
+			t.Errorf("diagnostic %d = %s at %d:%d, want %s at %d:%d listing the types", i, d, d.Line, d.Column, w.path, w.line, w.column)
+		}
+	}
+}
+
+func TestKeyPositions(t *testing.T) {
+	const content = `version = 1
+
+[macos.meubar]
+clock = true
+
+[macos.dock]
+tilesize = 48
+
+[[macos.defaultsRaw.entries]]
+domain = "a"
+
+[[macos.defaultsRaw.entries]]
+domain = "b"
+options.host = "currentHost"
+`
+	positions, err := keyPositions("config.toml", []byte(content), Version1)
+	if err != nil {
+		t.Fatalf("keyPositions() error = %v", err)
+	}
+	tests := []struct {
+		key          string
+		line, column int
+	}{
+		{"version", 1, 1},
+		{"macos", 3, 2},
+		{"macos.menubar", 3, 8},
+		{"macos.menubar.clock", 4, 1},
+		{"macos.dock.tilesize", 7, 1},
+		{"macos.defaultsRaw.entries[0]", 9, 21},
+		{"macos.defaultsRaw.entries[0].domain", 10, 1},
+		{"macos.defaultsRaw.entries[1].domain", 13, 1},
+		{"macos.defaultsRaw.entries[1].options.host", 14, 9},
+	}
+	for _, tt := range tests {
+		pos, ok := positions[tt.key]
+		if !ok || pos.line != tt.line || pos.column != tt.column {
+			t.Errorf("position of %s = %d:%d (found %v), want %d:%d", tt.key, pos.line, pos.column, ok, tt.line, tt.column)
+		}
+	}
+}
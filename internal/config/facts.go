@@ -0,0 +1,79 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strings"
+)
+
+// Facts describe the machine a configuration is loaded on. Profiles are
+// selected by matching them.
+type Facts struct {
+	Hostname string
+	// MacOSVersion is the product version, e.g. 14.5.
+	MacOSVersion string
+	// Arch is the CPU architecture as Go names it, e.g. arm64 or amd64.
+	Arch     string
+	Username string
+}
+
+// FactsProvider gathers the facts of the current machine.
+type FactsProvider interface {
+	Facts(ctx context.Context) (Facts, error)
+}
+
+// SystemFacts reads the facts from the running system. Facts that cannot be
+// determined are left empty and match no profile.
+type SystemFacts struct{}
+
+func (SystemFacts) Facts(ctx context.Context) (Facts, error) {
+	facts := Facts{Arch: runtime.GOARCH}
+
+	if hostname, err := os.Hostname(); err == nil {
+		facts.Hostname = hostname
+	}
+	if output, err := exec.CommandContext(ctx, "sw_vers", "-productVersion").Output(); err == nil {
+		facts.MacOSVersion = strings.TrimSpace(string(output))
+	}
+	if u, err := user.Current(); err == nil {
+		facts.Username = u.Username
+	}
+	return facts, nil
+}
+
+// StaticFacts always returns the same facts. It is used in tests and to
+// preview the profiles another machine would get.
+type StaticFacts Facts
+
+func (f StaticFacts) Facts(ctx context.Context) (Facts, error) {
+	return Facts(f), nil
+}
+
+// cachedFacts gathers the facts once, on first use, so that configurations
+// without profiles or fact references never run sw_vers.
+type cachedFacts struct {
+	provider FactsProvider
+	facts    *Facts
+}
+
+func newCachedFacts(provider FactsProvider) *cachedFacts {
+	if provider == nil {
+		provider = SystemFacts{}
+	}
+	return &cachedFacts{provider: provider}
+}
+
+func (c *cachedFacts) Facts(ctx context.Context) (Facts, error) {
+	if c.facts != nil {
+		return *c.facts, nil
+	}
+	facts, err := c.provider.Facts(ctx)
+	if err != nil {
+		return Facts{}, err
+	}
+	c.facts = &facts
+	return facts, nil
+}
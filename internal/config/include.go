@@ -0,0 +1,399 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	goToml "github.com/pelletier/go-toml/v2"
+)
+
+// includeKey is the top-level key listing the configurations a file is
+// layered on top of.
+const includeKey = "include"
+
+// Document is a configuration merged from its includes. It records the
+// source every value came from.
+type Document struct {
+	// Values is the merged TOML document, without the include key.
+	Values map[string]any
+	// Sources lists the loaded locations in merge order. The last one is the
+	// location the document was loaded from.
+	Sources []string
+	// UnknownKeys lists the keys, in every loaded file, that the schema does
+	// not define. They are left in Values and ignored when decoding.
+	UnknownKeys []UnknownKey
+	// Deprecations lists the keys, in every loaded file, that an older
+	// schema version uses. They are renamed in Values.
+	Deprecations []Deprecation
+
+	content    string
+	provenance map[string]string
+	positions  map[string]map[string]keyPosition
+}
+
+// Source returns the location the value at key was taken from, or "" if the
+// key is not set. Keys are dotted TOML paths such as macos.dock.autohide.
+func (d *Document) Source(key string) string {
+	return d.provenance[key]
+}
+
+// Keys returns the dotted paths of every value in the document, sorted.
+func (d *Document) Keys() []string {
+	keys := slices.Collect(maps.Keys(d.provenance))
+	sort.Strings(keys)
+	return keys
+}
+
+// Content returns the document as TOML. A document without includes is
+// returned exactly as it was read.
+func (d *Document) Content() (string, error) {
+	if d.content != "" {
+		return d.content, nil
+	}
+	b, err := goToml.Marshal(d.Values)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode merged config: %w", err)
+	}
+	return string(b), nil
+}
+
+// WriteResolved writes every value of the document as a dotted TOML key,
+// followed by the location it came from.
+func (d *Document) WriteResolved(w io.Writer) error {
+	fmt.Fprintf(w, "# Resolved from: %s\n", strings.Join(d.Sources, ", "))
+	for _, key := range d.Keys() {
+		value, err := formatTOMLValue(d.lookup(key))
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if _, err := fmt.Fprintf(w, "%s = %s # %s\n", key, value, d.provenance[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Document) lookup(key string) any {
+	var value any = d.Values
+	for _, part := range splitKey(key) {
+		value = value.(map[string]any)[part]
+	}
+	return value
+}
+
+// remove deletes the value at key.
+func (d *Document) remove(key string) {
+	parts := splitKey(key)
+	table := d.Values
+	for _, part := range parts[:len(parts)-1] {
+		table = table[part].(map[string]any)
+	}
+	delete(table, parts[len(parts)-1])
+	forgetKey(d.provenance, key)
+	d.content = ""
+}
+
+// LoadDocument reads the configuration at location and every configuration
+// it includes, and merges them. Includes are merged in the order they are
+// listed, and the including file is merged last. Tables are merged key by
+// key; any other value, including arrays, replaces what came before.
+func LoadDocument(ctx context.Context, location string, log interface {
+	Info(string, ...any)
+	Debug(string, ...any)
+	Warn(string, ...any)
+}) (*Document, error) {
+	doc := &Document{
+		Values:     make(map[string]any),
+		provenance: make(map[string]string),
+		positions:  make(map[string]map[string]keyPosition),
+	}
+	if err := doc.load(ctx, location, nil, log); err != nil {
+		return nil, err
+	}
+
+	delete(doc.Values, includeKey)
+	delete(doc.provenance, includeKey)
+	if len(doc.Sources) > 1 {
+		doc.content = ""
+	}
+	return doc, nil
+}
+
+func (d *Document) load(ctx context.Context, location string, stack []string, log interface {
+	Info(string, ...any)
+	Debug(string, ...any)
+	Warn(string, ...any)
+}) error {
+	id := includeID(location)
+	if slices.Contains(stack, id) {
+		return fmt.Errorf("include cycle: %s -> %s", strings.Join(stack, " -> "), id)
+	}
+	stack = append(stack, id)
+
+	content, err := resolveTomlResource(ctx, location, log)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", location, err)
+	}
+
+	var values map[string]any
+	if err := goToml.Unmarshal([]byte(content), &values); err != nil {
+		return &parseError{source: location, err: err}
+	}
+
+	unknown, err := unknownKeys(location, []byte(content), documentVersion(values))
+	if err != nil {
+		return err
+	}
+	d.UnknownKeys = append(d.UnknownKeys, unknown...)
+	if d.positions[location], err = keyPositions(location, []byte(content), documentVersion(values)); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", location, err)
+	}
+
+	deprecations, err := upgradeValues(values)
+	if err != nil {
+		return fmt.Errorf("%s: %w", location, err)
+	}
+	for i := range deprecations {
+		deprecations[i].Source = location
+	}
+	d.Deprecations = append(d.Deprecations, deprecations...)
+
+	includes, err := includeList(values[includeKey])
+	if err != nil {
+		return fmt.Errorf("%s: %w", location, err)
+	}
+	for _, include := range includes {
+		resolved := resolveInclude(location, include)
+		log.Debug("Loading include", "include", resolved, "from", location)
+		if err := d.load(ctx, resolved, stack, log); err != nil {
+			return err
+		}
+	}
+
+	mergeTOML(d.Values, values, "", func(string) string { return location }, d.provenance)
+	d.Sources = append(d.Sources, location)
+	d.content = content
+	if len(deprecations) > 0 {
+		// The values no longer match the text.
+		d.content = ""
+	}
+	return nil
+}
+
+// parseError is a configuration file that is not valid TOML.
+type parseError struct {
+	source string
+	err    error
+}
+
+func (e *parseError) Error() string {
+	return fmt.Sprintf("failed to parse %s: %v", e.source, e.err)
+}
+
+func (e *parseError) Unwrap() error {
+	return e.err
+}
+
+// position returns where key, or the closest table or array containing it,
+// is written. A key set in several files is found in the last one, whose
+// value wins. ok is false if the key is not in any file.
+func (d *Document) position(key string) (keyPosition, bool) {
+	return d.positionIn(d.Sources, key)
+}
+
+// positionIn is position limited to the given sources.
+func (d *Document) positionIn(sources []string, key string) (keyPosition, bool) {
+	for ; key != ""; key = parentKey(key) {
+		for i := len(sources) - 1; i >= 0; i-- {
+			if pos, ok := d.positions[sources[i]][key]; ok {
+				return pos, true
+			}
+		}
+	}
+	return keyPosition{}, false
+}
+
+func includeList(v any) ([]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be an array of locations", includeKey)
+	}
+
+	includes := make([]string, len(list))
+	for i, item := range list {
+		s, ok := item.(string)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("%s[%d] must be a location string", includeKey, i)
+		}
+		includes[i] = s
+	}
+	return includes, nil
+}
+
+// includeID identifies a location for cycle detection, so that the same file
+// reached through different relative paths is recognised.
+func includeID(location string) string {
+	if determinePathType(location) == PathTypeLocal {
+		if abs, err := filepath.Abs(location); err == nil {
+			return abs
+		}
+	}
+	return location
+}
+
+// resolveInclude resolves a relative include against the location of the
+// file that includes it. Local includes are relative to the including
+// file's directory, and HTTPS includes to its URL.
+func resolveInclude(from, include string) string {
+	switch {
+	case filepath.IsAbs(include):
+		return include
+	case determinePathType(from) == PathTypeLocal:
+		// A file next to the including one wins over reading the include
+		// as owner/repo.
+		local := filepath.Join(filepath.Dir(from), include)
+		if determinePathType(local) == PathTypeLocal || !isNetworkPath(include) {
+			return local
+		}
+	case !isNetworkPath(include):
+		if base, err := url.Parse(from); err == nil && base.Scheme == "https" {
+			if ref, err := url.Parse(include); err == nil {
+				return base.ResolveReference(ref).String()
+			}
+		}
+	}
+	return include
+}
+
+// mergeTOML merges src into dst. Tables are merged recursively and any other
+// value replaces the one in dst. provenance maps the dotted path of every
+// value to the location it came from, which source returns for each path.
+func mergeTOML(dst, src map[string]any, prefix string, source func(key string) string, provenance map[string]string) {
+	for k, v := range src {
+		key := joinKey(prefix, k)
+
+		if table, ok := v.(map[string]any); ok {
+			existing, ok := dst[k].(map[string]any)
+			if !ok {
+				forgetKey(provenance, key)
+				existing = make(map[string]any)
+				dst[k] = existing
+			}
+			mergeTOML(existing, table, key, source, provenance)
+			continue
+		}
+
+		forgetKey(provenance, key)
+		dst[k] = v
+		provenance[key] = source(key)
+	}
+}
+
+// forgetKey removes the provenance of key and of every value below it.
+func forgetKey(provenance map[string]string, key string) {
+	delete(provenance, key)
+	for k := range provenance {
+		if strings.HasPrefix(k, key+".") {
+			delete(provenance, k)
+		}
+	}
+}
+
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// joinKey appends k to a dotted TOML path, quoting it unless it is a bare
+// key, e.g. macos.defaultsRaw."com.apple.dock.autohide".
+func joinKey(prefix, k string) string {
+	if !bareKey.MatchString(k) {
+		k = strconv.Quote(k)
+	}
+	if prefix == "" {
+		return k
+	}
+	return prefix + "." + k
+}
+
+// splitKey reverses joinKey.
+func splitKey(key string) []string {
+	var parts []string
+	for key != "" {
+		if quoted, err := strconv.QuotedPrefix(key); err == nil {
+			part, _ := strconv.Unquote(quoted)
+			parts = append(parts, part)
+			key = strings.TrimPrefix(key[len(quoted):], ".")
+			continue
+		}
+		part, rest, _ := strings.Cut(key, ".")
+		parts = append(parts, part)
+		key = rest
+	}
+	return parts
+}
+
+// formatTOMLValue formats v as an inline TOML value.
+func formatTOMLValue(v any) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return strconv.Quote(t), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case int64:
+		return strconv.FormatInt(t, 10), nil
+	case float64:
+		switch {
+		case math.IsNaN(t):
+			return "nan", nil
+		case math.IsInf(t, 1):
+			return "inf", nil
+		case math.IsInf(t, -1):
+			return "-inf", nil
+		}
+		s := strconv.FormatFloat(t, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s, nil
+	case time.Time:
+		return t.Format(time.RFC3339Nano), nil
+	case fmt.Stringer:
+		// go-toml's LocalDate, LocalTime and LocalDateTime.
+		return t.String(), nil
+	case []any:
+		parts := make([]string, len(t))
+		for i, item := range t {
+			s, err := formatTOMLValue(item)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case map[string]any:
+		keys := slices.Sorted(maps.Keys(t))
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			s, err := formatTOMLValue(t[k])
+			if err != nil {
+				return "", err
+			}
+			parts[i] = joinKey("", k) + " = " + s
+		}
+		return "{" + strings.Join(parts, ", ") + "}", nil
+	default:
+		return "", fmt.Errorf("unsupported TOML value %T", v)
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RATIU5/fjrd/internal/macos/dock"
+	"github.com/RATIU5/fjrd/internal/macos/finder"
+)
+
+func writeConfigs(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadDocument_Include(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{
+		"base.toml": `
+version = 1
+
+[macos.dock]
+autohide = false
+tilesize = 48
+
+[macos.defaultsRaw]
+"com.apple.dock.mru-spaces" = { value = false, type = "bool" }
+`,
+		"roles/dev.toml": `
+include = ["../base.toml"]
+
+[macos.dock]
+autohide = true
+
+[macos.finder]
+show-path-bar = true
+`,
+		"config.toml": `
+include = ["roles/dev.toml"]
+
+[macos.dock]
+tilesize = 64
+`,
+	})
+	root := filepath.Join(dir, "config.toml")
+
+	doc, err := LoadDocument(context.Background(), root, testLogger())
+	if err != nil {
+		t.Fatalf("LoadDocument() error = %v", err)
+	}
+
+	want := map[string]string{
+		"version":                    filepath.Join(dir, "base.toml"),
+		"macos.dock.autohide":        filepath.Join(dir, "roles/dev.toml"),
+		"macos.dock.tilesize":        root,
+		"macos.finder.show-path-bar": filepath.Join(dir, "roles/dev.toml"),
+		`macos.defaultsRaw."com.apple.dock.mru-spaces".type`:  filepath.Join(dir, "base.toml"),
+		`macos.defaultsRaw."com.apple.dock.mru-spaces".value`: filepath.Join(dir, "base.toml"),
+	}
+	for key, source := range want {
+		if got := doc.Source(key); got != source {
+			t.Errorf("Source(%s) = %q, want %q", key, got, source)
+		}
+	}
+	if got := len(doc.Keys()); got != len(want) {
+		t.Errorf("Keys() = %q, want %d keys", doc.Keys(), len(want))
+	}
+
+	cfg, err := LoadConfig(context.Background(), root, testLogger(), LoadOptions{})
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	d, f := cfg.Macos.Section("dock").(*dock.Config), cfg.Macos.Section("finder").(*finder.Config)
+	if !*d.Autohide || *d.TileSize != 64 || !*f.ShowPathBar {
+		t.Errorf("LoadConfig() merged dock = %+v, finder = %+v", d, f)
+	}
+
+	var out strings.Builder
+	if err := doc.WriteResolved(&out); err != nil {
+		t.Fatalf("WriteResolved() error = %v", err)
+	}
+	if line := "macos.dock.tilesize = 64 # " + root; !strings.Contains(out.String(), line) {
+		t.Errorf("WriteResolved() output missing %q:\n%s", line, out.String())
+	}
+}
+
+func TestLoadDocument_IncludeCycle(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{
+		"a.toml": `include = ["b.toml"]`,
+		"b.toml": `include = ["./a.toml"]`,
+	})
+
+	_, err := LoadDocument(context.Background(), filepath.Join(dir, "a.toml"), testLogger())
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("LoadDocument() error = %v, want include cycle", err)
+	}
+}
+
+func TestMergeTOML_TableReplacesValue(t *testing.T) {
+	dst := map[string]any{}
+	provenance := map[string]string{}
+	first := func(string) string { return "first" }
+	second := func(string) string { return "second" }
+	mergeTOML(dst, map[string]any{"a": map[string]any{"b": int64(1), "c": int64(2)}}, "", first, provenance)
+	mergeTOML(dst, map[string]any{"a": []any{int64(3)}}, "", second, provenance)
+
+	if len(provenance) != 1 || provenance["a"] != "second" {
+		t.Errorf("provenance = %v, want only a from second", provenance)
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/RATIU5/fjrd/internal/logger"
 	"github.com/RATIU5/fjrd/internal/macos/defaults"
+	"github.com/RATIU5/fjrd/internal/macos/section"
 )
 
 type Executor interface {
@@ -31,6 +32,10 @@ type BatchExecutor interface {
 	Execute(ctx context.Context, logger *logger.Logger) error
 }
 
+// Section is a configuration block of the macos table, decoded into the
+// struct of its registration in package section.
+type Section = section.Section
+
 type ProcessRestarter interface {
 	Execute(ctx context.Context) error
 }
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+)
+
+// varsKey is the top-level table of variables strings can refer to.
+const varsKey = "vars"
+
+// interpolator expands ${env:NAME}, ${var:name} and ${fact:name} in string
+// values. $${ is written as a literal ${.
+type interpolator struct {
+	ctx   context.Context
+	vars  map[string]any
+	facts *cachedFacts
+
+	resolved  map[string]string
+	resolving []string
+	// skip leaves the values below the keys it reports alone.
+	skip func(key string) bool
+	// errs collects the failed strings, so that every one is reported.
+	errs []error
+}
+
+// keyError is an error in the value at a dotted TOML path.
+type keyError struct {
+	key string
+	err error
+}
+
+func (e *keyError) Error() string {
+	return e.key + ": " + e.err.Error()
+}
+
+func (e *keyError) Unwrap() error {
+	return e.err
+}
+
+// unavailableError is a reference to something this machine does not
+// provide, such as an unset environment variable. The same configuration may
+// resolve on another machine.
+type unavailableError struct {
+	err error
+}
+
+func (e *unavailableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unavailableError) Unwrap() error {
+	return e.err
+}
+
+func newInterpolator(ctx context.Context, vars map[string]any, facts *cachedFacts) *interpolator {
+	return &interpolator{ctx: ctx, vars: vars, facts: facts, resolved: make(map[string]string)}
+}
+
+// interpolate expands every string value in the document, including the
+// ones in arrays, inline tables and the vars table itself, except the macos
+// tables of the profiles. Those are expanded by the returned function once a
+// profile is applied, so that a reference only an inactive profile makes
+// does not have to resolve on this machine.
+func (d *Document) interpolate(ctx context.Context, facts *cachedFacts) (func(profile string) error, error) {
+	vars, ok := d.Values[varsKey].(map[string]any)
+	if !ok && d.Values[varsKey] != nil {
+		return nil, fmt.Errorf("%s must be a table", varsKey)
+	}
+
+	// Variables are expanded from their original text, not from the values
+	// the walk below replaces them with.
+	in := newInterpolator(ctx, maps.Clone(vars), facts)
+	in.skip = isProfileMacos
+	if in.walk(d.Values, "") {
+		d.content = ""
+	}
+	in.skip = nil
+
+	expandProfile := func(name string) error {
+		profiles, _ := d.Values[profilesKey].(map[string]any)
+		profile, _ := profiles[name].(map[string]any)
+		macos, ok := profile["macos"]
+		if !ok {
+			return nil
+		}
+
+		in.errs = nil
+		prefix := joinKey(joinKey("", profilesKey), name)
+		if in.walk(map[string]any{"macos": macos}, prefix) {
+			d.content = ""
+		}
+		return errors.Combine(in.errs...)
+	}
+	return expandProfile, errors.Combine(in.errs...)
+}
+
+// removeUnavailable removes the values err reports as referring to something
+// this machine does not provide, and returns the remaining errors. A failed
+// element removes its whole array.
+func (d *Document) removeUnavailable(err error) error {
+	var errs []error
+	for _, err := range flattenErrors(err) {
+		var keyErr *keyError
+		var unavailable *unavailableError
+		if errors.As(err, &keyErr) && errors.As(err, &unavailable) {
+			key, _, _ := strings.Cut(keyErr.key, "[")
+			d.remove(key)
+			continue
+		}
+		errs = append(errs, err)
+	}
+	return errors.Combine(errs...)
+}
+
+// isProfileMacos reports whether key is the macos table of a profile.
+func isProfileMacos(key string) bool {
+	parts := splitKey(key)
+	return len(parts) == 3 && parts[0] == profilesKey && parts[2] == "macos"
+}
+
+// walk expands the strings below v in place and reports whether any of
+// them changed. Strings that fail to expand are left as they are.
+func (in *interpolator) walk(v any, key string) bool {
+	changed := false
+	switch t := v.(type) {
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(t)) {
+			item := t[k]
+			itemKey := joinKey(key, k)
+			if in.skip != nil && in.skip(itemKey) {
+				continue
+			}
+			if s, ok := item.(string); ok {
+				expanded, err := in.expand(s)
+				if err != nil {
+					in.errs = append(in.errs, &keyError{key: itemKey, err: err})
+					continue
+				}
+				changed = changed || expanded != s
+				t[k] = expanded
+				continue
+			}
+			changed = in.walk(item, itemKey) || changed
+		}
+	case []any:
+		for i, item := range t {
+			itemKey := fmt.Sprintf("%s[%d]", key, i)
+			if s, ok := item.(string); ok {
+				expanded, err := in.expand(s)
+				if err != nil {
+					in.errs = append(in.errs, &keyError{key: itemKey, err: err})
+					continue
+				}
+				changed = changed || expanded != s
+				t[i] = expanded
+				continue
+			}
+			changed = in.walk(item, itemKey) || changed
+		}
+	}
+	return changed
+}
+
+func (in *interpolator) expand(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference in %q", s)
+		}
+		value, err := in.lookup(s[i+2 : i+end])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+		s = s[i+end+1:]
+	}
+}
+
+// lookup resolves a reference such as env:HOME.
+func (in *interpolator) lookup(ref string) (string, error) {
+	kind, name, ok := strings.Cut(ref, ":")
+	if !ok || name == "" {
+		return "", fmt.Errorf("invalid reference ${%s}, expected ${env:NAME}, ${var:name} or ${fact:name}", ref)
+	}
+
+	switch kind {
+	case "env":
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", &unavailableError{fmt.Errorf("environment variable %s is not set", name)}
+		}
+		return value, nil
+	case "var":
+		return in.lookupVar(name)
+	case "fact":
+		return in.lookupFact(name)
+	default:
+		return "", fmt.Errorf("unknown reference kind %q in ${%s}", kind, ref)
+	}
+}
+
+func (in *interpolator) lookupVar(name string) (string, error) {
+	if value, ok := in.resolved[name]; ok {
+		return value, nil
+	}
+	if slices.Contains(in.resolving, name) {
+		return "", fmt.Errorf("variable cycle: %s -> %s", strings.Join(in.resolving, " -> "), name)
+	}
+
+	raw, ok := in.vars[name]
+	if !ok {
+		return "", fmt.Errorf("unknown variable %q", name)
+	}
+	s, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("variable %q must be a string", name)
+	}
+
+	in.resolving = append(in.resolving, name)
+	value, err := in.expand(s)
+	in.resolving = in.resolving[:len(in.resolving)-1]
+	if err != nil {
+		return "", err
+	}
+	in.resolved[name] = value
+	return value, nil
+}
+
+func (in *interpolator) lookupFact(name string) (string, error) {
+	facts, err := in.facts.Facts(in.ctx)
+	if err != nil {
+		return "", &unavailableError{fmt.Errorf("failed to gather facts: %w", err)}
+	}
+
+	var value string
+	switch name {
+	case "hostname":
+		value = facts.Hostname
+	case "macos":
+		value = facts.MacOSVersion
+	case "arch":
+		value = facts.Arch
+	case "user":
+		value = facts.Username
+	default:
+		return "", fmt.Errorf("unknown fact %q, must be hostname, macos, arch or user", name)
+	}
+	if value == "" {
+		return "", &unavailableError{fmt.Errorf("fact %s could not be determined", name)}
+	}
+	return value, nil
+}
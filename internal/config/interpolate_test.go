@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RATIU5/fjrd/internal/macos/screenshots"
+)
+
+func TestLoadConfig_Interpolate(t *testing.T) {
+	t.Setenv("FJRD_TEST_HOME", "/Users/ana")
+
+	const config = `
+version = 1
+
+[vars]
+shots = "${env:FJRD_TEST_HOME}/Screenshots"
+dir = "${var:shots}/${fact:hostname}"
+
+[macos.screenshots]
+save-location = "${var:dir}"
+
+[macos.defaultsRaw."com.example.app.paths"]
+type = "array"
+value = ["${var:shots}", "$${var:shots}"]
+`
+	dir := writeConfigs(t, map[string]string{"config.toml": config})
+	cfg, err := LoadConfig(context.Background(), filepath.Join(dir, "config.toml"), testLogger(), LoadOptions{Facts: StaticFacts{Hostname: "ana-mbp"}})
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if got, want := *cfg.Macos.Section("screenshots").(*screenshots.Config).SaveLocation, "/Users/ana/Screenshots/ana-mbp"; got != want {
+		t.Errorf("save-location = %q, want %q", got, want)
+	}
+	if got, want := cfg.Vars["dir"], "/Users/ana/Screenshots/ana-mbp"; got != want {
+		t.Errorf("vars.dir = %q, want %q", got, want)
+	}
+	entries, err := cfg.Macos.raw().Entries()
+	if err != nil {
+		t.Fatalf("Entries() error = %v", err)
+	}
+	if got, want := entries[0].String(), `array: ("/Users/ana/Screenshots", "${var:shots}")`; got != want {
+		t.Errorf("raw entry = %s, want %s", got, want)
+	}
+}
+
+func TestLoadConfig_InterpolateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		vars    string
+		wantErr string
+	}{
+		{name: "unknown variable", value: "${var:missing}", wantErr: `unknown variable "missing"`},
+		{name: "unset environment variable", value: "${env:FJRD_TEST_UNSET}", wantErr: "FJRD_TEST_UNSET is not set"},
+		{name: "unknown fact", value: "${fact:kernel}", wantErr: `unknown fact "kernel"`},
+		{name: "unknown kind", value: "${home}", wantErr: "invalid reference"},
+		{name: "unterminated", value: "${var:a", wantErr: "unterminated reference"},
+		{name: "cycle", value: "${var:a}", vars: "a = \"${var:b}\"\nb = \"${var:a}\"", wantErr: "variable cycle: a -> b -> a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := "version = 1\n\n[vars]\n" + tt.vars + "\n\n[macos.screenshots]\nsave-location = \"" + tt.value + "\"\n"
+			dir := writeConfigs(t, map[string]string{"config.toml": config})
+
+			_, err := LoadConfig(context.Background(), filepath.Join(dir, "config.toml"), testLogger(), LoadOptions{Facts: StaticFacts{}})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_InterpolateProfiles(t *testing.T) {
+	t.Setenv("FJRD_TEST_HOME", "/Users/ana")
+
+	const config = `
+version = 1
+
+[profiles.home]
+match = { hostname = "ana-*" }
+macos.screenshots.save-location = "${env:FJRD_TEST_HOME}/Screenshots"
+
+[profiles.work]
+match = { hostname = "work-*" }
+macos.screenshots.save-location = "${env:FJRD_TEST_UNSET}/Screenshots"
+`
+	dir := writeConfigs(t, map[string]string{"config.toml": config})
+	location := filepath.Join(dir, "config.toml")
+	ctx := context.Background()
+
+	cfg, err := LoadConfig(ctx, location, testLogger(), LoadOptions{Facts: StaticFacts{Hostname: "ana-mbp"}})
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v, want the inactive profile ignored", err)
+	}
+	if got, want := *cfg.Macos.Section("screenshots").(*screenshots.Config).SaveLocation, "/Users/ana/Screenshots"; got != want {
+		t.Errorf("save-location = %q, want %q", got, want)
+	}
+
+	_, err = LoadConfig(ctx, location, testLogger(), LoadOptions{Facts: StaticFacts{Hostname: "work-mbp"}})
+	if err == nil || !strings.Contains(err.Error(), "FJRD_TEST_UNSET is not set") {
+		t.Errorf("LoadConfig() of the work profile error = %v, want FJRD_TEST_UNSET is not set", err)
+	}
+
+	var unresolved []string
+	for _, d := range ValidateConfig(ctx, location, testLogger(), LoadOptions{Facts: StaticFacts{Hostname: "ana-mbp"}}) {
+		if d.Code == CodeUnresolvedReference {
+			unresolved = append(unresolved, d.Message)
+		}
+	}
+	if len(unresolved) != 1 || !strings.Contains(unresolved[0], "FJRD_TEST_UNSET") {
+		t.Errorf("ValidateConfig() unresolved references = %v, want the work profile's", unresolved)
+	}
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/RATIU5/fjrd/internal/macos/defaults"
+	"github.com/RATIU5/fjrd/internal/macos/section"
+	"github.com/RATIU5/fjrd/internal/shared"
+)
+
+// jsonSchemaDialect is the JSON Schema version the generated schema uses,
+// the newest one Taplo supports.
+const jsonSchemaDialect = "http://json-schema.org/draft-07/schema#"
+
+var (
+	versionType = reflect.TypeOf(Version(0))
+	macosType   = reflect.TypeOf(MacosConfig{})
+	rawType     = reflect.TypeOf(defaults.Raw{})
+	matchType   = reflect.TypeOf(ProfileMatch{})
+)
+
+// enumType is implemented by the enum types of config fields, which decode
+// from a fixed set of strings.
+type enumType interface {
+	Names() []string
+}
+
+// JSONSchema returns a JSON Schema of the configuration file format, for
+// editors such as Taplo to complete and check configuration files with. It
+// is derived from FjrdConfig: the toml tags name the keys, doc tags describe
+// them, range tags bound numbers and enum types list their names.
+func JSONSchema() ([]byte, error) {
+	schema := typeSchema(configType)
+	schema["$schema"] = jsonSchemaDialect
+	schema["title"] = "fjrd configuration"
+	schema["required"] = []string{"version"}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func typeSchema(typ reflect.Type) map[string]any {
+	if typ.Kind() != reflect.Pointer && typ.Kind() != reflect.Interface {
+		if enum, ok := reflect.Zero(typ).Interface().(enumType); ok {
+			return map[string]any{"type": "string", "enum": enum.Names()}
+		}
+	}
+
+	switch typ {
+	case versionType:
+		return map[string]any{"type": "integer", "enum": SupportedVersions()}
+	case rawType:
+		return rawSchema()
+	case macosType:
+		return macosSchema()
+	}
+
+	switch typ.Kind() {
+	case reflect.Pointer:
+		return typeSchema(typ.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(typ.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(typ.Elem())}
+	case reflect.Struct:
+		return structSchema(typ)
+	}
+	// Any value, such as the value of a raw entry.
+	return map[string]any{}
+}
+
+// structSchema describes a struct as a table of its toml fields. Keys the
+// struct does not define are rejected, as they are when loading.
+func structSchema(typ reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+
+		property := fieldSchema(field)
+		if typ == matchType && name == "arch" {
+			property["enum"] = slices.Sorted(maps.Keys(archAliases))
+		}
+		properties[name] = property
+	}
+	return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+}
+
+// fieldSchema describes a struct field by its type, doc and range tags.
+func fieldSchema(field reflect.StructField) map[string]any {
+	property := typeSchema(field.Type)
+	if doc := field.Tag.Get("doc"); doc != "" {
+		property["description"] = doc
+	}
+	if min, max, ok := shared.FieldRange(field); ok {
+		property["minimum"], property["maximum"] = min, max
+	}
+	return property
+}
+
+// macosSchema describes a macos table, which holds the registered sections.
+func macosSchema() map[string]any {
+	properties := make(map[string]any)
+	for _, r := range section.All() {
+		property := sectionSchema(r)
+		property["title"] = r.Name
+		property["description"] = r.Description
+		// Every section can be made conditional.
+		property["properties"].(map[string]any)[whenKey] = whenSchema()
+		properties[r.Key] = property
+	}
+	return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+}
+
+// sectionSchema describes the table of a section as its registered fields.
+func sectionSchema(r section.Registration) map[string]any {
+	fields := r.Fields()
+	if fields == nil {
+		return typeSchema(reflect.TypeOf(r.New()))
+	}
+	properties := make(map[string]any, len(fields))
+	for _, field := range fields {
+		properties[field.Key] = fieldSchema(field.StructField)
+	}
+	return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+}
+
+// rawSchema describes defaultsRaw, which holds entries keyed by
+// "domain.key", and a list of entries that name their domain and key.
+func rawSchema() map[string]any {
+	entry := structSchema(reflect.TypeOf(defaults.RawEntry{}))
+	entry["properties"].(map[string]any)[whenKey] = whenSchema()
+
+	keyed := maps.Clone(entry)
+	keyed["properties"] = maps.Clone(entry["properties"].(map[string]any))
+	delete(keyed["properties"].(map[string]any), "domain")
+	delete(keyed["properties"].(map[string]any), "key")
+
+	listed := maps.Clone(entry)
+	listed["required"] = []string{"domain", "key"}
+
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"entries": map[string]any{
+				"type":        "array",
+				"description": "Entries that name their domain and key",
+				"items":       listed,
+			},
+			whenKey: whenSchema(),
+		},
+		"additionalProperties": keyed,
+	}
+}
+
+func whenSchema() map[string]any {
+	return map[string]any{
+		"type":        "string",
+		"description": "Only apply on machines the expression is true on, e.g. \"os >= 14 && arch == 'arm64'\"",
+	}
+}
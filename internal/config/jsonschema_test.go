@@ -0,0 +1,66 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONSchema(t *testing.T) {
+	b, err := JSONSchema()
+	if err != nil {
+		t.Fatalf("JSONSchema() error = %v", err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatalf("JSONSchema() is not valid JSON: %v", err)
+	}
+
+	// at follows a path of property names through nested object schemas.
+	at := func(path ...string) map[string]any {
+		t.Helper()
+		node := schema
+		for _, name := range path {
+			next, ok := node[name].(map[string]any)
+			if !ok {
+				t.Fatalf("schema has no %v", path)
+			}
+			node = next
+		}
+		return node
+	}
+	macos := []string{"properties", "macos", "properties"}
+
+	tests := []struct {
+		name string
+		path []string
+		key  string
+		want any
+	}{
+		{"enum names", append(macos, "dock", "properties", "orientation"), "enum", []any{"left", "bottom", "right"}},
+		{"enum aliases", append(macos, "finder", "properties", "preferred-view-style"), "enum", []any{"clmv", "column", "gallery", "glyv", "icnv", "icon", "list", "nlsv", "Nlsv"}},
+		{"minimum", append(macos, "dock", "properties", "tilesize"), "minimum", 16.0},
+		{"maximum", append(macos, "dock", "properties", "tilesize"), "maximum", 128.0},
+		{"description", append(macos, "screenshots", "properties", "format"), "description", "Image format of screenshots"},
+		{"section when", append(macos, "menubar", "properties", "when"), "type", "string"},
+		{"closed tables", append(macos, "dock"), "additionalProperties", false},
+		{"raw entries", append(macos, "defaultsRaw", "properties", "entries", "items"), "required", []any{"domain", "key"}},
+		{"versions", []string{"properties", "version"}, "enum", []any{1.0, 2.0}},
+		{"profile sections", []string{"properties", "profiles", "additionalProperties", "properties", "macos", "properties", "dock", "properties", "tilesize"}, "maximum", 128.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := at(tt.path...)[tt.key]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s of %v = %v, want %v", tt.key, tt.path, got, tt.want)
+			}
+		})
+	}
+
+	keyed := at(append(macos, "defaultsRaw", "additionalProperties", "properties")...)
+	if _, ok := keyed["domain"]; ok {
+		t.Error("keyed defaultsRaw entries accept a domain")
+	}
+	if _, ok := keyed["value"]; !ok {
+		t.Error("keyed defaultsRaw entries have no value")
+	}
+}
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+
+	goToml "github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+// keyRename moves a key within a macos table, e.g. mouse.accelerate to
+// mouse.acceleration.
+type keyRename struct {
+	// old is the key's path below the macos table.
+	old []string
+	// new replaces the last element of old.
+	new string
+}
+
+// upgrade is what changed from one schema version to the next.
+type upgrade struct {
+	from    Version
+	renames []keyRename
+}
+
+// upgrades lists the schema changes in version order. A document is decoded
+// by applying every upgrade from its version on, which turns it into the
+// current schema.
+var upgrades = []upgrade{
+	{
+		from: Version1,
+		renames: []keyRename{
+			{old: []string{"meubar"}, new: "menubar"},
+			{old: []string{"mouse", "accelerate"}, new: "acceleration"},
+		},
+	},
+}
+
+// Deprecation names a key an older schema version uses, and the key that
+// replaces it.
+type Deprecation struct {
+	// Source is the file the key is in. Migrate leaves it empty.
+	Source      string
+	Key         string
+	Replacement string
+	// Version is the schema version that renamed the key.
+	Version Version
+}
+
+func (d Deprecation) String() string {
+	return fmt.Sprintf("%s was renamed to %s in %s", d.Key, d.Replacement, d.Version)
+}
+
+// documentVersion returns the version key of a decoded TOML document, or 0
+// if it is not set.
+func documentVersion(values map[string]any) Version {
+	v, _ := values["version"].(int64)
+	return Version(v)
+}
+
+// upgradeValues rewrites a decoded TOML document from its version to the
+// current schema. The version key itself is left alone.
+func upgradeValues(values map[string]any) ([]Deprecation, error) {
+	version := documentVersion(values)
+	var deprecations []Deprecation
+	for _, u := range upgrades {
+		if version == 0 || version > u.from {
+			continue
+		}
+		for _, root := range macosTables(values) {
+			for _, rename := range u.renames {
+				d, err := rename.apply(root.path, root.table, u.from+1)
+				if err != nil {
+					return nil, err
+				}
+				if d != nil {
+					deprecations = append(deprecations, *d)
+				}
+			}
+		}
+	}
+	return deprecations, nil
+}
+
+// upgradePath translates the dotted path of a key in a document of the given
+// version to its path in the current schema.
+func upgradePath(path []string, version Version) []string {
+	for _, u := range upgrades {
+		if version == 0 || version > u.from {
+			continue
+		}
+		rel, ok := macosRelative(path)
+		if !ok {
+			return path
+		}
+		offset := len(path) - len(rel)
+		for _, r := range u.renames {
+			if len(rel) >= len(r.old) && slices.Equal(rel[:len(r.old)], r.old) {
+				path = slices.Clone(path)
+				path[offset+len(r.old)-1] = r.new
+			}
+		}
+	}
+	return path
+}
+
+type macosTable struct {
+	path  []string
+	table map[string]any
+}
+
+// macosTables returns the top-level macos table and the macos table of every
+// profile, which renames apply to alike.
+func macosTables(values map[string]any) []macosTable {
+	var tables []macosTable
+	if macos, ok := values["macos"].(map[string]any); ok {
+		tables = append(tables, macosTable{path: []string{"macos"}, table: macos})
+	}
+	profiles, _ := values[profilesKey].(map[string]any)
+	for _, name := range slices.Sorted(maps.Keys(profiles)) {
+		profile, _ := profiles[name].(map[string]any)
+		if macos, ok := profile["macos"].(map[string]any); ok {
+			tables = append(tables, macosTable{path: []string{profilesKey, name, "macos"}, table: macos})
+		}
+	}
+	return tables
+}
+
+// macosRelative returns the part of path below a macos table.
+func macosRelative(path []string) ([]string, bool) {
+	switch {
+	case len(path) >= 1 && path[0] == "macos":
+		return path[1:], true
+	case len(path) >= 3 && path[0] == profilesKey && path[2] == "macos":
+		return path[3:], true
+	}
+	return nil, false
+}
+
+func (r keyRename) apply(root []string, table map[string]any, version Version) (*Deprecation, error) {
+	parent := table
+	for _, part := range r.old[:len(r.old)-1] {
+		next, ok := parent[part].(map[string]any)
+		if !ok {
+			return nil, nil
+		}
+		parent = next
+	}
+
+	last := r.old[len(r.old)-1]
+	value, ok := parent[last]
+	if !ok {
+		return nil, nil
+	}
+
+	d := r.deprecation(append(slices.Clone(root), r.old...), version)
+	if _, ok := parent[r.new]; ok {
+		return nil, fmt.Errorf("both %s and %s are set", d.Key, d.Replacement)
+	}
+	parent[r.new] = value
+	delete(parent, last)
+	return &d, nil
+}
+
+func (r keyRename) deprecation(path []string, version Version) Deprecation {
+	replacement := append(slices.Clone(path[:len(path)-1]), r.new)
+	return Deprecation{Key: dottedKey(path), Replacement: dottedKey(replacement), Version: version}
+}
+
+func dottedKey(path []string) string {
+	key := ""
+	for _, part := range path {
+		key = joinKey(key, part)
+	}
+	return key
+}
+
+// Migrate rewrites a configuration file to the current schema version. Only
+// the renamed keys and the version number are edited, so comments, ordering
+// and formatting are kept. It returns the content unchanged if the file
+// already uses the current version.
+func Migrate(content []byte) ([]byte, []Deprecation, error) {
+	var values map[string]any
+	if err := goToml.Unmarshal(content, &values); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	version := documentVersion(values)
+	if err := version.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("version: %w", err)
+	}
+	if version == Current() {
+		return content, nil, nil
+	}
+
+	// The text is edited blindly, so the result is checked against the
+	// document upgraded the same way the loader does it.
+	deprecations, err := upgradeValues(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	values["version"] = int64(Current())
+
+	migrated := content
+	for _, u := range upgrades {
+		if version > u.from {
+			continue
+		}
+		if migrated, err = u.rewrite(migrated); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var check map[string]any
+	if err := goToml.Unmarshal(migrated, &check); err != nil {
+		return nil, nil, fmt.Errorf("migrated config is invalid: %w", err)
+	}
+	if !reflect.DeepEqual(check, values) {
+		return nil, nil, fmt.Errorf("failed to migrate: a renamed key is written in a form that cannot be rewritten, rename it by hand")
+	}
+	return migrated, deprecations, nil
+}
+
+type textEdit struct {
+	offset, length int
+	text           string
+}
+
+// rewrite applies the upgrade's renames and version bump to the TOML text.
+func (u upgrade) rewrite(content []byte) ([]byte, error) {
+	var edits []textEdit
+	rename := func(prefix []string, keys []keyPart) {
+		path := slices.Clone(prefix)
+		for _, key := range keys {
+			path = append(path, key.name)
+			rel, ok := macosRelative(path)
+			if !ok {
+				continue
+			}
+			for _, r := range u.renames {
+				if slices.Equal(rel, r.old) {
+					edits = append(edits, textEdit{offset: int(key.raw.Offset), length: int(key.raw.Length), text: joinKey("", r.new)})
+				}
+			}
+		}
+	}
+
+	err := walkKeys(content, func(prefix []string, keys []keyPart, node *unstable.Node) {
+		rename(prefix, keys)
+		path := appendKeys(prefix, keys)
+		if node.Kind == unstable.KeyValue && len(path) == 1 && path[0] == "version" {
+			value := node.Value()
+			edits = append(edits, textEdit{offset: int(value.Raw.Offset), length: int(value.Raw.Length), text: strconv.Itoa(int(u.from + 1))})
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].offset > edits[j].offset })
+	migrated := slices.Clone(content)
+	for _, edit := range edits {
+		migrated = slices.Replace(migrated, edit.offset, edit.offset+edit.length, []byte(edit.text)...)
+	}
+	return migrated, nil
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RATIU5/fjrd/internal/logger"
+	"github.com/RATIU5/fjrd/internal/macos/menubar"
+	"github.com/RATIU5/fjrd/internal/macos/mouse"
+)
+
+const v1Config = `# Work laptop
+version = 1
+
+[macos.meubar] # clock settings
+clock-date-format = "EEE HH:mm"
+
+[macos.mouse]
+speed = 1.5
+accelerate = false # no acceleration
+
+[profiles.desk.macos]
+mouse = { accelerate = true }
+`
+
+func TestMigrate(t *testing.T) {
+	migrated, deprecations, err := Migrate([]byte(v1Config))
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	want := `# Work laptop
+version = 2
+
+[macos.menubar] # clock settings
+clock-date-format = "EEE HH:mm"
+
+[macos.mouse]
+speed = 1.5
+acceleration = false # no acceleration
+
+[profiles.desk.macos]
+mouse = { acceleration = true }
+`
+	if string(migrated) != want {
+		t.Errorf("Migrate() =\n%s\nwant\n%s", migrated, want)
+	}
+
+	var got []string
+	for _, d := range deprecations {
+		got = append(got, d.String())
+	}
+	wantDeprecations := []string{
+		"macos.meubar was renamed to macos.menubar in v2",
+		"macos.mouse.accelerate was renamed to macos.mouse.acceleration in v2",
+		"profiles.desk.macos.mouse.accelerate was renamed to profiles.desk.macos.mouse.acceleration in v2",
+	}
+	if strings.Join(got, "\n") != strings.Join(wantDeprecations, "\n") {
+		t.Errorf("deprecations = %q, want %q", got, wantDeprecations)
+	}
+
+	again, deprecations, err := Migrate(migrated)
+	if err != nil || string(again) != want || deprecations != nil {
+		t.Errorf("Migrate() of a v2 file = %q, %v, %v, want it unchanged", again, deprecations, err)
+	}
+
+	if _, _, err := Migrate([]byte("version = 1\n[macos.meubar]\n[macos.menubar]\n")); err == nil || !strings.Contains(err.Error(), "both macos.meubar and macos.menubar are set") {
+		t.Errorf("Migrate() error = %v, want a conflict", err)
+	}
+}
+
+func TestLoadConfig_Version1(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{"config.toml": v1Config})
+	var logs bytes.Buffer
+	log := logger.New(logger.LevelWarn, &logs)
+
+	cfg, err := LoadConfig(context.Background(), filepath.Join(dir, "config.toml"), log, LoadOptions{Facts: StaticFacts{}})
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	menu := cfg.Macos.Section("menubar").(*menubar.Config)
+	if menu.ClockDateFormat == nil || *menu.ClockDateFormat != "EEE HH:mm" {
+		t.Errorf("menubar = %+v, want the v1 meubar table", menu)
+	}
+	if m := cfg.Macos.Section("mouse").(*mouse.Config); m.Acceleration == nil || *m.Acceleration {
+		t.Errorf("mouse = %+v, want acceleration false", m)
+	}
+
+	for _, key := range []string{"macos.meubar", "macos.mouse.accelerate", "profiles.desk.macos.mouse.accelerate"} {
+		if !strings.Contains(logs.String(), "key="+key+" ") {
+			t.Errorf("no deprecation warning for %s in:\n%s", key, logs.String())
+		}
+	}
+}
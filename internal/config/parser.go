@@ -2,18 +2,20 @@ package config
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
-
-	goToml "github.com/pelletier/go-toml/v2"
 )
 
 type PathType int
@@ -373,28 +375,119 @@ func parseGitPath(ctx context.Context, path string, log interface {
 	return ""
 }
 
+// LoadOptions controls how LoadConfig selects profiles.
+type LoadOptions struct {
+	// Profiles names the profiles to apply, in order. If empty, every
+	// profile whose matchers match the facts is applied.
+	Profiles []string
+	// Facts provides the matcher inputs and ${fact:...} values. Nil reads
+	// them from the system.
+	Facts FactsProvider
+	// Lenient logs keys the schema does not define as warnings instead of
+	// failing.
+	Lenient bool
+}
+
 func LoadConfig(ctx context.Context, location string, log interface {
 	Info(string, ...any)
 	Debug(string, ...any)
 	Warn(string, ...any)
-}) (*FjrdConfig, error) {
+}, opts LoadOptions) (*FjrdConfig, error) {
 	log.Debug("Loading configuration", "location", location)
 
 	pathType := determinePathType(location)
 	log.Debug("Determined path type", "type", pathType.String(), "location", location)
 
-	content, err := resolveTomlResource(ctx, location, log)
+	doc, err := LoadDocument(ctx, location, log)
 	if err != nil {
 		return nil, fmt.Errorf("failed to resolve config location: %w", err)
 	}
 
-	log.Debug("Configuration content loaded", "size", len(content))
+	for _, d := range doc.Deprecations {
+		log.Warn("Deprecated key, run fjrd migrate to update the file", "source", d.Source, "key", d.Key, "replacement", d.Replacement, "since", d.Version.String())
+	}
+	if len(doc.UnknownKeys) > 0 {
+		if !opts.Lenient {
+			return nil, unknownKeysError(doc.UnknownKeys)
+		}
+		for _, u := range doc.UnknownKeys {
+			log.Warn("Ignoring unknown key", "location", u.Location(), "key", u.Key, "suggestion", u.Suggestion)
+		}
+	}
+
+	facts := newCachedFacts(opts.Facts)
+	expandProfile, err := doc.interpolate(ctx, facts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to interpolate config: %w", err)
+	}
+
+	content, err := doc.Content()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("Configuration content loaded", "size", len(content), "sources", len(doc.Sources))
 
+	// The profiles are selected from a first, unvalidated decode: when
+	// expressions are only removed after the profiles are merged.
 	var cfg FjrdConfig
+	if err := decodeConfig([]byte(content), &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	profiles, err := cfg.selectProfiles(ctx, opts.Profiles, facts)
+	if err != nil {
+		return nil, err
+	}
+	if len(profiles) > 0 {
+		log.Debug("Applying profiles", "profiles", strings.Join(profiles, ","))
+		for _, name := range profiles {
+			if err := expandProfile(name); err != nil {
+				return nil, fmt.Errorf("failed to interpolate profile %s: %w", name, err)
+			}
+			if err := doc.applyProfile(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Inactive profiles are validated too, except for the values that refer
+	// to something this machine does not provide.
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+		if slices.Contains(profiles, name) {
+			continue
+		}
+		if err := doc.removeUnavailable(expandProfile(name)); err != nil {
+			return nil, fmt.Errorf("failed to interpolate profile %s: %w", name, err)
+		}
+	}
+
+	skipped, err := doc.applyWhen(ctx, facts)
+	if err != nil {
+		return nil, err
+	}
+	for _, skip := range skipped {
+		log.Debug("Skipping item", "item", skip.Item, "reason", skip.Reason)
+	}
+
+	if content, err = doc.Content(); err != nil {
+		return nil, err
+	}
+	cfg = FjrdConfig{}
 	if err := parseConfig(content, &cfg); err != nil {
+		if len(profiles) > 0 {
+			return nil, fmt.Errorf("failed to parse config with profiles %s: %w", strings.Join(profiles, ", "), err)
+		}
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
+	sum := sha256.Sum256([]byte(content))
+	cfg.source = location
+	cfg.hash = hex.EncodeToString(sum[:])
+	cfg.document = doc
+	cfg.active = profiles
+	cfg.skipped = skipped
+
 	log.Debug("Configuration parsed successfully", "version", cfg.Version)
 	return &cfg, nil
 }
@@ -430,7 +523,7 @@ func resolveTomlResource(ctx context.Context, location string, log interface {
 }
 
 func parseConfig(content string, cfg *FjrdConfig) error {
-	err := goToml.Unmarshal([]byte(content), &cfg)
+	err := decodeConfig([]byte(content), cfg)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+	"github.com/RATIU5/fjrd/internal/logger"
+	"github.com/RATIU5/fjrd/internal/macos/defaults"
+)
+
+// SectionPlan holds the planned changes for one configuration section.
+type SectionPlan struct {
+	Name     string
+	Changes  []defaults.Change
+	Restarts []defaults.Restart
+}
+
+// HasChanges reports whether applying the section would write, delete or
+// create anything, and therefore restart its processes.
+func (s SectionPlan) HasChanges() bool {
+	for _, change := range s.Changes {
+		if change.Pending() {
+			return true
+		}
+	}
+	return false
+}
+
+// Plan describes what applying a configuration would change, without
+// writing anything.
+type Plan struct {
+	Sections []SectionPlan
+	// Skipped lists the sections and raw entries whose when expressions
+	// were false.
+	Skipped []Skip
+}
+
+func (c *FjrdConfig) Plan(ctx context.Context, log *logger.Logger) (*Plan, error) {
+	plan, err := c.Macos.Plan(ctx, log)
+	if err != nil {
+		return nil, err
+	}
+	plan.Skipped = c.skipped
+	return plan, nil
+}
+
+func (c *MacosConfig) Plan(ctx context.Context, log *logger.Logger) (*Plan, error) {
+	log = log.WithComponent("plan")
+	multiErr := errors.NewMultiError()
+	plan := &Plan{}
+
+	for _, s := range c.sections() {
+		batch, err := s.Batch()
+		if err != nil {
+			multiErr.Add(errors.WrapConfigError("macos", "plan", s.Key, nil, err))
+			continue
+		}
+		if batch.Len() == 0 {
+			continue
+		}
+
+		log.Debug("Planning section", "section", s.Key, "commands", batch.Len())
+		changes, err := batch.Plan(ctx)
+		if err != nil {
+			multiErr.Add(errors.WrapConfigError("macos", "plan", s.Key, nil, err))
+			continue
+		}
+
+		sectionPlan := SectionPlan{Name: s.Key, Changes: changes}
+		if sectionPlan.HasChanges() {
+			sectionPlan.Restarts = s.Restarts()
+		}
+		plan.Sections = append(plan.Sections, sectionPlan)
+	}
+
+	if err := multiErr.ToError(); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Counts returns the number of writes, deletes and unchanged keys in the plan.
+func (p *Plan) Counts() (writes, deletes, unchanged int) {
+	for _, section := range p.Sections {
+		for _, change := range section.Changes {
+			switch change.Kind {
+			case defaults.ChangeWrite:
+				writes++
+			case defaults.ChangeDelete:
+				deletes++
+			default:
+				unchanged++
+			}
+		}
+	}
+	return writes, deletes, unchanged
+}
+
+// TypeMismatches returns the planned writes that would change the type a key
+// is stored with, where the section does not declare the native type.
+func (p *Plan) TypeMismatches() []defaults.Change {
+	var mismatches []defaults.Change
+	for _, section := range p.Sections {
+		for _, change := range section.Changes {
+			if change.TypeMismatch() {
+				mismatches = append(mismatches, change)
+			}
+		}
+	}
+	return mismatches
+}
+
+// Restarts returns the distinct processes the plan would restart, in the
+// order they are restarted at the end of an apply.
+func (p *Plan) Restarts() []defaults.Restart {
+	var restarts []defaults.Restart
+	for _, section := range p.Sections {
+		restarts = append(restarts, section.Restarts...)
+	}
+	return defaults.CoalesceRestarts(restarts)
+}
+
+// Privileged returns the planned changes that need elevated privileges, as
+// the commands the escalation step will run.
+func (p *Plan) Privileged() ([]string, error) {
+	var commands []defaults.Command
+	for _, section := range p.Sections {
+		for _, change := range section.Changes {
+			if change.Command.Scope.Privileged() && change.Kind != defaults.ChangeNone {
+				commands = append(commands, change.Command)
+			}
+		}
+	}
+	return defaults.EscalationCommands(commands)
+}
+
+// Render writes a human readable diff of the plan:
+//
+//	~ changed key (old → new), or for arrays and dicts the elements
+//	  added, removed or changed, followed by the type transition if the
+//	  key's type changes
+//	+ key that is currently unset
+//	- key deleted by a reset
+//	= key already set to the desired value
+//
+// each preceded by "+ mkdir <path>" if the key names a missing directory
+// that is created first, followed by the sections and raw entries skipped
+// by their when expressions.
+func (p *Plan) Render(w io.Writer) error {
+	for _, section := range p.Sections {
+		fmt.Fprintf(w, "[%s]\n", section.Name)
+		for _, change := range section.Changes {
+			cmd := change.Command
+			if change.CreateDir {
+				fmt.Fprintf(w, "  + mkdir %s\n", cmd.CreateDir)
+			}
+			switch {
+			case change.Kind == defaults.ChangeDelete:
+				fmt.Fprintf(w, "  - %s (%s, reset to default)\n", cmd.Name(), change.Current)
+			case change.Kind == defaults.ChangeWrite && change.Details() != nil:
+				fmt.Fprintf(w, "  ~ %s:\n", cmd.Name())
+				for _, detail := range change.Details() {
+					fmt.Fprintf(w, "      %s\n", detail)
+				}
+			case change.TypeChanged():
+				fmt.Fprintf(w, "  ~ %s: %s → %s (type %s)\n", cmd.Name(), change.Current, cmd.Value, typeTransition(change))
+			case change.Kind == defaults.ChangeWrite && change.Exists():
+				fmt.Fprintf(w, "  ~ %s: %s → %s\n", cmd.Name(), change.Current, cmd.Value)
+			case change.Kind == defaults.ChangeWrite:
+				fmt.Fprintf(w, "  + %s: %s\n", cmd.Name(), cmd.Value)
+			case change.Exists():
+				fmt.Fprintf(w, "  = %s: %s\n", cmd.Name(), change.Current)
+			default:
+				fmt.Fprintf(w, "  = %s: (unset)\n", cmd.Name())
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(p.Skipped) > 0 {
+		fmt.Fprintln(w, "Skipped:")
+		for _, skip := range p.Skipped {
+			fmt.Fprintf(w, "  %s\n", skip)
+		}
+		fmt.Fprintln(w)
+	}
+
+	writes, deletes, unchanged := p.Counts()
+	fmt.Fprintf(w, "Plan: %d to write, %d to delete, %d unchanged\n", writes, deletes, unchanged)
+	if mismatches := p.TypeMismatches(); len(mismatches) > 0 {
+		fmt.Fprintf(w, "Warning: %d keys change type, apply with -strict to refuse\n", len(mismatches))
+	}
+
+	restarts := p.Restarts()
+	if len(restarts) == 0 {
+		_, err := fmt.Fprintln(w, "Processes to restart: none")
+		return err
+	}
+
+	fmt.Fprintln(w, "Processes to restart:")
+	for _, restart := range restarts {
+		if restart.OnlyIfRunning {
+			fmt.Fprintf(w, "  %s (if running)\n", restart.Process)
+		} else {
+			fmt.Fprintf(w, "  %s\n", restart.Process)
+		}
+	}
+	return nil
+}
+
+func typeTransition(change defaults.Change) string {
+	return change.Current.Type().Name() + " → " + change.Command.Value.Type().Name()
+}
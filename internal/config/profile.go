@@ -0,0 +1,248 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/RATIU5/fjrd/internal/shared"
+)
+
+// profilesKey is the top-level table holding the profiles.
+const profilesKey = "profiles"
+
+// Profile overlays the macos sections for the machines it matches, or when
+// it is selected with -profile.
+type Profile struct {
+	Match ProfileMatch `toml:"match,omitempty" doc:"Machines the profile is applied on; every matcher that is set has to match"`
+	Macos MacosConfig  `toml:"macos" doc:"Settings merged into macos when the profile is applied"`
+}
+
+func (p *Profile) Validate() error {
+	return shared.ValidateAll(&p.Match, &p.Macos)
+}
+
+// ProfileMatch selects a profile automatically. Every matcher that is set
+// has to match. A profile without matchers is only used when selected by
+// name.
+type ProfileMatch struct {
+	// Hostname is a glob such as "*-mbp".
+	Hostname string `toml:"hostname,omitempty" doc:"Glob matched against the hostname, e.g. *-mbp"`
+	// MacOS is a version range such as ">=14, <16", or a version prefix
+	// such as "15".
+	MacOS string `toml:"macos,omitempty" doc:"macOS version range such as >=14, <16, or a version prefix such as 15"`
+	// Arch is arm64 or amd64. x86_64 is accepted for amd64.
+	Arch string `toml:"arch,omitempty" doc:"CPU architecture"`
+	// User is a glob matched against the username.
+	User string `toml:"user,omitempty" doc:"Glob matched against the username"`
+}
+
+var archAliases = map[string]string{
+	"arm64":  "arm64",
+	"amd64":  "amd64",
+	"x86_64": "amd64",
+}
+
+func (m *ProfileMatch) Validate() error {
+	if _, err := path.Match(m.Hostname, ""); err != nil {
+		return fmt.Errorf("invalid hostname pattern %q: %w", m.Hostname, err)
+	}
+	if _, err := path.Match(m.User, ""); err != nil {
+		return fmt.Errorf("invalid user pattern %q: %w", m.User, err)
+	}
+	if m.Arch != "" {
+		if _, ok := archAliases[m.Arch]; !ok {
+			return fmt.Errorf("invalid arch %q, must be arm64 or amd64", m.Arch)
+		}
+	}
+	if m.MacOS != "" {
+		if _, err := parseVersionRange(m.MacOS); err != nil {
+			return fmt.Errorf("invalid macos range %q: %w", m.MacOS, err)
+		}
+	}
+	return nil
+}
+
+// IsEmpty reports whether no matcher is set.
+func (m ProfileMatch) IsEmpty() bool {
+	return m == ProfileMatch{}
+}
+
+// Matches reports whether every matcher that is set matches facts.
+func (m ProfileMatch) Matches(facts Facts) bool {
+	if m.IsEmpty() {
+		return false
+	}
+	if m.Hostname != "" {
+		if ok, _ := path.Match(m.Hostname, facts.Hostname); !ok {
+			return false
+		}
+	}
+	if m.User != "" {
+		if ok, _ := path.Match(m.User, facts.Username); !ok {
+			return false
+		}
+	}
+	if m.Arch != "" && archAliases[m.Arch] != facts.Arch {
+		return false
+	}
+	if m.MacOS != "" {
+		constraints, err := parseVersionRange(m.MacOS)
+		if err != nil || !constraints.contains(facts.MacOSVersion) {
+			return false
+		}
+	}
+	return true
+}
+
+type versionConstraint struct {
+	op      string
+	version []int
+}
+
+type versionRange []versionConstraint
+
+// parseVersionRange parses comma separated constraints such as ">=14.2".
+// A version without an operator matches every version it is a prefix of.
+func parseVersionRange(s string) (versionRange, error) {
+	var r versionRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		op := ""
+		for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(part, candidate) {
+				op = candidate
+				break
+			}
+		}
+
+		version, err := parseVersion(strings.TrimSpace(strings.TrimPrefix(part, op)))
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, versionConstraint{op: op, version: version})
+	}
+	return r, nil
+}
+
+func parseVersion(s string) ([]int, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+	var version []int
+	for _, field := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", s)
+		}
+		version = append(version, n)
+	}
+	return version, nil
+}
+
+func (r versionRange) contains(s string) bool {
+	version, err := parseVersion(s)
+	if err != nil {
+		return false
+	}
+
+	for _, c := range r {
+		var ok bool
+		switch cmp := compareVersions(version, c.version); c.op {
+		case ">=":
+			ok = cmp >= 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case "<":
+			ok = cmp < 0
+		case "=":
+			ok = cmp == 0
+		default:
+			ok = len(version) >= len(c.version) && slices.Equal(version[:len(c.version)], c.version)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// compareVersions compares dotted versions, treating missing components as
+// zero so that 14 equals 14.0.
+func compareVersions(a, b []int) int {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// selectProfiles returns the profiles to apply: the named ones in the given
+// order, or else every profile whose matchers match the facts, by name.
+func (c *FjrdConfig) selectProfiles(ctx context.Context, selected []string, provider FactsProvider) ([]string, error) {
+	if len(selected) > 0 {
+		for _, name := range selected {
+			if _, ok := c.Profiles[name]; !ok {
+				return nil, fmt.Errorf("unknown profile %q", name)
+			}
+		}
+		return selected, nil
+	}
+
+	var names []string
+	for name, profile := range c.Profiles {
+		if !profile.Match.IsEmpty() {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	slices.Sort(names)
+
+	facts, err := provider.Facts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather facts: %w", err)
+	}
+
+	return slices.DeleteFunc(names, func(name string) bool {
+		return !c.Profiles[name].Match.Matches(facts)
+	}), nil
+}
+
+// applyProfile merges the profile's macos tables over the document's. The
+// merged values keep the location of the profile, marked with its name.
+func (d *Document) applyProfile(name string) error {
+	profiles, _ := d.Values[profilesKey].(map[string]any)
+	profile, ok := profiles[name].(map[string]any)
+	if !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+	macos, ok := profile["macos"].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	prefix := joinKey(joinKey("", profilesKey), name)
+	mergeTOML(d.Values, map[string]any{"macos": macos}, "", func(key string) string {
+		return fmt.Sprintf("%s (profile %s)", d.provenance[prefix+"."+key], name)
+	}, d.provenance)
+	d.content = ""
+	return nil
+}
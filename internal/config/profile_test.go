@@ -0,0 +1,134 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/RATIU5/fjrd/internal/macos/dock"
+)
+
+func TestProfileMatch_Matches(t *testing.T) {
+	facts := Facts{Hostname: "ana-mbp", MacOSVersion: "14.5", Arch: "arm64", Username: "ana"}
+
+	tests := []struct {
+		name  string
+		match ProfileMatch
+		want  bool
+	}{
+		{name: "no matchers", match: ProfileMatch{}, want: false},
+		{name: "hostname glob", match: ProfileMatch{Hostname: "*-mbp"}, want: true},
+		{name: "hostname mismatch", match: ProfileMatch{Hostname: "*-imac"}, want: false},
+		{name: "version range", match: ProfileMatch{MacOS: ">=14, <15"}, want: true},
+		{name: "version below range", match: ProfileMatch{MacOS: ">=14.6"}, want: false},
+		{name: "version prefix", match: ProfileMatch{MacOS: "14"}, want: true},
+		{name: "version prefix mismatch", match: ProfileMatch{MacOS: "14.4"}, want: false},
+		{name: "arch alias", match: ProfileMatch{Arch: "x86_64"}, want: false},
+		{name: "all matchers", match: ProfileMatch{Hostname: "ana-*", MacOS: ">13", Arch: "arm64", User: "ana"}, want: true},
+		{name: "one matcher fails", match: ProfileMatch{Hostname: "ana-*", User: "bob"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.match.Matches(facts); got != tt.want {
+				t.Errorf("Matches() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+const profilesConfig = `
+version = 1
+
+[macos.dock]
+autohide = true
+tilesize = 48
+
+[profiles.laptop]
+match = { hostname = "*-mbp" }
+
+[profiles.laptop.macos.dock]
+tilesize = 36
+
+[profiles.presenter.macos.dock]
+autohide = false
+`
+
+func TestLoadConfig_Profiles(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{"config.toml": profilesConfig})
+	location := filepath.Join(dir, "config.toml")
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		opts     LoadOptions
+		active   []string
+		autohide bool
+		tilesize int64
+	}{
+		{
+			name:     "matched by hostname",
+			opts:     LoadOptions{Facts: StaticFacts{Hostname: "ana-mbp"}},
+			active:   []string{"laptop"},
+			autohide: true,
+			tilesize: 36,
+		},
+		{
+			name:     "no match",
+			opts:     LoadOptions{Facts: StaticFacts{Hostname: "ana-imac"}},
+			autohide: true,
+			tilesize: 48,
+		},
+		{
+			name:     "selected by name",
+			opts:     LoadOptions{Profiles: []string{"presenter"}, Facts: StaticFacts{Hostname: "ana-mbp"}},
+			active:   []string{"presenter"},
+			autohide: false,
+			tilesize: 48,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(ctx, location, testLogger(), tt.opts)
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if got := cfg.ActiveProfiles(); !slices.Equal(got, tt.active) {
+				t.Errorf("ActiveProfiles() = %q, want %q", got, tt.active)
+			}
+			if d := cfg.Macos.Section("dock").(*dock.Config); *d.Autohide != tt.autohide || *d.TileSize != tt.tilesize {
+				t.Errorf("dock = %+v", d)
+			}
+		})
+	}
+
+	cfg, err := LoadConfig(ctx, location, testLogger(), LoadOptions{Facts: StaticFacts{Hostname: "ana-mbp"}})
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if got, want := cfg.Document().Source("macos.dock.tilesize"), location+" (profile laptop)"; got != want {
+		t.Errorf("Source() = %q, want %q", got, want)
+	}
+
+	if _, err := LoadConfig(ctx, location, testLogger(), LoadOptions{Profiles: []string{"desktop"}}); err == nil {
+		t.Error("LoadConfig() accepted an unknown profile")
+	}
+}
+
+func TestFjrdConfig_Validate_InactiveProfile(t *testing.T) {
+	const config = profilesConfig + `
+[profiles.broken]
+match = { macos = ">=fourteen" }
+
+[profiles.broken.macos.dock]
+tilesize = 4096
+`
+	var cfg FjrdConfig
+	err := parseConfig(config, &cfg)
+	if err == nil || !strings.Contains(err.Error(), "profile broken") {
+		t.Fatalf("parseConfig() error = %v, want an error for profile broken", err)
+	}
+}
@@ -3,40 +3,72 @@ package config
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/RATIU5/fjrd/internal/errors"
 	"github.com/RATIU5/fjrd/internal/logger"
 	"github.com/RATIU5/fjrd/internal/macos/defaults"
-	"github.com/RATIU5/fjrd/internal/macos/desktop"
-	"github.com/RATIU5/fjrd/internal/macos/dock"
-	"github.com/RATIU5/fjrd/internal/macos/finder"
-	"github.com/RATIU5/fjrd/internal/macos/keyboard"
-	"github.com/RATIU5/fjrd/internal/macos/menubar"
-	"github.com/RATIU5/fjrd/internal/macos/missionControl"
-	"github.com/RATIU5/fjrd/internal/macos/mouse"
-	"github.com/RATIU5/fjrd/internal/macos/safari"
-	"github.com/RATIU5/fjrd/internal/macos/screenshots"
-	"github.com/RATIU5/fjrd/internal/macos/trackpad"
+	"github.com/RATIU5/fjrd/internal/macos/section"
 	"github.com/RATIU5/fjrd/internal/shared"
+	goToml "github.com/pelletier/go-toml/v2"
 )
 
+// MacosConfig holds the sections of a macos table by their keys. Each table
+// is decoded into the section registered for its key, see package section.
 type MacosConfig struct {
-	Dock           dock.Config           `toml:"dock"`
-	Finder         finder.Config         `toml:"finder"`
-	Desktop        desktop.Config        `toml:"desktop"`
-	Safari         safari.Config         `toml:"safari"`
-	Screenshots    screenshots.Config    `toml:"screenshots"`
-	Menubar        menubar.Config        `toml:"meubar"`
-	Mouse          mouse.Config          `toml:"mouse"`
-	Trackpad       trackpad.Config       `toml:"trackpad"`
-	Keyboard       keyboard.Config       `toml:"keyboard"`
-	MissionControl missionControl.Config `toml:"mission-control"`
-	DefaultsRaw    defaults.Raw          `toml:"defaultsRaw"`
+	configured map[string]any
 }
 
 type FjrdConfig struct {
-	Version Version     `toml:"version"`
-	Macos   MacosConfig `toml:"macos"`
+	Version Version     `toml:"version" doc:"Schema version of the file"`
+	Macos   MacosConfig `toml:"macos" doc:"Settings applied on every machine"`
+	// Include lists the configurations this one is layered on top of.
+	// LoadConfig merges them, so a loaded configuration has none left.
+	Include []string `toml:"include,omitempty" doc:"Configurations this one is layered on top of: paths, URLs or owner/repo"`
+	// Profiles overlay Macos on the machines they match. LoadConfig merges
+	// the selected ones into Macos.
+	Profiles map[string]Profile `toml:"profiles,omitempty" doc:"Settings applied on top of macos on the machines a profile matches"`
+	// Vars are referred to as ${var:name} in string values. LoadConfig
+	// expands the references.
+	Vars map[string]string `toml:"vars,omitempty" doc:"Variables string values refer to as ${var:name}"`
+
+	source   string
+	hash     string
+	document *Document
+	active   []string
+	skipped  []Skip
+}
+
+// Source returns the location the configuration was loaded from.
+func (c *FjrdConfig) Source() string {
+	return c.source
+}
+
+// Hash returns the hex encoded SHA-256 of the configuration file contents.
+func (c *FjrdConfig) Hash() string {
+	return c.hash
+}
+
+// Skipped returns the sections and raw entries left out because their when
+// expressions were false on this machine.
+func (c *FjrdConfig) Skipped() []Skip {
+	return c.skipped
+}
+
+// Document returns the merged document the configuration was decoded from.
+func (c *FjrdConfig) Document() *Document {
+	return c.document
+}
+
+// ActiveProfiles returns the names of the profiles merged into Macos, in the
+// order they were applied.
+func (c *FjrdConfig) ActiveProfiles() []string {
+	return c.active
 }
 
 func (m *MacosConfig) String() string {
@@ -44,19 +76,66 @@ func (m *MacosConfig) String() string {
 }
 
 func (m *MacosConfig) Fields() map[string]any {
-	return map[string]any{
-		"dock":            m.Dock,
-		"finder":          m.Finder,
-		"desktop":         m.Desktop,
-		"safari":          m.Safari,
-		"screenshots":     m.Screenshots,
-		"menubar":         m.Menubar,
-		"mouse":           m.Mouse,
-		"trackpad":        m.Trackpad,
-		"keyboard":        m.Keyboard,
-		"mission-control": m.MissionControl,
-		"defaultsRaw":     m.DefaultsRaw,
+	fields := make(map[string]any, len(m.configured))
+	for _, s := range m.sections() {
+		if _, ok := m.configured[s.Key]; ok {
+			fields[s.Key] = s
+		}
+	}
+	return fields
+}
+
+// Section returns the struct the section configured under key was decoded
+// into, or an empty one if the table is not set. It returns nil if no
+// section is registered for key.
+func (m *MacosConfig) Section(key string) any {
+	if s, ok := m.configured[key]; ok {
+		return s
+	}
+	if r, ok := section.Lookup(key); ok {
+		return r.New()
+	}
+	return nil
+}
+
+// decode decodes the tables of a macos table into their sections. Tables no
+// section is registered for are left to the unknown key check.
+func (m *MacosConfig) decode(tables map[string]any) error {
+	m.configured = make(map[string]any, len(tables))
+	for _, key := range slices.Sorted(maps.Keys(tables)) {
+		r, ok := section.Lookup(key)
+		if !ok {
+			continue
+		}
+		b, err := goToml.Marshal(tables[key])
+		if err != nil {
+			return err
+		}
+		s := r.New()
+		if err := goToml.Unmarshal(b, s); err != nil {
+			return err
+		}
+		m.configured[key] = s
+	}
+	return nil
+}
+
+// raw returns the raw defaults of the table.
+func (m *MacosConfig) raw() defaults.Raw {
+	if raw, ok := m.configured[rawKey].(*defaults.Raw); ok {
+		return *raw
 	}
+	return nil
+}
+
+// sections returns every registered section in the order they are applied,
+// empty where the table is not set.
+func (m *MacosConfig) sections() []Section {
+	var sections []Section
+	for _, r := range section.All() {
+		sections = append(sections, Section{Registration: r, Config: m.Section(r.Key)})
+	}
+	return sections
 }
 
 func (c *FjrdConfig) String() string {
@@ -71,97 +150,322 @@ func (c *FjrdConfig) Fields() map[string]any {
 }
 
 func (c *MacosConfig) Validate() error {
-	return shared.ValidateAll(
-		&c.Dock,
-		&c.Finder,
-		&c.Desktop,
-		&c.Safari,
-		&c.Screenshots,
-		&c.Menubar,
-		&c.Mouse,
-		&c.Trackpad,
-		&c.Keyboard,
-		&c.MissionControl,
-		&c.DefaultsRaw,
-	)
+	var validators []shared.Validator
+	for _, s := range c.sections() {
+		validators = append(validators, s)
+	}
+	return shared.ValidateAll(validators...)
 }
 
+// Validate validates the configuration and every profile, whether or not it
+// is active on this machine.
 func (c *FjrdConfig) Validate() error {
-	return shared.ValidateAll(&c.Version, &c.Macos)
+	errs := errors.NewMultiError(shared.ValidateAll(&c.Version, &c.Macos))
+
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		profile := c.Profiles[name]
+		if err := profile.Validate(); err != nil {
+			errs.Add(fmt.Errorf("profile %s: %w", name, err))
+		}
+	}
+	return errs.ToError()
 }
 
+// ApplyOptions controls how a configuration is applied.
+type ApplyOptions struct {
+	// NoRestart skips the end-of-run process restart phase.
+	NoRestart bool
+	// Atomic snapshots every key the configuration touches and restores it
+	// if any write or restart fails, instead of carrying on.
+	Atomic bool
+	// Strict refuses to apply anything if a write would change the type a
+	// key is stored with. By default such writes go ahead with a warning.
+	Strict bool
+}
+
+// rollbackTimeout bounds an atomic rollback. Rollback runs on its own context
+// so that it still happens when the apply itself timed out.
+const rollbackTimeout = 30 * time.Second
+
 func (c *MacosConfig) Execute(ctx context.Context, log *logger.Logger) error {
+	_, err := c.Apply(ctx, log, ApplyOptions{})
+	return err
+}
+
+// Apply writes every key that differs from the current state, then restarts
+// each process needed by a changed section once, in a fixed order.
+func (c *MacosConfig) Apply(ctx context.Context, log *logger.Logger, opts ApplyOptions) (defaults.Result, error) {
 	log = log.WithComponent("macos")
-	multiErr := errors.NewMultiError()
+	if opts.Strict {
+		if err := c.checkTypes(ctx, log); err != nil {
+			return defaults.Result{}, err
+		}
+	}
+	if opts.Atomic {
+		return c.applyAtomic(ctx, log, opts)
+	}
+
+	total, _, err := c.apply(ctx, log, opts)
+	return total, err
+}
 
-	if err := c.Dock.Execute(ctx, log); err != nil {
-		multiErr.Add(errors.WrapConfigError("macos", "execute", "dock", nil, err))
+func (c *MacosConfig) applyAtomic(ctx context.Context, log *logger.Logger, opts ApplyOptions) (defaults.Result, error) {
+	var commands []defaults.Command
+	for _, s := range c.sections() {
+		batch, err := s.Batch()
+		if err != nil {
+			return defaults.Result{}, errors.WrapConfigError("macos", "execute", s.Key, nil, err)
+		}
+		commands = append(commands, batch.Commands()...)
+	}
+
+	snapshot, err := defaults.TakeSnapshot(ctx, commands)
+	if err != nil {
+		return defaults.Result{}, errors.WrapConfigError("macos", "snapshot", "", nil, err)
 	}
+	log.Debug("Snapshot taken", "keys", snapshot.Len())
 
-	if err := c.Finder.Execute(ctx, log); err != nil {
-		multiErr.Add(errors.WrapConfigError("macos", "execute", "finder", nil, err))
+	total, restarted, err := c.apply(ctx, log, opts)
+	if err == nil {
+		return total, nil
 	}
 
-	if err := c.Desktop.Execute(ctx, log); err != nil {
-		multiErr.Add(errors.WrapConfigError("macos", "execute", "desktop", nil, err))
+	log.Warn("Apply failed, rolling back", "error", err, "keys", snapshot.Len())
+	rollbackCtx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	if rollbackErr := snapshot.Restore(rollbackCtx, log); rollbackErr != nil {
+		return total, errors.Combine(err, errors.WrapConfigError("macos", "rollback", "", nil, rollbackErr))
 	}
 
-	if err := c.Safari.Execute(ctx, log); err != nil {
-		multiErr.Add(errors.WrapConfigError("macos", "execute", "safari", nil, err))
+	// Processes restarted before the failure have loaded the new values.
+	for _, restart := range restarted {
+		if restartErr := restart.Execute(rollbackCtx); restartErr != nil {
+			log.Warn("Failed to restart process after rollback", "process", restart.Process, "error", restartErr)
+		}
 	}
 
-	if err := c.Screenshots.Execute(ctx, log); err != nil {
-		multiErr.Add(errors.WrapConfigError("macos", "execute", "screenshots", nil, err))
+	log.Info("Rolled back all changes", "keys", snapshot.Len())
+	total.RolledBack = true
+	return total, errors.WrapConfigError("macos", "execute", "", nil, fmt.Errorf("rolled back after failure: %w", err))
+}
+
+// checkTypes plans the configuration and fails if any write would change the
+// type of a key whose native type the section does not declare.
+func (c *MacosConfig) checkTypes(ctx context.Context, log *logger.Logger) error {
+	plan, err := c.Plan(ctx, log)
+	if err != nil {
+		return errors.WrapConfigError("macos", "check_types", "", nil, err)
 	}
 
-	if err := c.Menubar.Execute(ctx, log); err != nil {
-		multiErr.Add(errors.WrapConfigError("macos", "execute", "menubar", nil, err))
+	mismatches := plan.TypeMismatches()
+	if len(mismatches) == 0 {
+		return nil
 	}
 
-	if err := c.Mouse.Execute(ctx, log); err != nil {
-		multiErr.Add(errors.WrapConfigError("macos", "execute", "mouse", nil, err))
+	multiErr := errors.NewMultiError()
+	for _, change := range mismatches {
+		multiErr.Add(errors.WrapConfigError("macos", "check_types", change.Command.Name(), change.Current,
+			fmt.Errorf("%w: stored as %s, configured as %s", defaults.ErrTypeMismatch, change.Current.Type().Name(), change.Command.Value.Type().Name())))
 	}
+	return multiErr
+}
 
-	if err := c.Trackpad.Execute(ctx, log); err != nil {
-		multiErr.Add(errors.WrapConfigError("macos", "execute", "trackpad", nil, err))
+// warnTypeChanges logs the keys whose stored type was changed without the
+// section declaring their native type.
+func warnTypeChanges(log *logger.Logger, outcomes []defaults.Outcome) {
+	for _, outcome := range outcomes {
+		if outcome.Err == nil && outcome.TypeMismatch() {
+			log.Warn("Changed the type a key is stored with, the owning app may not expect it",
+				"key", outcome.Command.Name(),
+				"from", outcome.Current.Type().Name(),
+				"to", outcome.Command.Value.Type().Name())
+		}
 	}
+}
+
+// privilegedSection holds the system scope commands of a section until the
+// escalation step.
+type privilegedSection struct {
+	Section
+	commands []defaults.Command
+}
 
-	if err := c.Keyboard.Execute(ctx, log); err != nil {
-		multiErr.Add(errors.WrapConfigError("macos", "execute", "keyboard", nil, err))
+// apply runs every section, then all privileged writes in one escalation,
+// then the restart phase. It returns the restarts that were performed. In
+// atomic mode it stops at the first failure.
+func (c *MacosConfig) apply(ctx context.Context, log *logger.Logger, opts ApplyOptions) (defaults.Result, []defaults.Restart, error) {
+	multiErr := errors.NewMultiError()
+
+	var total defaults.Result
+	var restarts []defaults.Restart
+	var privileged []privilegedSection
+	for _, s := range c.sections() {
+		result, system, err := applySection(ctx, log.WithComponent(s.Key), s)
+		total.Add(result)
+		warnTypeChanges(log.WithComponent(s.Key), result.Outcomes)
+		if err != nil {
+			multiErr.Add(errors.WrapConfigError("macos", "execute", s.Key, nil, err))
+			if opts.Atomic {
+				return total, nil, multiErr
+			}
+		}
+		if result.Changed > 0 {
+			restarts = append(restarts, s.Restarts()...)
+		}
+		if len(system) > 0 {
+			privileged = append(privileged, privilegedSection{s, system})
+		}
 	}
 
-	if err := c.MissionControl.Execute(ctx, log); err != nil {
-		multiErr.Add(errors.WrapConfigError("macos", "execute", "mission-control", nil, err))
+	if len(privileged) > 0 {
+		var commands []defaults.Command
+		for _, p := range privileged {
+			commands = append(commands, p.commands...)
+		}
+
+		result, err := defaults.ApplyPrivileged(ctx, commands, log)
+		total.Add(result)
+		warnTypeChanges(log, result.Outcomes)
+		if err != nil {
+			multiErr.Add(errors.WrapConfigError("macos", "escalate", "", nil, err))
+			if opts.Atomic {
+				return total, nil, multiErr
+			}
+		}
+
+		// Outcomes come back in command order, so each section's slice of
+		// them tells whether it changed anything.
+		if len(result.Outcomes) == len(commands) {
+			offset := 0
+			for _, p := range privileged {
+				outcomes := result.Outcomes[offset : offset+len(p.commands)]
+				offset += len(p.commands)
+				for _, outcome := range outcomes {
+					if outcome.Kind != defaults.ChangeNone && outcome.Err == nil {
+						restarts = append(restarts, p.Restarts()...)
+						break
+					}
+				}
+			}
+		}
 	}
 
-	if err := c.DefaultsRaw.Execute(ctx, log); err != nil {
-		multiErr.Add(errors.WrapConfigError("macos", "execute", "defaultsRaw", nil, err))
+	restarts = defaults.CoalesceRestarts(restarts)
+	var restarted []defaults.Restart
+	if opts.NoRestart {
+		for _, restart := range restarts {
+			log.Info("Skipping restart, restart manually for changes to take effect", "process", restart.Process)
+		}
+	} else {
+		for _, restart := range restarts {
+			log.Debug("Restarting process to apply changes", "process", restart.Process)
+			if err := restart.Execute(ctx); err != nil {
+				multiErr.Add(errors.WrapConfigError("macos", "restart_process", restart.Process, nil, err))
+				if opts.Atomic {
+					return total, restarted, multiErr
+				}
+				continue
+			}
+			restarted = append(restarted, restart)
+		}
 	}
 
 	if err := multiErr.ToError(); err != nil {
-		return err
+		return total, restarted, err
 	}
 
-	log.Debug("macos configuration applied successfully")
-	return nil
+	log.Debug("macos configuration applied successfully", "changed", total.Changed, "unchanged", total.Unchanged)
+	return total, restarted, nil
+}
+
+// applySection applies the section's user scope commands and returns its
+// system scope commands for the escalation step.
+func applySection(ctx context.Context, log *logger.Logger, s Section) (defaults.Result, []defaults.Command, error) {
+	batch, err := s.Batch()
+	if err != nil {
+		return defaults.Result{}, nil, err
+	}
+	batch, privileged := batch.SplitPrivileged()
+	if batch.Len() == 0 {
+		return defaults.Result{}, privileged, nil
+	}
+
+	log.Debug("Applying defaults", "commands", batch.Len(), "privileged", len(privileged))
+	result, err := batch.Apply(ctx, log)
+	if err != nil {
+		return result, nil, err
+	}
+
+	log.Debug("Defaults applied", "changed", result.Changed, "unchanged", result.Unchanged)
+	return result, privileged, nil
 }
 
 func (c *FjrdConfig) Execute(ctx context.Context, log *logger.Logger) error {
+	_, err := c.Apply(ctx, log, ApplyOptions{})
+	return err
+}
+
+// Apply applies the configuration and reports how many keys were changed and
+// how many already had the desired value.
+func (c *FjrdConfig) Apply(ctx context.Context, log *logger.Logger, opts ApplyOptions) (defaults.Result, error) {
 	log = log.WithComponent("fjrd")
 	log.Debug("Executing fjrd configuration", "version", c.Version)
-	if err := c.Macos.Execute(ctx, log); err != nil {
-		return errors.WrapConfigError("fjrd", "execute", "macos", nil, err)
+	for _, skip := range c.skipped {
+		log.Info("Skipped", "item", skip.Item, "reason", skip.Reason)
 	}
-	return nil
+	result, err := c.Macos.Apply(ctx, log, opts)
+	if err != nil {
+		return result, errors.WrapConfigError("fjrd", "execute", "macos", nil, err)
+	}
+	return result, nil
+}
+
+// Domains returns every per-user preferences domain the configuration writes
+// to, in the order they are first used. ByHost and system domains are left
+// out.
+func (c *FjrdConfig) Domains() ([]string, error) {
+	seen := make(map[string]bool)
+	var domains []string
+	for _, s := range c.Macos.sections() {
+		batch, err := s.Batch()
+		if err != nil {
+			return nil, errors.WrapConfigError("macos", "batch", s.Key, nil, err)
+		}
+		for _, cmd := range batch.Commands() {
+			if cmd.Scope != defaults.UserScope || cmd.Host != defaults.AnyHost {
+				continue
+			}
+			if !seen[cmd.Domain] {
+				seen[cmd.Domain] = true
+				domains = append(domains, cmd.Domain)
+			}
+		}
+	}
+	return domains, nil
 }
 
 func (c *FjrdConfig) RequiresRawDefaultsApproval() bool {
-	return len(c.Macos.DefaultsRaw) > 0
+	return len(c.Macos.raw()) > 0
 }
 
 func (c *FjrdConfig) ListRawDefaults() []string {
+	entries, err := c.Macos.raw().Entries()
+	if err != nil {
+		return []string{fmt.Sprintf("invalid raw defaults: %v", err)}
+	}
+
 	var commands []string
-	for domainKey, entry := range c.Macos.DefaultsRaw {
+	for _, entry := range entries {
+		domainKey := entry.Domain + " " + entry.Key
+		if entry.Scope.Privileged() {
+			domainKey = defaults.SystemDomainPath(entry.Domain) + " " + entry.Key
+		}
 		var cmdStr string
 		if entry.ShouldReset() {
 			cmdStr = fmt.Sprintf("defaults delete %s", domainKey)
@@ -181,9 +485,34 @@ func (c *FjrdConfig) ListRawDefaults() []string {
 				}
 			case defaults.TypeFloat:
 				if v, ok := entry.GetFloatValue(); ok {
-					cmdStr = fmt.Sprintf("defaults write %s -float %f", domainKey, v)
+					cmdStr = fmt.Sprintf("defaults write %s -float %s", domainKey, strconv.FormatFloat(v, 'f', -1, 64))
+				}
+			case defaults.TypeArray:
+				if v, ok := entry.GetArrayValue(); ok {
+					cmdStr = fmt.Sprintf("defaults write %s '%s'", domainKey, v)
+				}
+			case defaults.TypeDict:
+				if v, ok := entry.GetDictValue(); ok {
+					cmdStr = fmt.Sprintf("defaults write %s '%s'", domainKey, v)
+				}
+			case defaults.TypeData:
+				if v, ok := entry.GetDataValue(); ok {
+					cmdStr = fmt.Sprintf("defaults write %s -data %x", domainKey, v)
+				}
+			case defaults.TypeDate:
+				if v, ok := entry.GetDateValue(); ok {
+					cmdStr = fmt.Sprintf("defaults write %s -date \"%s\"", domainKey, defaults.NewDateValue(v))
 				}
 			}
+			if entry.Strategy != "" && entry.Strategy != defaults.StrategyReplace {
+				cmdStr = fmt.Sprintf("%s (%s)", cmdStr, entry.Strategy)
+			}
+		}
+		if hostArgs := entry.Host.Args(); len(hostArgs) > 0 {
+			cmdStr = strings.Replace(cmdStr, "defaults ", "defaults "+strings.Join(hostArgs, " ")+" ", 1)
+		}
+		if entry.Scope.Privileged() {
+			cmdStr = "sudo " + cmdStr
 		}
 		commands = append(commands, cmdStr)
 	}
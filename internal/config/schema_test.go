@@ -0,0 +1,392 @@
+package config
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+	"github.com/RATIU5/fjrd/internal/logger"
+	"github.com/RATIU5/fjrd/internal/macos/defaults"
+)
+
+const testConfig = `
+version = 1
+
+[macos.dock]
+autohide = true
+orientation = "left"
+tilesize = 48
+
+[macos.finder]
+show-path-bar = true
+preferred-view-style = "column"
+
+[macos.mouse]
+speed = 1.5
+
+[macos.defaultsRaw]
+"com.apple.Music.userWantsPlaybackNotifications" = { value = false, type = "bool" }
+`
+
+func useMemoryBackend(t *testing.T) *defaults.MemoryBackend {
+	t.Helper()
+	mem := defaults.NewMemoryBackend()
+	previous := defaults.GetBackend()
+	defaults.SetBackend(mem)
+	t.Cleanup(func() { defaults.SetBackend(previous) })
+	return mem
+}
+
+func testLogger() *logger.Logger {
+	return logger.New(logger.LevelError, io.Discard)
+}
+
+func TestFjrdConfig_Execute_MemoryBackend(t *testing.T) {
+	mem := useMemoryBackend(t)
+	ctx := context.Background()
+
+	var cfg FjrdConfig
+	if err := parseConfig(testConfig, &cfg); err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+
+	if err := cfg.Execute(ctx, testLogger()); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	checks := []struct {
+		domain, key, want string
+	}{
+		{"com.apple.dock", "autohide", "true"},
+		{"com.apple.dock", "orientation", "left"},
+		{"com.apple.dock", "tilesize", "48"},
+		{"com.apple.finder", "ShowPathbar", "true"},
+		{"com.apple.finder", "FXPreferredViewStyle", "clmv"},
+		{"NSGlobalDomain", "com.apple.mouse.scaling", "1.5"},
+		{"com.apple.Music", "userWantsPlaybackNotifications", "false"},
+	}
+	for _, c := range checks {
+		got, err := mem.Read(ctx, c.domain, c.key)
+		if err != nil {
+			t.Errorf("Read(%s, %s) error = %v", c.domain, c.key, err)
+			continue
+		}
+		if got.String() != c.want {
+			t.Errorf("Read(%s, %s) = %s, want %s", c.domain, c.key, got, c.want)
+		}
+	}
+
+	if len(mem.Restarted()) == 0 {
+		t.Error("Execute() should restart affected processes")
+	}
+}
+
+func TestFjrdConfig_Plan(t *testing.T) {
+	mem := useMemoryBackend(t)
+	ctx := context.Background()
+
+	mem.Write(ctx, "com.apple.dock", "autohide", defaults.NewBoolValue(true))
+	mem.Write(ctx, "com.apple.dock", "orientation", defaults.NewStringValue("bottom"))
+	mem.Write(ctx, "com.apple.dock", "workspaces-auto-swoosh", &defaults.IntValue{Value: 1})
+
+	config := testConfig + `"com.apple.dock.workspaces-auto-swoosh" = { value = "default", type = "int" }
+`
+	var cfg FjrdConfig
+	if err := parseConfig(config, &cfg); err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+
+	plan, err := cfg.Plan(ctx, testLogger())
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+
+	kinds := make(map[string]defaults.ChangeKind)
+	for _, section := range plan.Sections {
+		for _, change := range section.Changes {
+			kinds[change.Command.Domain+" "+change.Command.Key] = change.Kind
+		}
+	}
+
+	want := map[string]defaults.ChangeKind{
+		"com.apple.dock autohide":               defaults.ChangeNone,
+		"com.apple.dock orientation":            defaults.ChangeWrite,
+		"com.apple.dock tilesize":               defaults.ChangeWrite,
+		"com.apple.dock workspaces-auto-swoosh": defaults.ChangeDelete,
+	}
+	for key, kind := range want {
+		if kinds[key] != kind {
+			t.Errorf("plan for %s = %v, want %v", key, kinds[key], kind)
+		}
+	}
+
+	if len(mem.Restarted()) != 0 {
+		t.Errorf("Plan() restarted processes: %v", mem.Restarted())
+	}
+	if v, _ := mem.Read(ctx, "com.apple.dock", "orientation"); v.String() != "bottom" {
+		t.Errorf("Plan() wrote orientation = %s", v)
+	}
+
+	var out strings.Builder
+	if err := plan.Render(&out); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	for _, line := range []string{
+		"~ com.apple.dock orientation: bottom → left",
+		"= com.apple.dock autohide: true",
+		"- com.apple.dock workspaces-auto-swoosh",
+		"  Dock\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Render() output missing %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestFjrdConfig_Apply_Idempotent(t *testing.T) {
+	mem := useMemoryBackend(t)
+	ctx := context.Background()
+
+	var cfg FjrdConfig
+	if err := parseConfig(testConfig, &cfg); err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+
+	first, err := cfg.Apply(ctx, testLogger(), ApplyOptions{})
+	if err != nil {
+		t.Fatalf("first Apply() error = %v", err)
+	}
+	if first.Changed != 7 || first.Unchanged != 0 {
+		t.Errorf("first Apply() = %s, want 7 changed, 0 unchanged", first)
+	}
+	restarted := len(mem.Restarted())
+
+	second, err := cfg.Apply(ctx, testLogger(), ApplyOptions{})
+	if err != nil {
+		t.Fatalf("second Apply() error = %v", err)
+	}
+	if second.Changed != 0 || second.Unchanged != 7 {
+		t.Errorf("second Apply() = %s, want 0 changed, 7 unchanged", second)
+	}
+	if got := mem.Restarted(); len(got) != restarted {
+		t.Errorf("second Apply() restarted %v", got[restarted:])
+	}
+
+	mem.Write(ctx, "com.apple.finder", "ShowPathbar", defaults.NewBoolValue(false))
+	third, err := cfg.Apply(ctx, testLogger(), ApplyOptions{})
+	if err != nil {
+		t.Fatalf("third Apply() error = %v", err)
+	}
+	if third.Changed != 1 {
+		t.Errorf("third Apply() = %s, want 1 changed", third)
+	}
+	if got := mem.Restarted(); len(got) != restarted+1 || got[restarted] != "Finder" {
+		t.Errorf("third Apply() restarted %v, want [Finder]", got[restarted:])
+	}
+}
+
+func TestFjrdConfig_Apply_CoalescesRestarts(t *testing.T) {
+	config := testConfig + `
+[macos.desktop]
+show-icons = false
+
+[macos.mission-control]
+group-windows-by-app = true
+
+[macos.safari]
+show-full-url = true
+`
+
+	tests := []struct {
+		name string
+		opts ApplyOptions
+		want []string
+	}{
+		{name: "restart", opts: ApplyOptions{}, want: []string{"Dock", "Finder", "SystemUIServer", "Safari"}},
+		{name: "no restart", opts: ApplyOptions{NoRestart: true}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := useMemoryBackend(t)
+			mem.SetProcessRunning("Safari", true)
+
+			var cfg FjrdConfig
+			if err := parseConfig(config, &cfg); err != nil {
+				t.Fatalf("parseConfig() error = %v", err)
+			}
+			if _, err := cfg.Apply(context.Background(), testLogger(), tt.opts); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			if got := mem.Restarted(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Restarted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// failingBackend fails every write to one key.
+type failingBackend struct {
+	*defaults.MemoryBackend
+	domain, key string
+}
+
+func (f *failingBackend) Write(ctx context.Context, domain, key string, value defaults.Value) error {
+	if domain == f.domain && key == f.key {
+		return errors.New("write failed")
+	}
+	return f.MemoryBackend.Write(ctx, domain, key, value)
+}
+
+func TestFjrdConfig_Apply_AtomicRollback(t *testing.T) {
+	mem := useMemoryBackend(t)
+	ctx := context.Background()
+	mem.Write(ctx, "com.apple.dock", "autohide", defaults.NewBoolValue(false))
+	defaults.SetBackend(&failingBackend{MemoryBackend: mem, domain: "com.apple.finder", key: "FXPreferredViewStyle"})
+
+	var cfg FjrdConfig
+	if err := parseConfig(testConfig, &cfg); err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+
+	if _, err := cfg.Apply(ctx, testLogger(), ApplyOptions{Atomic: true}); err == nil {
+		t.Fatal("Apply() should fail")
+	}
+
+	if got, err := mem.Read(ctx, "com.apple.dock", "autohide"); err != nil || got.String() != "false" {
+		t.Errorf("autohide after rollback = %v, %v, want false", got, err)
+	}
+	for _, key := range []string{"orientation", "tilesize"} {
+		if _, err := mem.Read(ctx, "com.apple.dock", key); !errors.Is(err, defaults.ErrKeyNotFound) {
+			t.Errorf("%s should be deleted by rollback, got error %v", key, err)
+		}
+	}
+	if _, err := mem.Read(ctx, "com.apple.finder", "ShowPathbar"); !errors.Is(err, defaults.ErrKeyNotFound) {
+		t.Errorf("ShowPathbar should be deleted by rollback, got error %v", err)
+	}
+	if got := mem.Restarted(); len(got) != 0 {
+		t.Errorf("Restarted() = %v, want none", got)
+	}
+}
+
+func TestFjrdConfig_Apply_PrivilegedSingleEscalation(t *testing.T) {
+	mem := useMemoryBackend(t)
+	ctx := context.Background()
+
+	const privilegedConfig = `
+version = 1
+
+[macos.dock]
+autohide = true
+
+[[macos.defaultsRaw.entries]]
+domain = "com.apple.loginwindow"
+key = "GuestEnabled"
+type = "bool"
+value = false
+scope = "system"
+
+[[macos.defaultsRaw.entries]]
+domain = "com.apple.alf"
+key = "globalstate"
+type = "int"
+value = 1
+scope = "system"
+`
+	var cfg FjrdConfig
+	if err := parseConfig(privilegedConfig, &cfg); err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+
+	plan, err := cfg.Plan(ctx, testLogger())
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	want := []string{
+		"sudo '/usr/bin/defaults' 'write' '/Library/Preferences/com.apple.loginwindow' 'GuestEnabled' '-bool' 'false'",
+		"sudo '/usr/bin/defaults' 'write' '/Library/Preferences/com.apple.alf' 'globalstate' '-int' '1'",
+	}
+	if got, err := plan.Privileged(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Plan.Privileged() = %q, want %q", got, want)
+	}
+
+	result, err := cfg.Apply(ctx, testLogger(), ApplyOptions{})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if result.Changed != 3 {
+		t.Errorf("Apply() changed = %d, want 3", result.Changed)
+	}
+	if mem.Escalations() != 1 {
+		t.Errorf("Apply() escalated %d times, want 1", mem.Escalations())
+	}
+	if _, err := mem.Read(ctx, "com.apple.alf", "globalstate"); !errors.Is(err, defaults.ErrKeyNotFound) {
+		t.Errorf("system key written to the user domain: %v", err)
+	}
+
+	if _, err := cfg.Apply(ctx, testLogger(), ApplyOptions{}); err != nil {
+		t.Fatalf("second Apply() error = %v", err)
+	}
+	if mem.Escalations() != 1 {
+		t.Errorf("second Apply() escalated again, %d escalations", mem.Escalations())
+	}
+}
+
+func TestFjrdConfig_Apply_TypeMismatch(t *testing.T) {
+	mem := useMemoryBackend(t)
+	ctx := context.Background()
+
+	const typedConfig = `
+version = 1
+
+[macos.dock]
+autohide = true
+autohide-delay = 0.5
+`
+	var cfg FjrdConfig
+	if err := parseConfig(typedConfig, &cfg); err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+
+	// autohide is stored with the wrong type, autohide-delay as an int the
+	// Dock section declares it can convert.
+	mem.Write(ctx, "com.apple.dock", "autohide", &defaults.IntValue{Value: 1})
+	mem.Write(ctx, "com.apple.dock", "autohide-delay", &defaults.IntValue{Value: 0})
+
+	plan, err := cfg.Plan(ctx, testLogger())
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	var out strings.Builder
+	if err := plan.Render(&out); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	for _, line := range []string{
+		"~ com.apple.dock autohide: 1 → true (type int → bool)",
+		"~ com.apple.dock autohide-delay: 0 → 0.5 (type int → float)",
+		"Warning: 1 keys change type",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Render() output missing %q:\n%s", line, out.String())
+		}
+	}
+
+	_, err = cfg.Apply(ctx, testLogger(), ApplyOptions{Strict: true})
+	if !errors.Is(err, defaults.ErrTypeMismatch) {
+		t.Fatalf("strict Apply() error = %v, want ErrTypeMismatch", err)
+	}
+	if got, _ := mem.Read(ctx, "com.apple.dock", "autohide-delay"); got.Type() != defaults.IntType {
+		t.Errorf("strict Apply() wrote autohide-delay = %s", got)
+	}
+
+	if _, err := cfg.Apply(ctx, testLogger(), ApplyOptions{}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got, _ := mem.Read(ctx, "com.apple.dock", "autohide"); got.Type() != defaults.BoolType {
+		t.Errorf("Apply() left autohide as %s", got.Type())
+	}
+}
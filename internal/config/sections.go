@@ -0,0 +1,80 @@
+package config
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+
+	"github.com/RATIU5/fjrd/internal/macos/defaults"
+	"github.com/RATIU5/fjrd/internal/macos/section"
+	goToml "github.com/pelletier/go-toml/v2"
+
+	// The built-in sections register themselves.
+	_ "github.com/RATIU5/fjrd/internal/macos/desktop"
+	_ "github.com/RATIU5/fjrd/internal/macos/dock"
+	_ "github.com/RATIU5/fjrd/internal/macos/finder"
+	_ "github.com/RATIU5/fjrd/internal/macos/keyboard"
+	_ "github.com/RATIU5/fjrd/internal/macos/menubar"
+	_ "github.com/RATIU5/fjrd/internal/macos/missionControl"
+	_ "github.com/RATIU5/fjrd/internal/macos/mouse"
+	_ "github.com/RATIU5/fjrd/internal/macos/safari"
+	_ "github.com/RATIU5/fjrd/internal/macos/screenshots"
+	_ "github.com/RATIU5/fjrd/internal/macos/trackpad"
+)
+
+// rawKey is the section holding raw defaults.
+const rawKey = "defaultsRaw"
+
+func init() {
+	// Raw defaults are written last, so that they override what any
+	// section writes to the same key.
+	section.Register(section.Registration{
+		Key:         rawKey,
+		Name:        "Raw Defaults",
+		Description: "Any preference, written with defaults as given",
+		New:         func() any { return &defaults.Raw{} },
+		After:       []string{section.Everything},
+	})
+}
+
+// decodeConfig decodes content into cfg, with the macos tables of the
+// configuration and its profiles decoded into the registered sections.
+func decodeConfig(content []byte, cfg *FjrdConfig) error {
+	if err := goToml.Unmarshal(content, cfg); err != nil {
+		return err
+	}
+
+	var tables struct {
+		Macos    map[string]any `toml:"macos"`
+		Profiles map[string]struct {
+			Macos map[string]any `toml:"macos"`
+		} `toml:"profiles"`
+	}
+	if err := goToml.Unmarshal(content, &tables); err != nil {
+		return err
+	}
+	if err := cfg.Macos.decode(tables.Macos); err != nil {
+		return err
+	}
+	if len(tables.Profiles) > 0 && cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]Profile, len(tables.Profiles))
+	}
+	for _, name := range slices.Sorted(maps.Keys(tables.Profiles)) {
+		profile := cfg.Profiles[name]
+		if err := profile.Macos.decode(tables.Profiles[name].Macos); err != nil {
+			return err
+		}
+		cfg.Profiles[name] = profile
+	}
+	return nil
+}
+
+// sectionTypes maps the keys of the registered sections to the types their
+// tables are decoded into.
+func sectionTypes() map[string]reflect.Type {
+	types := make(map[string]reflect.Type)
+	for _, r := range section.All() {
+		types[r.Key] = reflect.TypeOf(r.New())
+	}
+	return types
+}
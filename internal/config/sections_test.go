@@ -0,0 +1,200 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/RATIU5/fjrd/internal/macos/mouse"
+	"github.com/RATIU5/fjrd/internal/macos/section"
+)
+
+// exampleSection stands in for a section added outside this package.
+type exampleSection struct {
+	Enabled *bool  `toml:"enabled,omitempty" doc:"Enable the example" defaults:"domain=com.example.app,key=Enabled,restart=Example"`
+	Level   *int64 `toml:"level,omitempty" range:"1,5" doc:"Example level" defaults:"domain=com.example.app,key=Level,restart=Example"`
+}
+
+var registerExample sync.Once
+
+func useExampleSection() {
+	registerExample.Do(func() {
+		section.Register(section.Registration{
+			Key:         "example",
+			Name:        "Example",
+			Description: "An example section",
+			New:         func() any { return &exampleSection{} },
+			After:       []string{"dock"},
+		})
+	})
+}
+
+func TestRegisteredSection(t *testing.T) {
+	useExampleSection()
+	mem := useMemoryBackend(t)
+	ctx := context.Background()
+
+	var order []string
+	for _, r := range section.All() {
+		order = append(order, r.Key)
+	}
+	if i := slices.Index(order, "example"); i < slices.Index(order, "dock") || order[len(order)-1] != rawKey {
+		t.Errorf("section order = %v, want example after dock and %s last", order, rawKey)
+	}
+
+	dir := writeConfigs(t, map[string]string{
+		"config.toml":  "version = 2\n\n[macos.example]\nenabled = true\n",
+		"invalid.toml": "version = 2\n\n[macos.example]\nlevel = 9\n",
+		"unknown.toml": "version = 2\n\n[macos.example]\nenable = true\n",
+	})
+	cfg, err := LoadConfig(ctx, filepath.Join(dir, "config.toml"), testLogger(), LoadOptions{Facts: StaticFacts{}})
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if e := cfg.Macos.Section("example").(*exampleSection); e.Enabled == nil || !*e.Enabled {
+		t.Errorf("example = %+v, want enabled", e)
+	}
+	if s := cfg.Macos.Section("missing"); s != nil {
+		t.Errorf("Section() of an unregistered key = %v, want nil", s)
+	}
+
+	if err := cfg.Execute(ctx, testLogger()); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if got, err := mem.Read(ctx, "com.example.app", "Enabled"); err != nil || got.String() != "true" {
+		t.Errorf("Read(com.example.app, Enabled) = %v, %v, want true", got, err)
+	}
+	if restarted := mem.Restarted(); !slices.Contains(restarted, "Example") {
+		t.Errorf("Restarted() = %v, want Example", restarted)
+	}
+
+	for _, name := range []string{"invalid.toml", "unknown.toml"} {
+		if _, err := LoadConfig(ctx, filepath.Join(dir, name), testLogger(), LoadOptions{Facts: StaticFacts{}}); err == nil {
+			t.Errorf("LoadConfig(%s) succeeded, want an error", name)
+		}
+	}
+
+	b, err := JSONSchema()
+	if err != nil {
+		t.Fatalf("JSONSchema() error = %v", err)
+	}
+	var schema struct {
+		Properties struct {
+			Macos struct {
+				Properties map[string]struct {
+					Title      string         `json:"title"`
+					Properties map[string]any `json:"properties"`
+				} `json:"properties"`
+			} `json:"macos"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatal(err)
+	}
+	example := schema.Properties.Macos.Properties["example"]
+	if example.Title != "Example" || example.Properties["level"] == nil || example.Properties[whenKey] == nil {
+		t.Errorf("schema of example = %+v, want its fields and when", example)
+	}
+}
+
+func TestSectionOrder(t *testing.T) {
+	want := []string{"dock", "finder", "desktop", "safari", "screenshots", "menubar", "mouse", "trackpad", "keyboard", "mission-control", rawKey}
+	var order []string
+	for _, r := range section.All() {
+		if slices.Contains(want, r.Key) {
+			order = append(order, r.Key)
+		}
+	}
+	if !slices.Equal(order, want) {
+		t.Errorf("section order = %v, want %v", order, want)
+	}
+}
+
+func TestSectionFields(t *testing.T) {
+	r, ok := section.Lookup("dock")
+	if !ok {
+		t.Fatal("dock is not registered")
+	}
+	fields := make(map[string]section.Field)
+	for _, field := range r.Fields() {
+		fields[field.Key] = field
+	}
+	orientation := fields["orientation"]
+	if !slices.Equal(orientation.Enum, []string{"left", "bottom", "right"}) {
+		t.Errorf("orientation enum = %v, want left, bottom, right", orientation.Enum)
+	}
+	if orientation.Description == "" {
+		t.Error("orientation has no description")
+	}
+	if m := fields["autohide-time"].Mapping; m == nil || m.Domain != "com.apple.dock" || m.Key != "autohide-time-modifier" || !m.Native {
+		t.Errorf("autohide-time mapping = %+v, want native com.apple.dock autohide-time-modifier", m)
+	}
+
+	raw, _ := section.Lookup(rawKey)
+	if fields := raw.Fields(); fields != nil {
+		t.Errorf("Fields() of %s = %v, want nil", rawKey, fields)
+	}
+}
+
+func TestSectionBatch(t *testing.T) {
+	r, ok := section.Lookup("mouse")
+	if !ok {
+		t.Fatal("mouse is not registered")
+	}
+	acceleration, speed := true, 1.5
+	s := section.Section{Registration: r, Config: &mouse.Config{Acceleration: &acceleration, Speed: &speed}}
+	batch, err := s.Batch()
+	if err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+
+	var got []string
+	for _, cmd := range batch.Commands() {
+		got = append(got, cmd.Name()+" = "+cmd.Value.String())
+	}
+	// Acceleration on is a non-linear mouse.
+	want := []string{"NSGlobalDomain com.apple.mouse.linear = false", "NSGlobalDomain com.apple.mouse.scaling = 1.5"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Batch() = %v, want %v", got, want)
+	}
+	if fields := s.Fields(); fields["acceleration"] != true {
+		t.Errorf("Fields() = %v, want acceleration true", fields)
+	}
+
+	speed = 9
+	if err := s.Validate(); err == nil {
+		t.Error("Validate() accepted speed 9")
+	}
+}
+
+// TestRestartsForKey checks that undoing a key restarts what applying it
+// restarts, including keys of shared domains and keys a section writes
+// itself.
+func TestRestartsForKey(t *testing.T) {
+	tests := []struct {
+		domain, key string
+		want        []string
+	}{
+		{"NSGlobalDomain", "AppleShowAllExtensions", []string{"Finder"}},
+		{"com.apple.universalaccess", "showWindowTitlebarIcons", []string{"Finder"}},
+		{"NSGlobalDomain", "com.apple.mouse.scaling", nil},
+		{"com.apple.screencapture", "location", []string{"SystemUIServer"}},
+		{"com.apple.dock", "tilesize", []string{"Dock"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, restart := range section.RestartsForKey(tt.domain, tt.key) {
+			got = append(got, restart.Process)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("RestartsForKey(%s, %s) = %v, want %v", tt.domain, tt.key, got, tt.want)
+		}
+	}
+
+	if got := section.RestartsForDomains([]string{"com.apple.Safari"}); len(got) != 1 || got[0].Process != "Safari" || !got[0].OnlyIfRunning {
+		t.Errorf("RestartsForDomains(com.apple.Safari) = %v, want Safari if running", got)
+	}
+}
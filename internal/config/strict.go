@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+// UnknownKey is a key in a configuration file that the schema does not
+// define, most likely a misspelling.
+type UnknownKey struct {
+	Source string
+	Line   int
+	Column int
+	// Key is the dotted path of the key, as written in the file.
+	Key string
+	// Suggestion is the closest known key, or "" if none is close.
+	Suggestion string
+}
+
+// Location returns the file, line and column of the key, e.g.
+// config.toml:12:1.
+func (u UnknownKey) Location() string {
+	return fmt.Sprintf("%s:%d:%d", u.Source, u.Line, u.Column)
+}
+
+func (u UnknownKey) Error() string {
+	msg := fmt.Sprintf("%s: unknown key %s", u.Location(), u.Key)
+	if u.Suggestion != "" {
+		msg += fmt.Sprintf(", did you mean %s?", u.Suggestion)
+	}
+	return msg
+}
+
+// unknownKeysError combines the unknown keys of a document into the error a
+// strict load fails with.
+func unknownKeysError(unknown []UnknownKey) error {
+	multiErr := errors.NewMultiError()
+	for _, u := range unknown {
+		multiErr.Add(u)
+	}
+	return fmt.Errorf("%w (use -lenient to ignore unknown keys)", multiErr)
+}
+
+var configType = reflect.TypeOf(FjrdConfig{})
+
+// unknownKeys returns the keys in content that no field of FjrdConfig
+// decodes. Keys that version renamed are looked up under their new names,
+// and raw defaults are left to their own validation.
+func unknownKeys(source string, content []byte, version Version) ([]UnknownKey, error) {
+	var unknown []UnknownKey
+	check := func(prefix []string, keys []keyPart) {
+		path := appendKeys(prefix, keys)
+		i, suggestion := lookupKey(upgradePath(path, version))
+		// A part of the prefix is reported where its table is declared.
+		if i == len(path) || i < len(prefix) {
+			return
+		}
+		line, column := position(content, int(keys[i-len(prefix)].raw.Offset))
+		u := UnknownKey{Source: source, Line: line, Column: column, Key: dottedKey(path[:i+1])}
+		if suggestion != "" {
+			u.Suggestion = dottedKey(append(slices.Clone(path[:i]), suggestion))
+		}
+		unknown = append(unknown, u)
+	}
+
+	err := walkKeys(content, func(prefix []string, keys []keyPart, _ *unstable.Node) {
+		check(prefix, keys)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", source, err)
+	}
+	return unknown, nil
+}
+
+// lookupKey follows path through FjrdConfig. It returns the index of the
+// first part no field matches, with the closest field name, or len(path) if
+// every part is known.
+func lookupKey(path []string) (int, string) {
+	typ := configType
+	for i, part := range path {
+		for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice {
+			typ = typ.Elem()
+		}
+
+		switch typ.Kind() {
+		case reflect.Struct:
+			fields := tomlFields(typ)
+			if typ == macosType {
+				fields = sectionTypes()
+			}
+			if rel, ok := macosRelative(path[:i]); ok && len(rel) == 1 {
+				// Every section can be made conditional.
+				fields[whenKey] = reflect.TypeOf("")
+			}
+			field, ok := fields[part]
+			if !ok {
+				return i, closestKey(part, fields)
+			}
+			typ = field
+		case reflect.Map:
+			if typ.Elem().Kind() == reflect.Interface {
+				// Raw defaults and other free-form tables.
+				return len(path), ""
+			}
+			typ = typ.Elem()
+		default:
+			// A value, which decoding checks the type of.
+			return len(path), ""
+		}
+	}
+	return len(path), ""
+}
+
+// tomlFields maps the TOML names of a struct's fields to their types.
+func tomlFields(typ reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// closestKey returns the known key with the smallest edit distance to key,
+// if it is close enough to be a likely misspelling.
+func closestKey(key string, fields map[string]reflect.Type) string {
+	best, bestDistance := "", max(2, len(key)/3)+1
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		if d := editDistance(key, name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RATIU5/fjrd/internal/logger"
+	"github.com/RATIU5/fjrd/internal/macos/mouse"
+)
+
+func TestLoadConfig_UnknownKeys(t *testing.T) {
+	const base = `version = 2
+
+[macos.menubr]
+clock-date-format = "HH:mm"
+`
+	const config = `version = 2
+include = ["base.toml"]
+
+[vars]
+anything = "goes"
+
+[macos.mouse]
+when = "arch == 'arm64'"
+speed = 1.5
+accelerate = false
+
+[macos.dock]
+tilesize = 48
+hide = { delay = 1 }
+
+[macos.defaultsRaw."com.example.app.key"]
+type = "bool"
+value = true
+
+[profiles.laptop]
+match = { hostname = "*-mbp", os = "14" }
+`
+	dir := writeConfigs(t, map[string]string{"config.toml": config, "base.toml": base})
+	location := filepath.Join(dir, "config.toml")
+
+	_, err := LoadConfig(context.Background(), location, testLogger(), LoadOptions{Facts: StaticFacts{}})
+	if err == nil {
+		t.Fatal("LoadConfig() accepted unknown keys")
+	}
+	for _, want := range []string{
+		filepath.Join(dir, "base.toml") + ":3:8: unknown key macos.menubr, did you mean macos.menubar?",
+		location + ":10:1: unknown key macos.mouse.accelerate, did you mean macos.mouse.acceleration?",
+		location + ":14:1: unknown key macos.dock.hide;",
+		location + ":21:31: unknown key profiles.laptop.match.os;",
+		"use -lenient",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadConfig() error = %v, want it to contain %q", err, want)
+		}
+	}
+
+	var logs bytes.Buffer
+	cfg, err := LoadConfig(context.Background(), location, logger.New(logger.LevelWarn, &logs), LoadOptions{Facts: StaticFacts{Arch: "arm64"}, Lenient: true})
+	if err != nil {
+		t.Fatalf("LoadConfig() with Lenient error = %v", err)
+	}
+	if m := cfg.Macos.Section("mouse").(*mouse.Config); m.Speed == nil || *m.Speed != 1.5 {
+		t.Errorf("mouse = %+v, want speed 1.5", m)
+	}
+	if got := strings.Count(logs.String(), "Ignoring unknown key"); got != 4 {
+		t.Errorf("logged %d unknown keys, want 4:\n%s", got, logs.String())
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"dock", "dock", 0},
+		{"accelerate", "acceleration", 3},
+		{"meubar", "menubar", 1},
+		{"", "abc", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"bytes"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+type keyPart struct {
+	name string
+	raw  unstable.Range
+}
+
+// walkKeys calls visit with the keys of every table header and key/value
+// pair in content, including the pairs of inline tables. prefix is the path
+// of the table the keys are relative to. node is the header or the pair.
+func walkKeys(content []byte, visit func(prefix []string, keys []keyPart, node *unstable.Node)) error {
+	var inline func(prefix []string, node *unstable.Node)
+	inline = func(prefix []string, node *unstable.Node) {
+		it := node.Children()
+		for it.Next() {
+			kv := it.Node()
+			keys := nodeKeys(kv)
+			visit(prefix, keys, kv)
+			if value := kv.Value(); value.Kind == unstable.InlineTable {
+				inline(appendKeys(prefix, keys), value)
+			}
+		}
+	}
+
+	p := unstable.Parser{}
+	p.Reset(content)
+	var table []string
+	for p.NextExpression() {
+		expr := p.Expression()
+		switch expr.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			keys := nodeKeys(expr)
+			visit(nil, keys, expr)
+			table = appendKeys(nil, keys)
+		case unstable.KeyValue:
+			keys := nodeKeys(expr)
+			visit(table, keys, expr)
+			if value := expr.Value(); value.Kind == unstable.InlineTable {
+				inline(appendKeys(table, keys), value)
+			}
+		}
+	}
+	return p.Error()
+}
+
+func nodeKeys(node *unstable.Node) []keyPart {
+	var keys []keyPart
+	it := node.Key()
+	for it.Next() {
+		key := it.Node()
+		keys = append(keys, keyPart{name: string(key.Data), raw: key.Raw})
+	}
+	return keys
+}
+
+func appendKeys(prefix []string, keys []keyPart) []string {
+	path := slices.Clone(prefix)
+	for _, key := range keys {
+		path = append(path, key.name)
+	}
+	return path
+}
+
+// keyPosition is where a key is written in a configuration file.
+type keyPosition struct {
+	source       string
+	line, column int
+}
+
+// keyPositions maps the dotted path of every key in content, in the current
+// schema, to where it is written. Tables of an array are told apart by
+// index, e.g. macos.defaultsRaw.entries[1].domain.
+func keyPositions(source string, content []byte, version Version) (map[string]keyPosition, error) {
+	positions := make(map[string]keyPosition)
+	// counts holds the number of tables in each array of tables so far.
+	counts := make(map[string]int)
+	// table is the dotted path of the current table header, with the
+	// indexes of arrays, and depth the number of keys in it.
+	table, depth := "", 0
+	err := walkKeys(content, func(prefix []string, keys []keyPart, node *unstable.Node) {
+		path := upgradePath(appendKeys(prefix, keys), version)
+		key, start := table, depth
+		if node.Kind != unstable.KeyValue {
+			key, start = "", 0
+		}
+		for i := start; i < len(path); i++ {
+			key = joinKey(key, path[i])
+			last := i == len(path)-1
+			if i >= len(prefix) {
+				if _, ok := positions[key]; !ok || last {
+					line, column := position(content, int(keys[i-len(prefix)].raw.Offset))
+					positions[key] = keyPosition{source: source, line: line, column: column}
+				}
+			}
+			if node.Kind == unstable.KeyValue {
+				continue
+			}
+			// A header continues the last table of an array, or starts a
+			// new one.
+			switch n := counts[key]; {
+			case last && node.Kind == unstable.ArrayTable:
+				counts[key]++
+				positions[key+"["+strconv.Itoa(n)+"]"] = positions[key]
+				key += "[" + strconv.Itoa(n) + "]"
+			case n > 0:
+				key += "[" + strconv.Itoa(n-1) + "]"
+			}
+		}
+		if node.Kind != unstable.KeyValue {
+			table, depth = key, len(path)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
+// parentKey returns the dotted path of the table or array that contains
+// key, or "" for a top-level key.
+func parentKey(key string) string {
+	if strings.HasSuffix(key, "]") {
+		return key[:strings.LastIndexByte(key, '[')]
+	}
+	quoted, last := false, -1
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case '.':
+			if !quoted {
+				last = i
+			}
+		}
+	}
+	if last < 0 {
+		return ""
+	}
+	return key[:last]
+}
+
+// position converts a byte offset into a 1-based line and column.
+func position(content []byte, offset int) (int, int) {
+	before := content[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	start := bytes.LastIndexByte(before, '\n') + 1
+	return line, utf8.RuneCount(before[start:]) + 1
+}
@@ -6,11 +6,14 @@ type Version int
 
 const (
 	Version1 Version = 1
+	// Version2 renames macos.meubar to macos.menubar and
+	// macos.mouse.accelerate to macos.mouse.acceleration.
+	Version2 Version = 2
 )
 
 func (v Version) Validate() error {
 	switch v {
-	case Version1:
+	case Version1, Version2:
 		return nil
 	default:
 		return fmt.Errorf("%d is an invalid version", v)
@@ -26,9 +29,9 @@ func (v Version) String() string {
 }
 
 func Current() Version {
-	return Version1
+	return Version2
 }
 
 func SupportedVersions() []Version {
-	return []Version{Version1}
+	return []Version{Version1, Version2}
 }
\ No newline at end of file
@@ -0,0 +1,450 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+)
+
+// whenKey holds the condition a section or raw entry is applied under.
+const whenKey = "when"
+
+// Skip records a section or raw entry left out because its when expression
+// was false on this machine.
+type Skip struct {
+	// Item names what was skipped, e.g. trackpad or
+	// defaultsRaw."com.apple.dock.autohide".
+	Item string
+	// Reason is the expression and the facts it was evaluated against.
+	Reason string
+}
+
+func (s Skip) String() string {
+	return s.Item + ": " + s.Reason
+}
+
+// whenExpr is a parsed when expression such as
+// "os >= 14 && arch == 'arm64'".
+type whenExpr interface {
+	eval(facts Facts) bool
+	// facts appends the names of the facts the expression reads.
+	facts(names []string) []string
+}
+
+type whenNot struct{ x whenExpr }
+
+func (e whenNot) eval(facts Facts) bool         { return !e.x.eval(facts) }
+func (e whenNot) facts(names []string) []string { return e.x.facts(names) }
+
+type whenAnd struct{ x, y whenExpr }
+
+func (e whenAnd) eval(facts Facts) bool         { return e.x.eval(facts) && e.y.eval(facts) }
+func (e whenAnd) facts(names []string) []string { return e.y.facts(e.x.facts(names)) }
+
+type whenOr struct{ x, y whenExpr }
+
+func (e whenOr) eval(facts Facts) bool         { return e.x.eval(facts) || e.y.eval(facts) }
+func (e whenOr) facts(names []string) []string { return e.y.facts(e.x.facts(names)) }
+
+// whenCompare compares a fact with a literal. os is compared as a version;
+// hostname and user are matched as globs.
+type whenCompare struct {
+	fact    string
+	op      string
+	value   string
+	version []int
+}
+
+func (e whenCompare) eval(facts Facts) bool {
+	var ok bool
+	switch e.fact {
+	case "os":
+		version, err := parseVersion(facts.MacOSVersion)
+		if err != nil {
+			return false
+		}
+		switch cmp := compareVersions(version, e.version); e.op {
+		case "==":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">=":
+			ok = cmp >= 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case "<":
+			ok = cmp < 0
+		}
+		return ok
+	case "arch":
+		ok = archAliases[e.value] == facts.Arch
+	case "hostname":
+		ok, _ = path.Match(e.value, facts.Hostname)
+	case "user":
+		ok, _ = path.Match(e.value, facts.Username)
+	}
+	if e.op == "!=" {
+		return !ok
+	}
+	return ok
+}
+
+func (e whenCompare) facts(names []string) []string {
+	if slices.Contains(names, e.fact) {
+		return names
+	}
+	return append(names, e.fact)
+}
+
+// factValue returns the fact a when expression refers to as name.
+func factValue(facts Facts, name string) string {
+	switch name {
+	case "os":
+		return facts.MacOSVersion
+	case "arch":
+		return facts.Arch
+	case "hostname":
+		return facts.Hostname
+	case "user":
+		return facts.Username
+	}
+	return ""
+}
+
+// parseWhen parses a when expression. Comparisons of a fact (os, arch,
+// hostname or user) with a literal are combined with &&, ||, ! and
+// parentheses.
+func parseWhen(s string) (whenExpr, error) {
+	tokens, err := tokenizeWhen(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &whenParser{tokens: tokens}
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return expr, nil
+}
+
+type whenToken struct {
+	text string
+	// literal is set for quoted strings, whose text is unquoted.
+	literal bool
+}
+
+var whenOperators = []string{"&&", "||", "==", "!=", ">=", "<=", ">", "<", "!", "(", ")"}
+
+func tokenizeWhen(s string) ([]whenToken, error) {
+	var tokens []whenToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string in %q", s)
+			}
+			tokens = append(tokens, whenToken{text: s[i+1 : i+1+end], literal: true})
+			i += end + 2
+		case isWhenWordByte(c):
+			j := i
+			for j < len(s) && isWhenWordByte(s[j]) {
+				j++
+			}
+			tokens = append(tokens, whenToken{text: s[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range whenOperators {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q in %q", c, s)
+			}
+			tokens = append(tokens, whenToken{text: op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+func isWhenWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-'
+}
+
+type whenParser struct {
+	tokens []whenToken
+	pos    int
+}
+
+func (p *whenParser) peek() string {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].literal {
+		return p.tokens[p.pos].text
+	}
+	return ""
+}
+
+func (p *whenParser) next() (whenToken, error) {
+	if p.pos >= len(p.tokens) {
+		return whenToken{}, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *whenParser) or() (whenExpr, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.pos++
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = whenOr{x, y}
+	}
+	return x, nil
+}
+
+func (p *whenParser) and() (whenExpr, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.pos++
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = whenAnd{x, y}
+	}
+	return x, nil
+}
+
+func (p *whenParser) unary() (whenExpr, error) {
+	switch p.peek() {
+	case "!":
+		p.pos++
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return whenNot{x}, nil
+	case "(":
+		p.pos++
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return x, nil
+	}
+	return p.compare()
+}
+
+func (p *whenParser) compare() (whenExpr, error) {
+	fact, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	value, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if op.literal || !slices.Contains([]string{"==", "!=", ">=", "<=", ">", "<"}, op.text) {
+		return nil, fmt.Errorf("expected a comparison after %s, got %q", fact.text, op.text)
+	}
+	if !value.literal && !isWhenWordByte(value.text[0]) {
+		return nil, fmt.Errorf("expected a value after %s %s, got %q", fact.text, op.text, value.text)
+	}
+
+	e := whenCompare{fact: fact.text, op: op.text, value: value.text}
+	switch {
+	case fact.literal:
+		return nil, fmt.Errorf("expected a fact, got %q", fact.text)
+	case !slices.Contains([]string{"os", "arch", "hostname", "user"}, e.fact):
+		return nil, fmt.Errorf("unknown fact %q, must be os, arch, hostname or user", e.fact)
+	case e.fact == "os":
+		if e.version, err = parseVersion(e.value); err != nil {
+			return nil, err
+		}
+	case e.op != "==" && e.op != "!=":
+		return nil, fmt.Errorf("%s can only be compared with == or !=", e.fact)
+	case e.fact == "arch":
+		if _, ok := archAliases[e.value]; !ok {
+			return nil, fmt.Errorf("invalid arch %q, must be arm64 or amd64", e.value)
+		}
+	default:
+		if _, err := path.Match(e.value, ""); err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", e.fact, e.value, err)
+		}
+	}
+	return e, nil
+}
+
+// applyWhen evaluates the when expressions of the macos sections and raw
+// entries, and removes the ones that are false. The expressions in profiles
+// are only checked, since the active profiles have been merged into macos
+// already.
+func (d *Document) applyWhen(ctx context.Context, facts FactsProvider) ([]Skip, error) {
+	var skipped []Skip
+	macos, _ := d.Values["macos"].(map[string]any)
+	err := d.eachWhen(macos, "macos", func(item string, expr whenExpr, text string) (bool, error) {
+		f, err := facts.Facts(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to gather facts: %w", err)
+		}
+		if expr.eval(f) {
+			return true, nil
+		}
+
+		var values []string
+		for _, name := range expr.facts(nil) {
+			value := factValue(f, name)
+			if value == "" {
+				value = "unknown"
+			}
+			values = append(values, name+" "+value)
+		}
+		skipped = append(skipped, Skip{
+			Item:   item,
+			Reason: fmt.Sprintf("when %q is false (%s)", text, strings.Join(values, ", ")),
+		})
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.checkWhen(true); err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+// checkWhen parses and removes the when expressions of the profiles, and of
+// the top-level macos table too unless onlyProfiles is set, without
+// evaluating them.
+func (d *Document) checkWhen(onlyProfiles bool) error {
+	var errs []error
+	keep := func(string, whenExpr, string) (bool, error) { return true, nil }
+	for _, t := range macosTables(d.Values) {
+		if onlyProfiles && t.path[0] != profilesKey {
+			continue
+		}
+		errs = append(errs, d.eachWhen(t.table, dottedKey(t.path), keep))
+	}
+	return errors.Combine(errs...)
+}
+
+// eachWhen parses and removes the when key of every section below macos,
+// and of every raw entry, and calls keep with it. Items keep rejects are
+// removed from the document. Items with an invalid when key are kept, and
+// every invalid key is reported.
+func (d *Document) eachWhen(macos map[string]any, prefix string, keep func(item string, expr whenExpr, text string) (bool, error)) error {
+	var errs []error
+	check := func(table map[string]any, key, item string) (bool, error) {
+		raw, ok := table[whenKey]
+		if !ok {
+			return true, nil
+		}
+		text, ok := raw.(string)
+		if !ok {
+			errs = append(errs, &keyError{key: joinKey(key, whenKey), err: fmt.Errorf("must be a string")})
+			return true, nil
+		}
+		expr, err := parseWhen(text)
+		if err != nil {
+			errs = append(errs, &keyError{key: joinKey(key, whenKey), err: err})
+			return true, nil
+		}
+
+		delete(table, whenKey)
+		forgetKey(d.provenance, joinKey(key, whenKey))
+		d.content = ""
+		return keep(item, expr, text)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(macos)) {
+		section, ok := macos[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		key := joinKey(prefix, name)
+		ok, err := check(section, key, name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			delete(macos, name)
+			forgetKey(d.provenance, key)
+			continue
+		}
+		if name != rawKey {
+			continue
+		}
+
+		for _, k := range slices.Sorted(maps.Keys(section)) {
+			switch entry := section[k].(type) {
+			case map[string]any:
+				entryKey := joinKey(key, k)
+				ok, err := check(entry, entryKey, joinKey(name, k))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					delete(section, k)
+					forgetKey(d.provenance, entryKey)
+				}
+			case []any:
+				if k != "entries" {
+					continue
+				}
+				kept := make([]any, 0, len(entry))
+				for i, item := range entry {
+					table, isTable := item.(map[string]any)
+					if !isTable {
+						kept = append(kept, item)
+						continue
+					}
+					entryKey := fmt.Sprintf("%s[%d]", joinKey(key, k), i)
+					ok, err := check(table, entryKey, fmt.Sprintf("%s.entries[%d] (%v %v)", name, i, table["domain"], table["key"]))
+					if err != nil {
+						return err
+					}
+					if ok {
+						kept = append(kept, item)
+					}
+				}
+				section[k] = kept
+			}
+		}
+	}
+	return errors.Combine(errs...)
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RATIU5/fjrd/internal/macos/trackpad"
+)
+
+func TestParseWhen(t *testing.T) {
+	facts := Facts{Hostname: "ana-mbp", MacOSVersion: "14.5", Arch: "arm64", Username: "ana"}
+
+	tests := []struct {
+		expr    string
+		want    bool
+		wantErr string
+	}{
+		{expr: "os >= 14", want: true},
+		{expr: "os >= 14.6", want: false},
+		{expr: "os == 14.5.0", want: true},
+		{expr: "os >= 14 && arch == 'arm64'", want: true},
+		{expr: `arch == "x86_64" || hostname == '*-mbp'`, want: true},
+		{expr: "!(os < 14) && user != 'bob'", want: true},
+		{expr: "os < 14 || arch == 'amd64' && user == 'ana'", want: false},
+		{expr: "arch == arm64", want: true},
+		{expr: "kernel == '23'", wantErr: `unknown fact "kernel"`},
+		{expr: "arch >= 'arm64'", wantErr: "only be compared with == or !="},
+		{expr: "arch == 'ppc'", wantErr: `invalid arch "ppc"`},
+		{expr: "os >= fourteen", wantErr: "invalid version"},
+		{expr: "os >= 14 &&", wantErr: "unexpected end"},
+		{expr: "(os >= 14", wantErr: "missing )"},
+		{expr: "os >= 14 os", wantErr: `unexpected "os"`},
+		{expr: "hostname == 'mbp", wantErr: "unterminated string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := parseWhen(tt.expr)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseWhen() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseWhen() error = %v", err)
+			}
+			if got := expr.eval(facts); got != tt.want {
+				t.Errorf("eval() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_When(t *testing.T) {
+	const config = `
+version = 1
+
+[macos.dock]
+autohide = true
+
+[macos.trackpad]
+when = "os >= 14 && arch == 'arm64'"
+click-weight = 2
+
+[macos.defaultsRaw."com.example.app.legacy"]
+when = "os < 14"
+type = "bool"
+value = true
+
+[[macos.defaultsRaw.entries]]
+when = "arch == 'amd64'"
+domain = "com.example.app"
+key = "rosetta"
+type = "bool"
+value = true
+
+[profiles.laptop.macos.mouse]
+when = "os > 13"
+speed = 1.5
+`
+	dir := writeConfigs(t, map[string]string{"config.toml": config})
+	location := filepath.Join(dir, "config.toml")
+
+	cfg, err := LoadConfig(context.Background(), location, testLogger(), LoadOptions{Facts: StaticFacts{MacOSVersion: "13.6", Arch: "amd64"}})
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	want := `trackpad: when "os >= 14 && arch == 'arm64'" is false (os 13.6, arch amd64)`
+	if skipped := cfg.Skipped(); len(skipped) != 1 || skipped[0].String() != want {
+		t.Errorf("Skipped() = %q, want [%q]", skipped, want)
+	}
+	if pad := cfg.Macos.Section("trackpad").(*trackpad.Config); pad.ClickWeight != nil {
+		t.Errorf("trackpad was applied: %+v", pad)
+	}
+	entries, err := cfg.Macos.raw().Entries()
+	if err != nil || len(entries) != 2 {
+		t.Errorf("Entries() = %v, %v, want the legacy and rosetta entries", entries, err)
+	}
+
+	cfg, err = LoadConfig(context.Background(), location, testLogger(), LoadOptions{Facts: StaticFacts{MacOSVersion: "14.5", Arch: "arm64"}})
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	var got []string
+	for _, skip := range cfg.Skipped() {
+		got = append(got, skip.Item)
+	}
+	if strings.Join(got, ",") != `defaultsRaw."com.example.app.legacy",defaultsRaw.entries[0] (com.example.app rosetta)` {
+		t.Errorf("Skipped() = %q", got)
+	}
+	if pad := cfg.Macos.Section("trackpad").(*trackpad.Config); pad.ClickWeight == nil || *pad.ClickWeight != 2 {
+		t.Errorf("trackpad = %+v, want click-weight 2", pad)
+	}
+
+	broken := strings.Replace(config, `when = "os > 13"`, `when = "os > thirteen"`, 1)
+	dir = writeConfigs(t, map[string]string{"config.toml": broken})
+	_, err = LoadConfig(context.Background(), filepath.Join(dir, "config.toml"), testLogger(), LoadOptions{Facts: StaticFacts{}})
+	if err == nil || !strings.Contains(err.Error(), "profiles.laptop.macos.mouse.when") {
+		t.Errorf("LoadConfig() error = %v, want an error for the inactive profile's when", err)
+	}
+}
@@ -165,6 +165,18 @@ func Combine(errs ...error) error {
 	return me.ToError()
 }
 
+func New(text string) error {
+	return errors.New(text)
+}
+
+func Is(err, target error) bool {
+	return errors.Is(err, target)
+}
+
+func As(err error, target any) bool {
+	return errors.As(err, target)
+}
+
 func IsConfigurationError(err error) bool {
 	var configErr *ConfigurationError
 	return errors.As(err, &configErr)
@@ -8,7 +8,12 @@ import (
 )
 
 func GetUserApproval(commands []string) (bool, error) {
-	fmt.Println("\nThe following raw defaults commands will be executed:")
+	return GetApproval("The following raw defaults commands will be executed:", commands)
+}
+
+// GetApproval lists commands under title and asks the user to confirm them.
+func GetApproval(title string, commands []string) (bool, error) {
+	fmt.Println("\n" + title)
 	fmt.Println("=" + strings.Repeat("=", 50))
 
 	for i, cmd := range commands {
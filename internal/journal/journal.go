@@ -0,0 +1,498 @@
+// Package journal keeps an append-only record of every apply so that past
+// runs can be listed and reverted.
+//
+// The journal is a JSON Lines file, one Run per line. Values are stored with
+// their defaults type so that an undo writes back exactly what was there.
+package journal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+	"github.com/RATIU5/fjrd/internal/macos/defaults"
+)
+
+const journalFile = "journal.jsonl"
+
+// Last can be passed to Journal.Get in place of a run ID.
+const Last = "last"
+
+const (
+	CommandApply = "apply"
+	CommandUndo  = "undo"
+)
+
+// Entry results.
+const (
+	ResultWritten   = "written"
+	ResultDeleted   = "deleted"
+	ResultUnchanged = "unchanged"
+	ResultFailed    = "failed"
+)
+
+var ErrNotFound = errors.New("run not found in journal")
+
+// ValueRecord is a defaults value with its type, e.g.
+// {"type":"int","value":48}. Arrays and dicts hold nested records so that
+// their element types survive the round trip.
+type ValueRecord struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// NewValueRecord encodes v. A nil Value gives a nil record.
+func NewValueRecord(v defaults.Value) (*ValueRecord, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if resetter, ok := v.(defaults.ResetValue); ok && resetter.IsReset() {
+		return nil, nil
+	}
+
+	var encoded any
+	switch t := v.(type) {
+	case *defaults.ArrayValue:
+		items := make([]*ValueRecord, len(t.Values))
+		for i, item := range t.Values {
+			record, err := NewValueRecord(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = record
+		}
+		encoded = items
+	case *defaults.DictValue:
+		items := make(map[string]*ValueRecord, len(t.Values))
+		for k, item := range t.Values {
+			record, err := NewValueRecord(item)
+			if err != nil {
+				return nil, err
+			}
+			items[k] = record
+		}
+		encoded = items
+	default:
+		native, err := defaults.ToNative(v)
+		if err != nil {
+			return nil, err
+		}
+		encoded = native
+	}
+
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return &ValueRecord{Type: strings.TrimPrefix(string(v.Type()), "-"), Value: data}, nil
+}
+
+// Decode returns the recorded value.
+func (r *ValueRecord) Decode() (defaults.Value, error) {
+	if r == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	var native any
+	var err error
+
+	switch r.Type {
+	case "bool":
+		var b bool
+		err = json.Unmarshal(r.Value, &b)
+		native = b
+	case "string":
+		var s string
+		err = json.Unmarshal(r.Value, &s)
+		native = s
+	case "int":
+		var i int64
+		err = json.Unmarshal(r.Value, &i)
+		native = i
+	case "float":
+		var f float64
+		err = json.Unmarshal(r.Value, &f)
+		native = f
+	case "data":
+		var d []byte
+		err = json.Unmarshal(r.Value, &d)
+		native = d
+	case "date":
+		var t time.Time
+		err = json.Unmarshal(r.Value, &t)
+		native = t
+	case "array":
+		var items []*ValueRecord
+		if err := json.Unmarshal(r.Value, &items); err != nil {
+			return nil, fmt.Errorf("invalid array value %s: %w", r.Value, err)
+		}
+		values := make([]defaults.Value, len(items))
+		for i, item := range items {
+			if values[i], err = item.Decode(); err != nil {
+				return nil, err
+			}
+		}
+		return defaults.NewArrayValue(values...), nil
+	case "dict":
+		var items map[string]*ValueRecord
+		if err := json.Unmarshal(r.Value, &items); err != nil {
+			return nil, fmt.Errorf("invalid dict value %s: %w", r.Value, err)
+		}
+		values := make(map[string]defaults.Value, len(items))
+		for k, item := range items {
+			if values[k], err = item.Decode(); err != nil {
+				return nil, err
+			}
+		}
+		return defaults.NewDictValue(values), nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %q", r.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value %s: %w", r.Type, r.Value, err)
+	}
+	return defaults.FromNative(native)
+}
+
+func (r *ValueRecord) String() string {
+	if r == nil {
+		return "(unset)"
+	}
+	return string(r.Value)
+}
+
+// Entry records what happened to one domain/key. A nil Previous means the key
+// did not exist before the run; a nil New means the run deleted it.
+type Entry struct {
+	Domain   string         `json:"domain"`
+	Key      string         `json:"key"`
+	Host     defaults.Host  `json:"host,omitempty"`
+	Scope    defaults.Scope `json:"scope,omitempty"`
+	Previous *ValueRecord   `json:"previous"`
+	New      *ValueRecord   `json:"new"`
+	Result   string         `json:"result"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// Changed reports whether the run modified the key.
+func (e Entry) Changed() bool {
+	return e.Result == ResultWritten || e.Result == ResultDeleted
+}
+
+type Run struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	Command    string    `json:"command"`
+	Source     string    `json:"source,omitempty"`
+	ConfigHash string    `json:"config_hash,omitempty"`
+	Undoes     string    `json:"undoes,omitempty"`
+	RolledBack bool      `json:"rolled_back,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Entries    []Entry   `json:"entries"`
+}
+
+// NewRun builds the record of an apply from its result.
+func NewRun(source, configHash string, result defaults.Result, applyErr error) (*Run, error) {
+	run := &Run{
+		Time:       time.Now().UTC(),
+		Command:    CommandApply,
+		Source:     source,
+		ConfigHash: configHash,
+		RolledBack: result.RolledBack,
+	}
+	if applyErr != nil {
+		run.Error = applyErr.Error()
+	}
+
+	for _, outcome := range result.Outcomes {
+		entry, err := newEntry(outcome)
+		if err != nil {
+			return nil, err
+		}
+		run.Entries = append(run.Entries, entry)
+	}
+	return run, nil
+}
+
+func newEntry(outcome defaults.Outcome) (Entry, error) {
+	cmd := outcome.Command
+	entry := Entry{Domain: cmd.Domain, Key: cmd.Key, Host: cmd.Host, Scope: cmd.Scope}
+
+	previous, err := NewValueRecord(outcome.Current)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to record %s %s: %w", cmd.Domain, cmd.Key, err)
+	}
+	entry.Previous = previous
+
+	if outcome.Kind == defaults.ChangeDelete {
+		entry.New = nil
+	} else if entry.New, err = NewValueRecord(cmd.Value); err != nil {
+		return Entry{}, fmt.Errorf("failed to record %s %s: %w", cmd.Domain, cmd.Key, err)
+	}
+
+	switch {
+	case outcome.Err != nil:
+		entry.Result = ResultFailed
+		entry.Error = outcome.Err.Error()
+	case outcome.Kind == defaults.ChangeWrite:
+		entry.Result = ResultWritten
+	case outcome.Kind == defaults.ChangeDelete:
+		entry.Result = ResultDeleted
+	default:
+		entry.Result = ResultUnchanged
+	}
+	return entry, nil
+}
+
+// Changed returns the entries the run actually modified. A rolled back run
+// changed nothing.
+func (r *Run) Changed() []Entry {
+	if r.RolledBack {
+		return nil
+	}
+
+	var changed []Entry
+	for _, entry := range r.Entries {
+		if entry.Changed() {
+			changed = append(changed, entry)
+		}
+	}
+	return changed
+}
+
+type Journal struct {
+	dir string
+}
+
+func New(dir string) *Journal {
+	if dir == "" {
+		dir = DefaultDir()
+	}
+	return &Journal{dir: dir}
+}
+
+// DefaultDir returns ~/.fjrd/state.
+func DefaultDir() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".fjrd", "state")
+}
+
+func (j *Journal) Path() string {
+	return filepath.Join(j.dir, journalFile)
+}
+
+// Append assigns the run the next ID and appends it to the journal.
+func (j *Journal) Append(run *Run) error {
+	runs, err := j.Runs()
+	if err != nil {
+		return err
+	}
+
+	next := 1
+	if len(runs) > 0 {
+		if last, err := strconv.Atoi(runs[len(runs)-1].ID); err == nil {
+			next = last + 1
+		}
+	}
+	run.ID = strconv.Itoa(next)
+
+	data, err := json.Marshal(run)
+	if err != nil {
+		return errors.WrapConfigError("journal", "encode", run.ID, nil, err)
+	}
+
+	if err := os.MkdirAll(j.dir, 0755); err != nil {
+		return errors.WrapConfigError("journal", "append", j.Path(), nil, err)
+	}
+	f, err := os.OpenFile(j.Path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.WrapConfigError("journal", "append", j.Path(), nil, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return errors.WrapConfigError("journal", "append", j.Path(), nil, err)
+	}
+	return nil
+}
+
+// Runs returns every recorded run, oldest first.
+func (j *Journal) Runs() ([]*Run, error) {
+	f, err := os.Open(j.Path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WrapConfigError("journal", "read", j.Path(), nil, err)
+	}
+	defer f.Close()
+
+	var runs []*Run
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			return nil, errors.WrapConfigError("journal", "decode", fmt.Sprintf("line %d", line), nil, err)
+		}
+		runs = append(runs, &run)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WrapConfigError("journal", "read", j.Path(), nil, err)
+	}
+	return runs, nil
+}
+
+// Get returns the run with the given ID. Last selects the most recent apply
+// that changed something and has not been undone yet.
+func (j *Journal) Get(id string) (*Run, error) {
+	runs, err := j.Runs()
+	if err != nil {
+		return nil, err
+	}
+
+	if id != Last {
+		for _, run := range runs {
+			if run.ID == id {
+				return run, nil
+			}
+		}
+		return nil, fmt.Errorf("run %s: %w", id, ErrNotFound)
+	}
+
+	undone := make(map[string]bool)
+	for _, run := range runs {
+		if run.Undoes != "" {
+			undone[run.Undoes] = true
+		}
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		if run.Command == CommandApply && !undone[run.ID] && len(run.Changed()) > 0 {
+			return run, nil
+		}
+	}
+	return nil, fmt.Errorf("no run left to undo: %w", ErrNotFound)
+}
+
+// Undo reverts every key the run changed, newest change first, and returns
+// the record of the undo itself. Keys that did not exist before the run are
+// deleted again. System keys are reverted in a single escalation, as they
+// were written.
+func Undo(ctx context.Context, run *Run, log interface {
+	Info(string, ...any)
+	Debug(string, ...any)
+}) (*Run, error) {
+	undo := &Run{
+		Time:    time.Now().UTC(),
+		Command: CommandUndo,
+		Source:  run.Source,
+		Undoes:  run.ID,
+	}
+
+	multiErr := errors.NewMultiError()
+	changed := run.Changed()
+
+	var privileged []defaults.Command
+	var pending []int
+	for i := len(changed) - 1; i >= 0; i-- {
+		entry := changed[i]
+		reverted := Entry{Domain: entry.Domain, Key: entry.Key, Host: entry.Host, Scope: entry.Scope, Previous: entry.New, New: entry.Previous}
+
+		var err error
+		if entry.Scope.Privileged() {
+			var cmd defaults.Command
+			if cmd, err = revertCommand(entry); err == nil {
+				privileged = append(privileged, cmd)
+				pending = append(pending, len(undo.Entries))
+			}
+		} else {
+			reverted.Result, err = revert(ctx, entry)
+		}
+		if err != nil {
+			reverted.Result = ResultFailed
+			reverted.Error = err.Error()
+			multiErr.Add(fmt.Errorf("failed to revert %s %s: %w", entry.Domain, entry.Key, err))
+		}
+		undo.Entries = append(undo.Entries, reverted)
+	}
+
+	if len(privileged) > 0 {
+		result, err := defaults.ApplyPrivileged(ctx, privileged, log)
+		if err != nil {
+			multiErr.Add(fmt.Errorf("failed to revert system preferences: %w", err))
+		}
+		for j, i := range pending {
+			reverted := &undo.Entries[i]
+			switch {
+			case j >= len(result.Outcomes) || result.Outcomes[j].Err != nil:
+				reverted.Result = ResultFailed
+				if err != nil {
+					reverted.Error = err.Error()
+				}
+			case result.Outcomes[j].Kind == defaults.ChangeNone:
+				reverted.Result = ResultUnchanged
+			case result.Outcomes[j].Kind == defaults.ChangeDelete:
+				reverted.Result = ResultDeleted
+			default:
+				reverted.Result = ResultWritten
+			}
+		}
+	}
+
+	if err := multiErr.ToError(); err != nil {
+		undo.Error = err.Error()
+		return undo, err
+	}
+	return undo, nil
+}
+
+// revertCommand returns the command that puts a changed system key back,
+// for the escalation that reverts every system key at once.
+func revertCommand(entry Entry) (defaults.Command, error) {
+	cmd := defaults.Command{Domain: entry.Domain, Key: entry.Key, Host: entry.Host, Scope: entry.Scope}
+	if entry.Previous == nil {
+		cmd.Value = defaults.NewResetStringValue()
+		return cmd, nil
+	}
+	value, err := entry.Previous.Decode()
+	if err != nil {
+		return cmd, err
+	}
+	cmd.Value = value
+	return cmd, nil
+}
+
+// revert puts one changed key back to its previous value. Keys that did not
+// exist before are deleted unless something already removed them.
+func revert(ctx context.Context, entry Entry) (string, error) {
+	backend, err := defaults.BackendFor(ctx, entry.Scope, entry.Host)
+	if err != nil {
+		return ResultFailed, err
+	}
+
+	if entry.Previous == nil {
+		if _, err := backend.Read(ctx, entry.Domain, entry.Key); errors.Is(err, defaults.ErrKeyNotFound) {
+			return ResultUnchanged, nil
+		} else if err != nil {
+			return ResultFailed, err
+		}
+		return ResultDeleted, backend.Delete(ctx, entry.Domain, entry.Key)
+	}
+
+	value, err := entry.Previous.Decode()
+	if err != nil {
+		return ResultFailed, err
+	}
+	return ResultWritten, backend.Write(ctx, entry.Domain, entry.Key, value)
+}
@@ -0,0 +1,155 @@
+package journal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+	"github.com/RATIU5/fjrd/internal/macos/defaults"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Debug(string, ...any) {}
+
+func useMemoryBackend(t *testing.T) *defaults.MemoryBackend {
+	t.Helper()
+	mem := defaults.NewMemoryBackend()
+	previous := defaults.GetBackend()
+	defaults.SetBackend(mem)
+	t.Cleanup(func() { defaults.SetBackend(previous) })
+	return mem
+}
+
+func TestValueRecord_RoundTrip(t *testing.T) {
+	values := []defaults.Value{
+		defaults.NewBoolValue(true),
+		defaults.NewStringValue("clmv"),
+		&defaults.IntValue{Value: -48},
+		&defaults.FloatValue{Value: 0.125, Precision: -1},
+		defaults.NewArrayValue(&defaults.IntValue{Value: 1}, &defaults.FloatValue{Value: 1, Precision: -1}),
+		defaults.NewDictValue(map[string]defaults.Value{
+			"Hide": defaults.NewStringValue("@h"),
+			"Tags": defaults.NewArrayValue(defaults.NewBoolValue(false)),
+		}),
+		defaults.NewDataValue([]byte{0x0a, 0x1b}),
+		defaults.NewDateValue(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)),
+	}
+
+	for _, v := range values {
+		t.Run(string(v.Type()), func(t *testing.T) {
+			record, err := NewValueRecord(v)
+			if err != nil {
+				t.Fatalf("NewValueRecord() error = %v", err)
+			}
+			got, err := record.Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !defaults.Equal(got, v) {
+				t.Errorf("Decode() = %s %s, want %s %s", got.Type(), got, v.Type(), v)
+			}
+		})
+	}
+}
+
+func TestJournal_RecordAndUndo(t *testing.T) {
+	mem := useMemoryBackend(t)
+	ctx := context.Background()
+	j := New(t.TempDir())
+
+	mem.Write(ctx, "com.apple.dock", "autohide", defaults.NewBoolValue(false))
+	mem.Write(ctx, "com.apple.dock", "orientation", defaults.NewStringValue("bottom"))
+	mem.Write(ctx, "com.apple.dock", "workspaces-auto-swoosh", &defaults.IntValue{Value: 1})
+
+	batch := defaults.NewBatchExecutor()
+	batch.AddBool("com.apple.dock", "autohide", true)
+	batch.AddString("com.apple.dock", "orientation", "bottom")
+	batch.AddInt("com.apple.dock", "tilesize", 48)
+	batch.AddCommand(defaults.Command{Domain: "com.apple.dock", Key: "workspaces-auto-swoosh", Value: defaults.NewResetIntValue()})
+
+	result, err := batch.Apply(ctx, nopLogger{})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	run, err := NewRun("config.toml", "abc123", result, nil)
+	if err != nil {
+		t.Fatalf("NewRun() error = %v", err)
+	}
+	if err := j.Append(run); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	runs, err := j.Runs()
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("Runs() = %d runs, %v", len(runs), err)
+	}
+	recorded := runs[0]
+	if recorded.ID != "1" || recorded.ConfigHash != "abc123" || len(recorded.Changed()) != 3 {
+		t.Fatalf("recorded run = %+v", recorded)
+	}
+
+	last, err := j.Get(Last)
+	if err != nil || last.ID != "1" {
+		t.Fatalf("Get(last) = %v, %v", last, err)
+	}
+
+	undo, err := Undo(ctx, last, nopLogger{})
+	if err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	if err := j.Append(undo); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	if got, _ := mem.Read(ctx, "com.apple.dock", "autohide"); got.String() != "false" {
+		t.Errorf("autohide after undo = %s, want false", got)
+	}
+	if _, err := mem.Read(ctx, "com.apple.dock", "tilesize"); !errors.Is(err, defaults.ErrKeyNotFound) {
+		t.Errorf("tilesize should be deleted by undo, got %v", err)
+	}
+	if got, err := mem.Read(ctx, "com.apple.dock", "workspaces-auto-swoosh"); err != nil || got.Type() != defaults.IntType || got.String() != "1" {
+		t.Errorf("reset key after undo = %v, %v, want int 1", got, err)
+	}
+
+	if _, err := j.Get(Last); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(last) after undo error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUndo_SystemKeys(t *testing.T) {
+	mem := useMemoryBackend(t)
+	ctx := context.Background()
+
+	result, err := defaults.ApplyPrivileged(ctx, []defaults.Command{
+		{Domain: "com.apple.loginwindow", Key: "GuestEnabled", Value: defaults.NewBoolValue(false), Scope: defaults.SystemScope},
+		{Domain: "com.apple.SoftwareUpdate", Key: "AutomaticCheckEnabled", Value: defaults.NewBoolValue(true), Scope: defaults.SystemScope},
+	}, nopLogger{})
+	if err != nil {
+		t.Fatalf("ApplyPrivileged() error = %v", err)
+	}
+	run, err := NewRun("config.toml", "abc123", result, nil)
+	if err != nil {
+		t.Fatalf("NewRun() error = %v", err)
+	}
+
+	undo, err := Undo(ctx, run, nopLogger{})
+	if err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	if mem.Escalations() != 2 {
+		t.Errorf("apply and undo escalated %d times, want 2", mem.Escalations())
+	}
+	for _, entry := range undo.Entries {
+		if entry.Result != ResultDeleted {
+			t.Errorf("undo of %s %s = %s, want %s", entry.Domain, entry.Key, entry.Result, ResultDeleted)
+		}
+	}
+	system, _ := defaults.BackendFor(ctx, defaults.SystemScope, defaults.AnyHost)
+	if _, err := system.Read(ctx, "com.apple.loginwindow", "GuestEnabled"); !errors.Is(err, defaults.ErrKeyNotFound) {
+		t.Errorf("GuestEnabled should be deleted by undo, got %v", err)
+	}
+}
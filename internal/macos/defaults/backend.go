@@ -0,0 +1,95 @@
+package defaults
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+)
+
+// ErrKeyNotFound is returned by Backend.Read when the domain has no value for
+// the requested key.
+var ErrKeyNotFound = errors.New("defaults key not found")
+
+// Backend is the storage layer behind every defaults read, write and process
+// restart performed by fjrd.
+type Backend interface {
+	Read(ctx context.Context, domain, key string) (Value, error)
+	Write(ctx context.Context, domain, key string, value Value) error
+	Delete(ctx context.Context, domain, key string) error
+	Export(ctx context.Context, domain string) ([]byte, error)
+	Import(ctx context.Context, domain string, data []byte) error
+	RestartProcess(ctx context.Context, name string, onlyIfRunning bool) error
+	// DirExists and MakeDir check for and create the directories that some
+	// keys name, e.g. the screenshot location.
+	DirExists(ctx context.Context, path string) (bool, error)
+	MakeDir(ctx context.Context, path string) error
+}
+
+var (
+	backendMu     sync.RWMutex
+	activeBackend Backend = NewCLIBackend()
+)
+
+// SetBackend replaces the backend used by Command, BatchExecutor and
+// KillallExecutor. It is meant to be called once at startup.
+func SetBackend(b Backend) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	activeBackend = b
+}
+
+func GetBackend() Backend {
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	return activeBackend
+}
+
+// NewBackend builds a backend from a command line spec: "cli", "memory" or
+// "dir:<path>".
+func NewBackend(spec string) (Backend, error) {
+	switch {
+	case spec == "" || spec == "cli":
+		return NewCLIBackend(), nil
+	case spec == "memory":
+		return NewMemoryBackend(), nil
+	case strings.HasPrefix(spec, "dir:"):
+		dir := strings.TrimPrefix(spec, "dir:")
+		if dir == "" {
+			return nil, fmt.Errorf("backend %q requires a directory path", spec)
+		}
+		return NewPlistDirBackend(dir), nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q, must be one of: cli, memory, dir:<path>", spec)
+	}
+}
+
+// mappedBackend stores domains under different names in the wrapped backend.
+// It lets the in-memory and directory backends keep ByHost and system
+// domains apart from the regular ones.
+type mappedBackend struct {
+	Backend
+	domain func(string) string
+}
+
+func (b *mappedBackend) Read(ctx context.Context, domain, key string) (Value, error) {
+	return b.Backend.Read(ctx, b.domain(domain), key)
+}
+
+func (b *mappedBackend) Write(ctx context.Context, domain, key string, value Value) error {
+	return b.Backend.Write(ctx, b.domain(domain), key, value)
+}
+
+func (b *mappedBackend) Delete(ctx context.Context, domain, key string) error {
+	return b.Backend.Delete(ctx, b.domain(domain), key)
+}
+
+func (b *mappedBackend) Export(ctx context.Context, domain string) ([]byte, error) {
+	return b.Backend.Export(ctx, b.domain(domain))
+}
+
+func (b *mappedBackend) Import(ctx context.Context, domain string, data []byte) error {
+	return b.Backend.Import(ctx, b.domain(domain), data)
+}
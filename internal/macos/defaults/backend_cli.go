@@ -0,0 +1,253 @@
+package defaults
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+	"github.com/RATIU5/fjrd/internal/plist"
+)
+
+// CLIBackend talks to the real preferences system through the defaults,
+// killall and pgrep binaries.
+type CLIBackend struct {
+	host   Host
+	system bool
+}
+
+func NewCLIBackend() *CLIBackend {
+	return &CLIBackend{}
+}
+
+// ForHost passes -currentHost or -host to every defaults invocation, leaving
+// it to defaults to find the ByHost file.
+func (b *CLIBackend) ForHost(ctx context.Context, host Host) (Backend, error) {
+	return &CLIBackend{host: host}, nil
+}
+
+// ForSystem addresses domains by their /Library/Preferences path. Writes
+// through it run defaults with sudo.
+func (b *CLIBackend) ForSystem(ctx context.Context) (Backend, error) {
+	return &CLIBackend{system: true}, nil
+}
+
+// Escalate writes every command with a single sudo invocation. A reset of a
+// key that is already missing does not stop the writes after it.
+func (b *CLIBackend) Escalate(ctx context.Context, commands []Command) error {
+	system := &CLIBackend{system: true}
+
+	lines := []string{"set -e"}
+	for _, cmd := range commands {
+		args, reset, err := escalationArgs(cmd)
+		if err != nil {
+			return err
+		}
+		line := shellJoin(args)
+		if reset {
+			// defaults delete fails for a missing key; only a key that is
+			// still there afterwards is an error.
+			read := system.defaultsArgs("read", system.domain(cmd.Domain), cmd.Key)
+			line += " || ! " + shellJoin(append([]string{"/usr/bin/defaults"}, read...)) + " >/dev/null 2>&1"
+		}
+		lines = append(lines, line)
+	}
+
+	args := []string{"/bin/sh", "-c", strings.Join(lines, "\n")}
+	if err := exec.CommandContext(ctx, "sudo", args...).Run(); err != nil {
+		return errors.NewExecutionError("sudo", args, err)
+	}
+	return nil
+}
+
+// EscalationCommands returns the commands Escalate runs as root for
+// commands, one per line, for the user to approve.
+func EscalationCommands(commands []Command) ([]string, error) {
+	lines := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		args, _, err := escalationArgs(cmd)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, "sudo "+shellJoin(args))
+	}
+	return lines, nil
+}
+
+// escalationArgs returns the defaults invocation that writes cmd to its
+// system domain, and whether it deletes the key.
+func escalationArgs(cmd Command) ([]string, bool, error) {
+	system := &CLIBackend{system: true}
+	if resetter, ok := cmd.Value.(ResetValue); ok && resetter.IsReset() {
+		return append([]string{"/usr/bin/defaults"}, system.defaultsArgs("delete", system.domain(cmd.Domain), cmd.Key)...), true, nil
+	}
+	args, err := system.writeArgs(cmd.Domain, cmd.Key, cmd.Value)
+	if err != nil {
+		return nil, false, err
+	}
+	return append([]string{"/usr/bin/defaults"}, args...), false, nil
+}
+
+// defaultsArgs prefixes args with the host selection flags.
+func (b *CLIBackend) defaultsArgs(args ...string) []string {
+	return append(b.host.Args(), args...)
+}
+
+func (b *CLIBackend) domain(domain string) string {
+	if b.system {
+		return SystemDomainPath(domain)
+	}
+	return domain
+}
+
+// run executes defaults. Commands that modify a system domain go through
+// sudo.
+func (b *CLIBackend) run(ctx context.Context, modifies bool, args []string) *exec.Cmd {
+	if b.system && modifies {
+		return exec.CommandContext(ctx, "sudo", append([]string{"/usr/bin/defaults"}, args...)...)
+	}
+	return exec.CommandContext(ctx, "defaults", args...)
+}
+
+func (b *CLIBackend) Read(ctx context.Context, domain, key string) (Value, error) {
+	data, err := b.Export(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	return readKey(data, domain, key)
+}
+
+func (b *CLIBackend) Write(ctx context.Context, domain, key string, value Value) error {
+	args, err := b.writeArgs(domain, key, value)
+	if err != nil {
+		return err
+	}
+	if err := b.run(ctx, true, args).Run(); err != nil {
+		return errors.NewExecutionError("defaults", args, err)
+	}
+	return nil
+}
+
+func (b *CLIBackend) writeArgs(domain, key string, value Value) ([]string, error) {
+	if IsCollection(value.Type()) {
+		fragment, err := writeFragment(value)
+		if err != nil {
+			return nil, errors.WrapConfigError("defaults", "write", domain+" "+key, nil, err)
+		}
+		return b.defaultsArgs("write", b.domain(domain), key, fragment), nil
+	}
+	return b.defaultsArgs("write", b.domain(domain), key, string(value.Type()), value.String()), nil
+}
+
+func (b *CLIBackend) Delete(ctx context.Context, domain, key string) error {
+	args := b.defaultsArgs("delete", b.domain(domain), key)
+	if err := b.run(ctx, true, args).Run(); err != nil {
+		return errors.NewExecutionError("defaults", args, err)
+	}
+	return nil
+}
+
+func (b *CLIBackend) Export(ctx context.Context, domain string) ([]byte, error) {
+	args := b.defaultsArgs("export", b.domain(domain), "-")
+	output, err := b.run(ctx, false, args).Output()
+	if err != nil {
+		return nil, errors.NewExecutionError("defaults", args, err)
+	}
+	return output, nil
+}
+
+func (b *CLIBackend) Import(ctx context.Context, domain string, data []byte) error {
+	args := b.defaultsArgs("import", b.domain(domain), "-")
+	cmd := b.run(ctx, true, args)
+	cmd.Stdin = bytes.NewReader(data)
+	if err := cmd.Run(); err != nil {
+		return errors.NewExecutionError("defaults", args, err)
+	}
+	return nil
+}
+
+func (b *CLIBackend) RestartProcess(ctx context.Context, name string, onlyIfRunning bool) error {
+	if onlyIfRunning && exec.CommandContext(ctx, "pgrep", "-x", name).Run() != nil {
+		return nil
+	}
+
+	args := []string{name}
+	if err := exec.CommandContext(ctx, "killall", args...).Run(); err != nil {
+		return errors.NewExecutionError("killall", args, err)
+	}
+	return nil
+}
+
+func (b *CLIBackend) DirExists(ctx context.Context, path string) (bool, error) {
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		return info.IsDir(), nil
+	case os.IsNotExist(err):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func (b *CLIBackend) MakeDir(ctx context.Context, path string) error {
+	return os.MkdirAll(path, 0o755)
+}
+
+// shellJoin quotes args for /bin/sh.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// writeFragment encodes a collection as an XML plist fragment. Unlike the
+// -array and -dict flags, a fragment keeps nested types and can express
+// nested collections, data and dates.
+func writeFragment(value Value) (string, error) {
+	native, err := ToNative(value)
+	if err != nil {
+		return "", err
+	}
+	fragment, err := plist.MarshalXMLFragment(native)
+	if err != nil {
+		return "", err
+	}
+	return string(fragment), nil
+}
+
+// readKey decodes an exported domain and returns the value stored at key.
+func readKey(data []byte, domain, key string) (Value, error) {
+	root, err := decodeDomain(data, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	native, ok := root[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return FromNative(native)
+}
+
+func decodeDomain(data []byte, domain string) (plist.Dict, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return plist.Dict{}, nil
+	}
+
+	decoded, _, err := plist.Unmarshal(data)
+	if err != nil {
+		return nil, errors.WrapConfigError("defaults", "decode_domain", domain, nil, err)
+	}
+
+	root, ok := decoded.(plist.Dict)
+	if !ok {
+		return nil, errors.WrapConfigError("defaults", "decode_domain", domain, nil,
+			errors.New("domain root is not a dictionary"))
+	}
+	return root, nil
+}
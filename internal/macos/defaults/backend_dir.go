@@ -0,0 +1,236 @@
+package defaults
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+	"github.com/RATIU5/fjrd/internal/plist"
+)
+
+// globalDomainFile is the file backing NSGlobalDomain in a preferences
+// directory.
+const globalDomainFile = ".GlobalPreferences"
+
+// PlistDirBackend reads and writes <domain>.plist files in a directory laid
+// out like ~/Library/Preferences. Files keep the format they were found in
+// (new files are written as binary, like cfprefsd does) and are only
+// rewritten when their contents change. Process restarts are recorded but not
+// performed, and the directories keys name are created below Directories in
+// the directory rather than on the host.
+type PlistDirBackend struct {
+	mu        sync.Mutex
+	dir       string
+	restarted []string
+}
+
+func NewPlistDirBackend(dir string) *PlistDirBackend {
+	return &PlistDirBackend{dir: dir}
+}
+
+// Path returns the plist file that stores domain.
+func (p *PlistDirBackend) Path(domain string) string {
+	if isGlobalDomain(domain) {
+		domain = globalDomainFile
+	}
+
+	if filepath.IsAbs(domain) {
+		if strings.HasSuffix(domain, ".plist") {
+			return domain
+		}
+		return domain + ".plist"
+	}
+	return filepath.Join(p.dir, domain+".plist")
+}
+
+// ForHost stores host's preferences in the ByHost subdirectory.
+func (p *PlistDirBackend) ForHost(ctx context.Context, host Host) (Backend, error) {
+	return newByHostBackend(ctx, p, host)
+}
+
+// ForSystem stores system domains in the System subdirectory rather than
+// the real /Library/Preferences.
+func (p *PlistDirBackend) ForSystem(ctx context.Context) (Backend, error) {
+	return newSystemBackend(p), nil
+}
+
+func (p *PlistDirBackend) Escalate(ctx context.Context, commands []Command) error {
+	return executeAll(ctx, newSystemBackend(p), commands)
+}
+
+func isGlobalDomain(domain string) bool {
+	switch domain {
+	case "NSGlobalDomain", "-g", "-globalDomain", "Apple Global Domain":
+		return true
+	}
+	return false
+}
+
+func (p *PlistDirBackend) Read(ctx context.Context, domain, key string) (Value, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	root, _, err := p.load(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	native, ok := root[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return FromNative(native)
+}
+
+func (p *PlistDirBackend) Write(ctx context.Context, domain, key string, value Value) error {
+	native, err := ToNative(value)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	root, format, err := p.load(domain)
+	if err != nil {
+		return err
+	}
+	if current, ok := root[key]; ok && reflect.DeepEqual(current, native) {
+		return nil
+	}
+	root[key] = native
+	return p.store(domain, root, format)
+}
+
+func (p *PlistDirBackend) Delete(ctx context.Context, domain, key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	root, format, err := p.load(domain)
+	if err != nil {
+		return err
+	}
+	if _, ok := root[key]; !ok {
+		return ErrKeyNotFound
+	}
+	delete(root, key)
+	return p.store(domain, root, format)
+}
+
+// Export returns the domain file exactly as stored on disk.
+func (p *PlistDirBackend) Export(ctx context.Context, domain string) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	data, err := os.ReadFile(p.Path(domain))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return plist.MarshalXML(plist.Dict{})
+		}
+		return nil, errors.WrapConfigError("defaults", "read_domain", domain, nil, err)
+	}
+	return data, nil
+}
+
+// Import replaces the domain file with data, byte for byte, after checking
+// that it decodes.
+func (p *PlistDirBackend) Import(ctx context.Context, domain string, data []byte) error {
+	if _, err := decodeDomain(data, domain); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.writeFile(domain, data)
+}
+
+func (p *PlistDirBackend) RestartProcess(ctx context.Context, name string, onlyIfRunning bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.restarted = append(p.restarted, name)
+	return nil
+}
+
+// Restarted returns the processes that would have been restarted, in order.
+func (p *PlistDirBackend) Restarted() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	restarted := make([]string, len(p.restarted))
+	copy(restarted, p.restarted)
+	return restarted
+}
+
+// DirExists reports whether path exists below Directories in the
+// directory, so that a directory created by one run is found by the next.
+func (p *PlistDirBackend) DirExists(ctx context.Context, path string) (bool, error) {
+	info, err := os.Stat(p.dirPath(path))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.IsDir(), nil
+}
+
+// MakeDir creates path below Directories in the directory, since the
+// directory it names lives outside the preferences directory.
+func (p *PlistDirBackend) MakeDir(ctx context.Context, path string) error {
+	return os.MkdirAll(p.dirPath(path), 0755)
+}
+
+// dirPath returns where the directory at path is kept.
+func (p *PlistDirBackend) dirPath(path string) string {
+	return filepath.Join(p.dir, "Directories", path)
+}
+
+func (p *PlistDirBackend) load(domain string) (plist.Dict, plist.Format, error) {
+	data, err := os.ReadFile(p.Path(domain))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return plist.Dict{}, plist.FormatBinary, nil
+		}
+		return nil, plist.FormatUnknown, errors.WrapConfigError("defaults", "read_domain", domain, nil, err)
+	}
+
+	root, err := decodeDomain(data, domain)
+	if err != nil {
+		return nil, plist.FormatUnknown, err
+	}
+	return root, plist.DetectFormat(data), nil
+}
+
+func (p *PlistDirBackend) store(domain string, root plist.Dict, format plist.Format) error {
+	data, err := plist.Marshal(root, format)
+	if err != nil {
+		return errors.WrapConfigError("defaults", "encode_domain", domain, nil, err)
+	}
+	return p.writeFile(domain, data)
+}
+
+func (p *PlistDirBackend) writeFile(domain string, data []byte) error {
+	path := p.Path(domain)
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.WrapConfigError("defaults", "write_domain", domain, nil, err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return errors.WrapConfigError("defaults", "write_domain", domain, nil, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return errors.WrapConfigError("defaults", "write_domain", domain, nil, err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package defaults
+
+import (
+	"context"
+	"sync"
+
+	"github.com/RATIU5/fjrd/internal/plist"
+)
+
+// MemoryBackend keeps every domain in memory. It is used for dry runs and
+// for exercising the apply pipeline without a Mac.
+type MemoryBackend struct {
+	mu        sync.RWMutex
+	domains   map[string]plist.Dict
+	running   map[string]bool
+	restarted []string
+	escalated int
+	dirs      map[string]bool
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		domains: make(map[string]plist.Dict),
+		running: make(map[string]bool),
+		dirs:    make(map[string]bool),
+	}
+}
+
+// ForHost keeps host's preferences in separate ByHost domains.
+func (m *MemoryBackend) ForHost(ctx context.Context, host Host) (Backend, error) {
+	return newByHostBackend(ctx, m, host)
+}
+
+// ForSystem keeps system domains in separate System/ domains.
+func (m *MemoryBackend) ForSystem(ctx context.Context) (Backend, error) {
+	return newSystemBackend(m), nil
+}
+
+// Escalate writes the commands to the system domains and counts the
+// escalation, since no privileges are needed in memory.
+func (m *MemoryBackend) Escalate(ctx context.Context, commands []Command) error {
+	m.mu.Lock()
+	m.escalated++
+	m.mu.Unlock()
+	return executeAll(ctx, newSystemBackend(m), commands)
+}
+
+// Escalations returns how many privileged steps have been run.
+func (m *MemoryBackend) Escalations() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.escalated
+}
+
+func (m *MemoryBackend) Read(ctx context.Context, domain, key string) (Value, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	native, ok := m.domains[domain][key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return FromNative(native)
+}
+
+func (m *MemoryBackend) Write(ctx context.Context, domain, key string, value Value) error {
+	native, err := ToNative(value)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.domains[domain] == nil {
+		m.domains[domain] = make(plist.Dict)
+	}
+	m.domains[domain][key] = native
+	return nil
+}
+
+func (m *MemoryBackend) Delete(ctx context.Context, domain, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.domains[domain][key]; !ok {
+		return ErrKeyNotFound
+	}
+	delete(m.domains[domain], key)
+	return nil
+}
+
+func (m *MemoryBackend) Export(ctx context.Context, domain string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	root := m.domains[domain]
+	if root == nil {
+		root = plist.Dict{}
+	}
+	return plist.MarshalXML(root)
+}
+
+func (m *MemoryBackend) Import(ctx context.Context, domain string, data []byte) error {
+	root, err := decodeDomain(data, domain)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domains[domain] = root
+	return nil
+}
+
+func (m *MemoryBackend) RestartProcess(ctx context.Context, name string, onlyIfRunning bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if onlyIfRunning && !m.running[name] {
+		return nil
+	}
+	m.restarted = append(m.restarted, name)
+	return nil
+}
+
+// SetProcessRunning controls whether RestartProcess with onlyIfRunning
+// considers name to be running.
+func (m *MemoryBackend) SetProcessRunning(name string, running bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.running[name] = running
+}
+
+// Restarted returns the processes restarted so far, in order.
+func (m *MemoryBackend) Restarted() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	restarted := make([]string, len(m.restarted))
+	copy(restarted, m.restarted)
+	return restarted
+}
+
+// DirExists reports whether MakeDir has been called for path.
+func (m *MemoryBackend) DirExists(ctx context.Context, path string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.dirs[path], nil
+}
+
+// MakeDir records path without creating it on the host. Like the keys of
+// the backend, the directory lasts as long as the backend.
+func (m *MemoryBackend) MakeDir(ctx context.Context, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dirs[path] = true
+	return nil
+}
@@ -0,0 +1,324 @@
+package defaults
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+	"github.com/RATIU5/fjrd/internal/plist"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Warn(string, ...any)  {}
+
+func withBackend(t *testing.T, b Backend) {
+	t.Helper()
+	previous := GetBackend()
+	SetBackend(b)
+	t.Cleanup(func() { SetBackend(previous) })
+}
+
+func TestNewBackend(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{spec: "", wantErr: false},
+		{spec: "cli", wantErr: false},
+		{spec: "memory", wantErr: false},
+		{spec: "dir:/tmp/prefs", wantErr: false},
+		{spec: "dir:", wantErr: true},
+		{spec: "ftp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := NewBackend(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewBackend(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBackends_ReadWriteDelete(t *testing.T) {
+	backends := map[string]Backend{
+		"memory": NewMemoryBackend(),
+		"dir":    NewPlistDirBackend(t.TempDir()),
+	}
+
+	for name, b := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			if _, err := b.Read(ctx, "com.apple.dock", "autohide"); !errors.Is(err, ErrKeyNotFound) {
+				t.Fatalf("Read() on empty backend error = %v, want ErrKeyNotFound", err)
+			}
+
+			values := map[string]Value{
+				"autohide":    NewBoolValue(true),
+				"orientation": NewStringValue("left"),
+				"tilesize":    &IntValue{Value: 48},
+				"delay":       &FloatValue{Value: 0.125, Precision: -1},
+				"apps":        NewArrayValue(NewStringValue("Safari"), &IntValue{Value: 2}),
+				"prefs":       NewDictValue(map[string]Value{"size": &IntValue{Value: 1}, "tags": NewArrayValue()}),
+				"blob":        NewDataValue([]byte{0xde, 0xad}),
+				"modified":    NewDateValue(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)),
+			}
+			for key, v := range values {
+				if err := b.Write(ctx, "com.apple.dock", key, v); err != nil {
+					t.Fatalf("Write(%s) error = %v", key, err)
+				}
+			}
+
+			for key, want := range values {
+				got, err := b.Read(ctx, "com.apple.dock", key)
+				if err != nil {
+					t.Fatalf("Read(%s) error = %v", key, err)
+				}
+				if got.Type() != want.Type() || got.String() != want.String() {
+					t.Errorf("Read(%s) = %s %s, want %s %s", key, got.Type(), got, want.Type(), want)
+				}
+			}
+
+			if err := b.Delete(ctx, "com.apple.dock", "autohide"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if _, err := b.Read(ctx, "com.apple.dock", "autohide"); !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("Read() after Delete() error = %v, want ErrKeyNotFound", err)
+			}
+		})
+	}
+}
+
+func TestBackends_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := NewMemoryBackend()
+	dst := NewPlistDirBackend(t.TempDir())
+
+	src.Write(ctx, "com.apple.finder", "ShowPathbar", NewBoolValue(true))
+	src.Write(ctx, "com.apple.finder", "FXPreferredViewStyle", NewStringValue("clmv"))
+
+	data, err := src.Export(ctx, "com.apple.finder")
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if err := dst.Import(ctx, "com.apple.finder", data); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	got, err := dst.Read(ctx, "com.apple.finder", "FXPreferredViewStyle")
+	if err != nil || got.String() != "clmv" {
+		t.Errorf("Read() after Import() = %v, %v, want clmv", got, err)
+	}
+}
+
+func TestPlistDirBackend_GlobalDomainPath(t *testing.T) {
+	dir := t.TempDir()
+	b := NewPlistDirBackend(dir)
+
+	if err := b.Write(context.Background(), "NSGlobalDomain", "AppleShowAllExtensions", NewBoolValue(true)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ".GlobalPreferences.plist"))
+	if err != nil {
+		t.Fatalf("global domain file not written: %v", err)
+	}
+	decoded, format, err := plist.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("global domain file does not decode: %v", err)
+	}
+	if format != plist.FormatBinary {
+		t.Errorf("new domain file format = %v, want binary", format)
+	}
+	if decoded.(plist.Dict)["AppleShowAllExtensions"] != true {
+		t.Errorf("global domain file missing key: %#v", decoded)
+	}
+}
+
+func TestPlistDirBackend_PreservesFiles(t *testing.T) {
+	dir := t.TempDir()
+	b := NewPlistDirBackend(dir)
+	ctx := context.Background()
+
+	original, _ := plist.MarshalXML(plist.Dict{"autohide": true, "tilesize": int64(48)})
+	path := filepath.Join(dir, "com.apple.dock.plist")
+	if err := os.WriteFile(path, original, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Write(ctx, "com.apple.dock", "autohide", NewBoolValue(true)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	exported, err := b.Export(ctx, "com.apple.dock")
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if !bytes.Equal(exported, original) {
+		t.Errorf("unchanged write rewrote the file:\n%s", exported)
+	}
+
+	if err := b.Write(ctx, "com.apple.dock", "autohide", NewBoolValue(false)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if plist.DetectFormat(data) != plist.FormatXML {
+		t.Errorf("write changed the file format from xml")
+	}
+
+	if err := b.Import(ctx, "com.apple.dock", original); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if !bytes.Equal(data, original) {
+		t.Errorf("Import() did not restore the original bytes")
+	}
+}
+
+func TestRawExecute_UsesBackend(t *testing.T) {
+	mem := NewMemoryBackend()
+	withBackend(t, mem)
+	ctx := context.Background()
+
+	mem.Write(ctx, "com.apple.dock", "workspaces-auto-swoosh", &IntValue{Value: 1})
+
+	reset := true
+	raw := Raw{
+		"com.apple.Music.userWantsPlaybackNotifications": RawEntry{RawValue: false, Type: TypeBool},
+		"com.apple.dock.workspaces-auto-swoosh":          RawEntry{RawValue: int64(0), Type: TypeInt, Reset: &reset},
+	}
+
+	if err := raw.Execute(ctx, nopLogger{}); err != nil {
+		t.Fatalf("Raw.Execute() error = %v", err)
+	}
+
+	got, err := mem.Read(ctx, "com.apple.Music", "userWantsPlaybackNotifications")
+	if err != nil || got.String() != "false" {
+		t.Errorf("raw bool not written: %v, %v", got, err)
+	}
+	if _, err := mem.Read(ctx, "com.apple.dock", "workspaces-auto-swoosh"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("raw reset did not delete key: %v", err)
+	}
+}
+
+func TestCommand_CreateDir(t *testing.T) {
+	mem := NewMemoryBackend()
+	withBackend(t, mem)
+	ctx := context.Background()
+
+	location := filepath.Join(t.TempDir(), "Desktop", "Screenshots")
+	cmd := Command{Domain: "com.apple.screencapture", Key: "location", Value: NewStringValue(location), CreateDir: location}
+	batch := &BatchExecutor{commands: []Command{cmd}}
+
+	changes, err := batch.Plan(ctx)
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if changes[0].Kind != ChangeWrite || !changes[0].CreateDir {
+		t.Errorf("Plan() = %s, CreateDir %v, want write and create the directory", changes[0].Kind, changes[0].CreateDir)
+	}
+
+	if _, err := batch.Apply(ctx, nopLogger{}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if exists, _ := mem.DirExists(ctx, location); !exists {
+		t.Errorf("Apply() did not create %s in the backend", location)
+	}
+	if _, err := os.Stat(location); !os.IsNotExist(err) {
+		t.Errorf("Apply() created %s on the host: %v", location, err)
+	}
+	if got, err := mem.Read(ctx, "com.apple.screencapture", "location"); err != nil || got.String() != location {
+		t.Errorf("location = %v, %v, want %s", got, err, location)
+	}
+
+	// The directory is created again when it went missing, even though the
+	// key is unchanged.
+	mem.dirs = make(map[string]bool)
+	changes, err = batch.Plan(ctx)
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if changes[0].Kind != ChangeNone || !changes[0].CreateDir {
+		t.Errorf("Plan() = %s, CreateDir %v, want none and create the directory", changes[0].Kind, changes[0].CreateDir)
+	}
+	result, err := batch.Apply(ctx, nopLogger{})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if exists, _ := mem.DirExists(ctx, location); !exists || result.Changed != 1 {
+		t.Errorf("Apply() = %s, directory created %v, want it recreated", result, exists)
+	}
+
+	result, err = batch.Apply(ctx, nopLogger{})
+	if err != nil || result.Changed != 0 {
+		t.Errorf("Apply() = %s, %v, want nothing to do", result, err)
+	}
+}
+
+func TestPlistDirBackend_CreateDir(t *testing.T) {
+	root := t.TempDir()
+	withBackend(t, NewPlistDirBackend(root))
+	ctx := context.Background()
+
+	location := "/Users/ana/Screenshots"
+	cmd := Command{Domain: "com.apple.screencapture", Key: "location", Value: NewStringValue(location), CreateDir: location}
+	if result, err := (&BatchExecutor{commands: []Command{cmd}}).Apply(ctx, nopLogger{}); err != nil || result.Changed != 1 {
+		t.Fatalf("Apply() = %s, %v, want one change", result, err)
+	}
+	if info, err := os.Stat(filepath.Join(root, "Directories", location)); err != nil || !info.IsDir() {
+		t.Errorf("Apply() did not create %s below the directory: %v", location, err)
+	}
+
+	// A later run finds the directory.
+	withBackend(t, NewPlistDirBackend(root))
+	result, err := (&BatchExecutor{commands: []Command{cmd}}).Apply(ctx, nopLogger{})
+	if err != nil || result.Changed != 0 {
+		t.Errorf("second Apply() = %s, %v, want nothing to do", result, err)
+	}
+}
+
+func TestCLIBackend_MakeDir(t *testing.T) {
+	ctx := context.Background()
+	backend := NewCLIBackend()
+	dir := filepath.Join(t.TempDir(), "Desktop", "Screenshots")
+
+	if exists, err := backend.DirExists(ctx, dir); err != nil || exists {
+		t.Fatalf("DirExists() = %v, %v, want false", exists, err)
+	}
+	if err := backend.MakeDir(ctx, dir); err != nil {
+		t.Fatalf("MakeDir() error = %v", err)
+	}
+	if exists, err := backend.DirExists(ctx, dir); err != nil || !exists {
+		t.Errorf("DirExists() = %v, %v, want true", exists, err)
+	}
+}
+
+func TestKillallExecutor_UsesBackend(t *testing.T) {
+	mem := NewMemoryBackend()
+	withBackend(t, mem)
+	ctx := context.Background()
+
+	if err := NewKillallExecutor("Dock").Execute(ctx); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if err := NewKillallExecutor("Safari").ExecuteIfRunning(ctx); err != nil {
+		t.Fatalf("ExecuteIfRunning() error = %v", err)
+	}
+	mem.SetProcessRunning("Safari", true)
+	if err := NewKillallExecutor("Safari").ExecuteIfRunning(ctx); err != nil {
+		t.Fatalf("ExecuteIfRunning() error = %v", err)
+	}
+
+	got := mem.Restarted()
+	if len(got) != 2 || got[0] != "Dock" || got[1] != "Safari" {
+		t.Errorf("Restarted() = %v, want [Dock Safari]", got)
+	}
+}
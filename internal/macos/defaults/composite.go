@@ -0,0 +1,171 @@
+package defaults
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArrayValue is an ordered list of values, such as AppleLanguages or the
+// Dock's persistent-apps.
+type ArrayValue struct {
+	Values []Value
+}
+
+func NewArrayValue(values ...Value) *ArrayValue {
+	return &ArrayValue{Values: values}
+}
+
+func (a *ArrayValue) Type() ValueType {
+	return ArrayType
+}
+
+// String renders the array in the old-style plist syntax `defaults read`
+// prints, e.g. ("en-US", "de").
+func (a *ArrayValue) String() string {
+	parts := make([]string, len(a.Values))
+	for i, v := range a.Values {
+		parts[i] = elementString(v)
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+func (a *ArrayValue) Validate() error {
+	for i, v := range a.Values {
+		if err := validateElement(v); err != nil {
+			return fmt.Errorf("index %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// DictValue is a dictionary of values, such as NSUserKeyEquivalents.
+type DictValue struct {
+	Values map[string]Value
+}
+
+func NewDictValue(values map[string]Value) *DictValue {
+	if values == nil {
+		values = make(map[string]Value)
+	}
+	return &DictValue{Values: values}
+}
+
+func (d *DictValue) Type() ValueType {
+	return DictType
+}
+
+// Keys returns the dictionary keys in sorted order.
+func (d *DictValue) Keys() []string {
+	keys := make([]string, 0, len(d.Values))
+	for k := range d.Values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String renders the dictionary in old-style plist syntax with sorted keys,
+// e.g. {"Hide" = "@h"; }.
+func (d *DictValue) String() string {
+	var b strings.Builder
+	b.WriteString("{")
+	for _, k := range d.Keys() {
+		fmt.Fprintf(&b, "%s = %s; ", strconv.Quote(k), elementString(d.Values[k]))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func (d *DictValue) Validate() error {
+	for _, k := range d.Keys() {
+		if err := validateElement(d.Values[k]); err != nil {
+			return fmt.Errorf("key %q: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// DataValue is raw binary data.
+type DataValue struct {
+	Value []byte
+}
+
+func NewDataValue(value []byte) *DataValue {
+	return &DataValue{Value: value}
+}
+
+func (d *DataValue) Type() ValueType {
+	return DataType
+}
+
+// String renders the data as hex in angle brackets, e.g. <0a1b>.
+func (d *DataValue) String() string {
+	return "<" + hex.EncodeToString(d.Value) + ">"
+}
+
+func (d *DataValue) Validate() error {
+	return nil
+}
+
+// DateValue is a point in time. Plists store dates in UTC.
+type DateValue struct {
+	Value time.Time
+}
+
+func NewDateValue(value time.Time) *DateValue {
+	return &DateValue{Value: value.UTC()}
+}
+
+func (d *DateValue) Type() ValueType {
+	return DateType
+}
+
+func (d *DateValue) String() string {
+	return d.Value.UTC().Format(time.RFC3339)
+}
+
+func (d *DateValue) Validate() error {
+	if d.Value.IsZero() {
+		return fmt.Errorf("date value cannot be zero")
+	}
+	return nil
+}
+
+// IsCollection reports whether t is one of the types `defaults write` has no
+// plain flag for and that is therefore written as a plist fragment.
+func IsCollection(t ValueType) bool {
+	switch t {
+	case ArrayType, DictType, DataType, DateType:
+		return true
+	}
+	return false
+}
+
+// validateElement checks a value nested in an array or dict. Empty strings are
+// valid plist strings there, and reset values have no meaning.
+func validateElement(v Value) error {
+	if v == nil {
+		return fmt.Errorf("value cannot be nil")
+	}
+	if resetter, ok := v.(ResetValue); ok && resetter.IsReset() {
+		return fmt.Errorf("reset is not allowed inside an array or dict")
+	}
+	if _, ok := v.(*StringValue); ok {
+		return nil
+	}
+	return v.Validate()
+}
+
+func elementString(v Value) string {
+	if v == nil {
+		return "<nil>"
+	}
+	if v.Type() == StringType {
+		return strconv.Quote(v.String())
+	}
+	return v.String()
+}
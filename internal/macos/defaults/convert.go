@@ -0,0 +1,344 @@
+package defaults
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ToNative converts a Value into the Go representation used by the plist
+// package.
+func ToNative(v Value) (any, error) {
+	if resetter, ok := v.(ResetValue); ok && resetter.IsReset() {
+		return nil, fmt.Errorf("reset value has no native representation")
+	}
+
+	switch t := v.(type) {
+	case *ArrayValue:
+		out := make([]any, len(t.Values))
+		for i, item := range t.Values {
+			n, err := ToNative(item)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			out[i] = n
+		}
+		return out, nil
+	case *DictValue:
+		out := make(map[string]any, len(t.Values))
+		for k, item := range t.Values {
+			n, err := ToNative(item)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", k, err)
+			}
+			out[k] = n
+		}
+		return out, nil
+	case *DataValue:
+		return bytes.Clone(t.Value), nil
+	case *DateValue:
+		return t.Value.UTC(), nil
+	}
+
+	switch v.Type() {
+	case BoolType:
+		return v.String() == "true", nil
+	case StringType:
+		return v.String(), nil
+	case IntType:
+		i, err := strconv.ParseInt(v.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int value %q: %w", v.String(), err)
+		}
+		return i, nil
+	case FloatType:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float value %q: %w", v.String(), err)
+		}
+		return f, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type: %s", v.Type())
+	}
+}
+
+// FromNative converts a decoded plist value into a Value.
+func FromNative(n any) (Value, error) {
+	switch t := n.(type) {
+	case bool:
+		return NewBoolValue(t), nil
+	case string:
+		return &StringValue{Value: t}, nil
+	case int64:
+		return &IntValue{Value: t}, nil
+	case float64:
+		return &FloatValue{Value: t, Precision: -1}, nil
+	case []any:
+		values := make([]Value, len(t))
+		for i, item := range t {
+			v, err := FromNative(item)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			values[i] = v
+		}
+		return NewArrayValue(values...), nil
+	case map[string]any:
+		values := make(map[string]Value, len(t))
+		for k, item := range t {
+			v, err := FromNative(item)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", k, err)
+			}
+			values[k] = v
+		}
+		return NewDictValue(values), nil
+	case []byte:
+		return NewDataValue(t), nil
+	case time.Time:
+		return NewDateValue(t), nil
+	default:
+		return nil, fmt.Errorf("unsupported plist type %T", n)
+	}
+}
+
+// toInt64 converts a decoded integer without truncation.
+func toInt64(v any) (int64, error) {
+	switch t := v.(type) {
+	case int:
+		return int64(t), nil
+	case int8:
+		return int64(t), nil
+	case int16:
+		return int64(t), nil
+	case int32:
+		return int64(t), nil
+	case int64:
+		return t, nil
+	case uint:
+		return toInt64(uint64(t))
+	case uint8:
+		return int64(t), nil
+	case uint16:
+		return int64(t), nil
+	case uint32:
+		return int64(t), nil
+	case uint64:
+		if t > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows int64", t)
+		}
+		return int64(t), nil
+	default:
+		return 0, fmt.Errorf("cannot convert %T to int", v)
+	}
+}
+
+// maxExactFloatInt is the largest magnitude below which every integer has an
+// exact float64 representation.
+const maxExactFloatInt = 1 << 53
+
+// toFloat64 converts a decoded float, or an integer that converts exactly.
+func toFloat64(v any) (float64, error) {
+	switch t := v.(type) {
+	case float64:
+		return t, nil
+	case float32:
+		// Widen via the shortest float32 representation, otherwise 0.1
+		// becomes 0.10000000149011612.
+		return strconv.ParseFloat(strconv.FormatFloat(float64(t), 'g', -1, 32), 64)
+	}
+
+	i, err := toInt64(v)
+	if err != nil {
+		return 0, fmt.Errorf("cannot convert %T to float", v)
+	}
+	if i > maxExactFloatInt || i < -maxExactFloatInt {
+		return 0, fmt.Errorf("%d cannot be represented exactly as a float", i)
+	}
+	return float64(i), nil
+}
+
+// localDateTime is implemented by the TOML local date and date-time types,
+// which carry no zone. They are read as UTC.
+type localDateTime interface {
+	AsTime(zone *time.Location) time.Time
+}
+
+// fromTOML converts a decoded TOML value into a Value. Arrays and inline
+// tables become ArrayValue and DictValue, and dates become DateValue.
+func fromTOML(v any) (Value, error) {
+	n, err := tomlToNative(v)
+	if err != nil {
+		return nil, err
+	}
+	return FromNative(n)
+}
+
+func tomlToNative(v any) (any, error) {
+	switch t := v.(type) {
+	case []any:
+		out := make([]any, len(t))
+		for i, item := range t {
+			n, err := tomlToNative(item)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			out[i] = n
+		}
+		return out, nil
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, item := range t {
+			n, err := tomlToNative(item)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", k, err)
+			}
+			out[k] = n
+		}
+		return out, nil
+	case int:
+		return int64(t), nil
+	case localDateTime:
+		return t.AsTime(time.UTC), nil
+	case bool, string, int64, float64, []byte, time.Time:
+		return t, nil
+	default:
+		return nil, fmt.Errorf("unsupported TOML value %T", v)
+	}
+}
+
+// parseData accepts hex, optionally wrapped in angle brackets and separated
+// by spaces as `defaults read` prints it.
+func parseData(s string) ([]byte, error) {
+	s = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "<"), ">")
+	s = strings.ReplaceAll(s, " ", "")
+	return hex.DecodeString(s)
+}
+
+// parseDate accepts an RFC 3339 timestamp or a plain date.
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected RFC 3339 (2006-01-02T15:04:05Z) or 2006-01-02", s)
+}
+
+// Equal reports whether two values would be stored identically.
+func Equal(a, b Value) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	na, errA := ToNative(a)
+	nb, errB := ToNative(b)
+	if errA != nil || errB != nil {
+		return a.String() == b.String()
+	}
+	return nativeEqual(na, nb)
+}
+
+func nativeEqual(a, b any) bool {
+	switch ta := a.(type) {
+	case []any:
+		tb, ok := b.([]any)
+		if !ok || len(ta) != len(tb) {
+			return false
+		}
+		for i := range ta {
+			if !nativeEqual(ta[i], tb[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		tb, ok := b.(map[string]any)
+		if !ok || len(ta) != len(tb) {
+			return false
+		}
+		for k, va := range ta {
+			vb, ok := tb[k]
+			if !ok || !nativeEqual(va, vb) {
+				return false
+			}
+		}
+		return true
+	case []byte:
+		tb, ok := b.([]byte)
+		return ok && bytes.Equal(ta, tb)
+	case time.Time:
+		tb, ok := b.(time.Time)
+		return ok && ta.Equal(tb)
+	default:
+		return a == b
+	}
+}
+
+// Coerce converts v to type t, e.g. true to the int 1 for a key that the
+// owning app reads as an int. Only bool, int, float and string values can be
+// converted.
+func Coerce(v Value, t ValueType) (Value, error) {
+	if v.Type() == t {
+		return v, nil
+	}
+
+	n, err := ToNative(v)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t {
+	case BoolType:
+		switch n := n.(type) {
+		case int64:
+			if n == 0 || n == 1 {
+				return NewBoolValue(n == 1), nil
+			}
+		case string:
+			if b, err := strconv.ParseBool(n); err == nil {
+				return NewBoolValue(b), nil
+			}
+		}
+	case IntType:
+		switch n := n.(type) {
+		case bool:
+			if n {
+				return &IntValue{Value: 1}, nil
+			}
+			return &IntValue{Value: 0}, nil
+		case float64:
+			if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+				return &IntValue{Value: int64(n)}, nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+				return &IntValue{Value: i}, nil
+			}
+		}
+	case FloatType:
+		switch n := n.(type) {
+		case int64:
+			if f, err := toFloat64(n); err == nil {
+				return &FloatValue{Value: f, Precision: -1}, nil
+			}
+		case string:
+			if f, err := strconv.ParseFloat(n, 64); err == nil {
+				return &FloatValue{Value: f, Precision: -1}, nil
+			}
+		}
+	case StringType:
+		switch n.(type) {
+		case bool, int64, float64:
+			return NewStringValue(v.String()), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot convert %s value %s to %s", v.Type().Name(), v, t.Name())
+}
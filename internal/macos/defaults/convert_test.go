@@ -0,0 +1,154 @@
+package defaults
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+func TestRaw_Batch_Collections(t *testing.T) {
+	const doc = `
+["NSGlobalDomain.AppleLanguages"]
+type = "array"
+value = ["en-US", "de"]
+
+["NSGlobalDomain.NSUserKeyEquivalents"]
+type = "dict"
+value = { "Hide Safari" = "@h", Nested = { Level = 2 } }
+
+["com.example.app.Token"]
+type = "data"
+value = "<0a1b ff>"
+
+["com.example.app.Installed"]
+type = "date"
+value = 2024-03-01T12:00:00Z
+
+["com.example.app.Reviewed"]
+type = "date"
+value = 2024-03-01
+
+["com.example.app.Recent"]
+type = "array"
+value = "default"
+`
+	var raw Raw
+	if err := toml.Unmarshal([]byte(doc), &raw); err != nil {
+		t.Fatalf("toml.Unmarshal() error = %v", err)
+	}
+	if err := raw.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	batch, err := raw.Batch()
+	if err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+
+	want := map[string]string{
+		"NSGlobalDomain AppleLanguages":       `("en-US", "de")`,
+		"NSGlobalDomain NSUserKeyEquivalents": `{"Hide Safari" = "@h"; "Nested" = {"Level" = 2; }; }`,
+		"com.example.app Token":               `<0a1bff>`,
+		"com.example.app Installed":           `2024-03-01T12:00:00Z`,
+		"com.example.app Reviewed":            `2024-03-01T00:00:00Z`,
+		"com.example.app Recent":              `default`,
+	}
+	commands := batch.Commands()
+	if len(commands) != len(want) {
+		t.Fatalf("Batch() produced %d commands, want %d", len(commands), len(want))
+	}
+	for _, cmd := range commands {
+		id := cmd.Domain + " " + cmd.Key
+		if got := cmd.Value.String(); got != want[id] {
+			t.Errorf("%s = %s, want %s", id, got, want[id])
+		}
+	}
+}
+
+func TestRawEntry_Validate_Collections(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   RawEntry
+		wantErr bool
+	}{
+		{name: "array", entry: RawEntry{Type: TypeArray, RawValue: []any{"a", int64(1)}}},
+		{name: "array from string", entry: RawEntry{Type: TypeArray, RawValue: "a"}, wantErr: true},
+		{name: "dict from array", entry: RawEntry{Type: TypeDict, RawValue: []any{"a"}}, wantErr: true},
+		{name: "data not hex", entry: RawEntry{Type: TypeData, RawValue: "xyz"}, wantErr: true},
+		{name: "date string", entry: RawEntry{Type: TypeDate, RawValue: "2024-03-01T12:00:00+02:00"}},
+		{name: "date invalid", entry: RawEntry{Type: TypeDate, RawValue: "March"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.entry.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEqual_Collections(t *testing.T) {
+	date := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		a, b Value
+		want bool
+	}{
+		{
+			name: "equal arrays",
+			a:    NewArrayValue(NewStringValue("a"), &IntValue{Value: 1}),
+			b:    NewArrayValue(NewStringValue("a"), &IntValue{Value: 1}),
+			want: true,
+		},
+		{
+			name: "element order",
+			a:    NewArrayValue(NewStringValue("a"), NewStringValue("b")),
+			b:    NewArrayValue(NewStringValue("b"), NewStringValue("a")),
+		},
+		{
+			name: "int and float elements",
+			a:    NewArrayValue(&IntValue{Value: 1}),
+			b:    NewArrayValue(&FloatValue{Value: 1, Precision: -1}),
+		},
+		{
+			name: "dicts",
+			a:    NewDictValue(map[string]Value{"a": NewBoolValue(true)}),
+			b:    NewDictValue(map[string]Value{"a": NewBoolValue(true)}),
+			want: true,
+		},
+		{
+			name: "dates in different zones",
+			a:    NewDateValue(date),
+			b:    &DateValue{Value: date.In(time.FixedZone("CEST", 2*60*60))},
+			want: true,
+		},
+		{
+			name: "data",
+			a:    NewDataValue([]byte{1, 2}),
+			b:    NewDataValue([]byte{1, 3}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Equal(tt.a, tt.b); got != tt.want {
+				t.Errorf("Equal(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteFragment(t *testing.T) {
+	value := NewArrayValue(NewStringValue("en-US"), NewDictValue(map[string]Value{"on": NewBoolValue(true)}))
+	got, err := writeFragment(value)
+	if err != nil {
+		t.Fatalf("writeFragment() error = %v", err)
+	}
+
+	want := "<array>\n\t<string>en-US</string>\n\t<dict>\n\t\t<key>on</key>\n\t\t<true/>\n\t</dict>\n</array>"
+	if got != want {
+		t.Errorf("writeFragment() = %q, want %q", got, want)
+	}
+}
@@ -3,8 +3,6 @@ package defaults
 import (
 	"context"
 	"fmt"
-	"os/exec"
-	"strings"
 
 	"github.com/RATIU5/fjrd/internal/errors"
 )
@@ -25,6 +23,36 @@ type Command struct {
 	Domain string
 	Key    string
 	Value  Value
+	// Strategy combines Value with the current value. The zero value
+	// replaces it.
+	Strategy Strategy
+	// Host selects ByHost preferences. The zero value is the regular
+	// per-user domain.
+	Host Host
+	// Scope selects the system-wide domain instead of the user's. System
+	// writes need privileges.
+	Scope Scope
+	// NativeType is the type the owning app reads the key as, if the
+	// section knows it. The value is converted to it before writing, and a
+	// key stored with another type is corrected without a warning.
+	NativeType ValueType
+	// CreateDir is a directory that BatchExecutor.Apply creates through the
+	// backend whenever it is missing, for keys that name a directory the
+	// owning app expects to exist.
+	CreateDir string
+}
+
+// Name identifies the key in logs and plans, e.g.
+// "com.apple.screensaver idleTime (current host)".
+func (c *Command) Name() string {
+	switch {
+	case c.Scope != UserScope:
+		return fmt.Sprintf("%s %s (%s)", c.Domain, c.Key, c.Scope)
+	case c.Host != AnyHost:
+		return fmt.Sprintf("%s %s (%s)", c.Domain, c.Key, c.Host)
+	default:
+		return c.Domain + " " + c.Key
+	}
 }
 
 func (c *Command) Execute(ctx context.Context, log interface {
@@ -35,40 +63,43 @@ func (c *Command) Execute(ctx context.Context, log interface {
 		return errors.NewValidationError(c.Key, c.Value, "", err)
 	}
 
-	if resetter, ok := c.Value.(ResetValue); ok && resetter.IsReset() {
-		return c.executeReset(ctx, log)
+	if err := c.Host.Validate(); err != nil {
+		return errors.NewValidationError(c.Key, c.Host, "", err)
 	}
 
-	args := []string{"write", c.Domain, c.Key, string(c.Value.Type()), c.Value.String()}
-	cmd := exec.CommandContext(ctx, "defaults", args...)
+	if err := c.Scope.Validate(); err != nil {
+		return errors.NewValidationError(c.Key, c.Scope, "", err)
+	}
 
-	log.Debug("Executing defaults command",
+	backend, err := BackendFor(ctx, c.Scope, c.Host)
+	if err != nil {
+		return err
+	}
+
+	if resetter, ok := c.Value.(ResetValue); ok && resetter.IsReset() {
+		return c.executeReset(ctx, backend, log)
+	}
+
+	log.Debug("Writing default",
 		"domain", c.Domain,
 		"key", c.Key,
+		"host", string(c.Host),
+		"scope", c.Scope.String(),
 		"type", string(c.Value.Type()),
-		"value", c.Value.String(),
-		"command", fmt.Sprintf("defaults %s", strings.Join(args, " ")))
-
-	if err := cmd.Run(); err != nil {
-		return errors.NewExecutionError("defaults", args, err)
-	}
+		"value", c.Value.String())
 
-	return nil
+	return backend.Write(ctx, c.Domain, c.Key, c.Value)
 }
 
-func (c *Command) executeReset(ctx context.Context, log interface {
+func (c *Command) executeReset(ctx context.Context, backend Backend, log interface {
 	Info(string, ...any)
 	Debug(string, ...any)
 }) error {
-	args := []string{"delete", c.Domain, c.Key}
-	cmd := exec.CommandContext(ctx, "defaults", args...)
-
 	log.Debug("Resetting default to system value",
 		"domain", c.Domain,
-		"key", c.Key,
-		"command", fmt.Sprintf("defaults %s", strings.Join(args, " ")))
+		"key", c.Key)
 
-	if err := cmd.Run(); err != nil {
+	if err := backend.Delete(ctx, c.Domain, c.Key); err != nil {
 		log.Debug("Reset failed (key may not exist)", "error", err)
 	}
 
@@ -87,6 +118,16 @@ func (b *BatchExecutor) AddCommand(cmd Command) {
 	b.commands = append(b.commands, cmd)
 }
 
+func (b *BatchExecutor) Commands() []Command {
+	commands := make([]Command, len(b.commands))
+	copy(commands, b.commands)
+	return commands
+}
+
+func (b *BatchExecutor) Len() int {
+	return len(b.commands)
+}
+
 func (b *BatchExecutor) AddBool(domain, key string, value bool) {
 	b.AddCommand(Command{
 		Domain: domain,
@@ -133,14 +174,144 @@ func (b *BatchExecutor) Execute(ctx context.Context, log interface {
 	Info(string, ...any)
 	Debug(string, ...any)
 }) error {
+	_, err := b.Apply(ctx, log)
+	return err
+}
+
+// Apply compares every command against the current value and only runs the
+// ones that would change something. A missing directory named by a command is
+// created even when its key already holds the desired value.
+func (b *BatchExecutor) Apply(ctx context.Context, log interface {
+	Info(string, ...any)
+	Debug(string, ...any)
+}) (Result, error) {
+	var result Result
 	for _, cmd := range b.commands {
-		if err := cmd.Execute(ctx, log); err != nil {
-			return fmt.Errorf("batch execution failed: %w", err)
+		change, err := PlanCommand(ctx, cmd)
+		if err != nil {
+			result.Outcomes = append(result.Outcomes, Outcome{Change: Change{Command: cmd}, Err: err})
+			return result, fmt.Errorf("batch execution failed: %w", err)
+		}
+		if !change.Pending() {
+			log.Debug("Default already up to date", "domain", cmd.Domain, "key", cmd.Key)
+			result.Unchanged++
+			result.Outcomes = append(result.Outcomes, Outcome{Change: change})
+			continue
 		}
+
+		if change.CreateDir {
+			if err := createDir(ctx, cmd, log); err != nil {
+				result.Outcomes = append(result.Outcomes, Outcome{Change: change, Err: err})
+				return result, fmt.Errorf("batch execution failed: %w", err)
+			}
+		}
+		if change.Kind != ChangeNone {
+			if err := change.Command.Execute(ctx, log); err != nil {
+				result.Outcomes = append(result.Outcomes, Outcome{Change: change, Err: err})
+				return result, fmt.Errorf("batch execution failed: %w", err)
+			}
+		}
+		result.Changed++
+		result.Outcomes = append(result.Outcomes, Outcome{Change: change})
+	}
+	return result, nil
+}
+
+// createDir creates the directory cmd names through the backend of its key.
+func createDir(ctx context.Context, cmd Command, log interface {
+	Info(string, ...any)
+	Debug(string, ...any)
+}) error {
+	backend, err := BackendFor(ctx, cmd.Scope, cmd.Host)
+	if err != nil {
+		return err
+	}
+
+	log.Debug("Creating directory", "key", cmd.Key, "path", cmd.CreateDir)
+	if err := backend.MakeDir(ctx, cmd.CreateDir); err != nil {
+		return fmt.Errorf("failed to create %s for %s: %w", cmd.CreateDir, cmd.Name(), err)
 	}
 	return nil
 }
 
+// Outcome is what happened to a single command during Apply. Err is set if
+// reading the current value or writing the new one failed.
+type Outcome struct {
+	Change
+	Err error
+}
+
+// Result counts the keys a batch wrote or deleted and the keys it left alone
+// because they already had the desired value.
+type Result struct {
+	Changed   int
+	Unchanged int
+	Outcomes  []Outcome
+	// RolledBack is set when a failed atomic apply restored every key it
+	// had changed.
+	RolledBack bool
+}
+
+func (r *Result) Add(other Result) {
+	r.Changed += other.Changed
+	r.Unchanged += other.Unchanged
+	r.Outcomes = append(r.Outcomes, other.Outcomes...)
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%d changed, %d unchanged", r.Changed, r.Unchanged)
+}
+
+// Restart names a process that has to be restarted before written defaults
+// take effect.
+type Restart struct {
+	Process       string
+	OnlyIfRunning bool
+}
+
+// restartOrder is the order processes are restarted in at the end of a run.
+// Processes that are not listed follow in the order they were requested.
+var restartOrder = []string{"Dock", "Finder", "SystemUIServer", "Safari"}
+
+// CoalesceRestarts merges restart requests so that every process appears
+// once, sorted by restartOrder. A process is only restarted conditionally if
+// every request for it was conditional.
+func CoalesceRestarts(restarts []Restart) []Restart {
+	merged := make(map[string]*Restart)
+	var requested []string
+	for _, restart := range restarts {
+		if existing, ok := merged[restart.Process]; ok {
+			existing.OnlyIfRunning = existing.OnlyIfRunning && restart.OnlyIfRunning
+			continue
+		}
+		r := restart
+		merged[restart.Process] = &r
+		requested = append(requested, restart.Process)
+	}
+
+	coalesced := make([]Restart, 0, len(merged))
+	for _, process := range restartOrder {
+		if r, ok := merged[process]; ok {
+			coalesced = append(coalesced, *r)
+			delete(merged, process)
+		}
+	}
+	for _, process := range requested {
+		if r, ok := merged[process]; ok {
+			coalesced = append(coalesced, *r)
+		}
+	}
+	return coalesced
+}
+
+func (r Restart) Execute(ctx context.Context) error {
+	killall := NewKillallExecutor(r.Process)
+	if r.OnlyIfRunning {
+		return killall.ExecuteIfRunning(ctx)
+	}
+	return killall.Execute(ctx)
+}
+
 type KillallExecutor struct {
 	processName string
 }
@@ -150,23 +321,9 @@ func NewKillallExecutor(processName string) *KillallExecutor {
 }
 
 func (k *KillallExecutor) Execute(ctx context.Context) error {
-	args := []string{k.processName}
-	cmd := exec.CommandContext(ctx, "killall", args...)
-	if err := cmd.Run(); err != nil {
-		return errors.NewExecutionError("killall", args, err)
-	}
-	return nil
+	return GetBackend().RestartProcess(ctx, k.processName, false)
 }
 
 func (k *KillallExecutor) ExecuteIfRunning(ctx context.Context) error {
-	if !k.isProcessRunning(ctx) {
-		return nil
-	}
-	return k.Execute(ctx)
-}
-
-func (k *KillallExecutor) isProcessRunning(ctx context.Context) bool {
-	cmd := exec.CommandContext(ctx, "pgrep", "-x", k.processName)
-	err := cmd.Run()
-	return err == nil
+	return GetBackend().RestartProcess(ctx, k.processName, true)
 }
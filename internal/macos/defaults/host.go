@@ -0,0 +1,144 @@
+package defaults
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+)
+
+// Host selects whose preferences a command reads and writes. Settings such
+// as the screen saver idle time live in ~/Library/Preferences/ByHost and are
+// only honoured for the current machine.
+type Host string
+
+const (
+	// AnyHost is the regular per-user domain. It is the zero value.
+	AnyHost Host = ""
+	// CurrentHost is the ByHost domain of this machine, `defaults -currentHost`.
+	CurrentHost Host = "currentHost"
+)
+
+// Any other Host value names a host, like `defaults -host <name>`.
+
+func (h Host) String() string {
+	switch h {
+	case AnyHost:
+		return "any host"
+	case CurrentHost:
+		return "current host"
+	default:
+		return "host " + string(h)
+	}
+}
+
+func (h Host) Validate() error {
+	if strings.ContainsAny(string(h), "/ \t\n") {
+		return fmt.Errorf("invalid host %q", string(h))
+	}
+	return nil
+}
+
+// Args returns the defaults flags that select the host.
+func (h Host) Args() []string {
+	switch h {
+	case AnyHost:
+		return nil
+	case CurrentHost:
+		return []string{"-currentHost"}
+	default:
+		return []string{"-host", string(h)}
+	}
+}
+
+// HostBackend is implemented by backends that can store per-host
+// preferences.
+type HostBackend interface {
+	// ForHost returns a view of the backend that reads and writes host's
+	// preferences. host is never AnyHost.
+	ForHost(ctx context.Context, host Host) (Backend, error)
+}
+
+// HostUUIDProvider returns the hardware UUID that names this machine's ByHost
+// preference files.
+type HostUUIDProvider interface {
+	HostUUID(ctx context.Context) (string, error)
+}
+
+// IORegHostUUID reads IOPlatformUUID from ioreg.
+type IORegHostUUID struct{}
+
+var platformUUIDPattern = regexp.MustCompile(`"IOPlatformUUID" = "([0-9A-Fa-f-]+)"`)
+
+func (IORegHostUUID) HostUUID(ctx context.Context) (string, error) {
+	args := []string{"-rd1", "-c", "IOPlatformExpertDevice"}
+	output, err := exec.CommandContext(ctx, "ioreg", args...).Output()
+	if err != nil {
+		return "", errors.NewExecutionError("ioreg", args, err)
+	}
+
+	match := platformUUIDPattern.FindSubmatch(output)
+	if match == nil {
+		return "", fmt.Errorf("IOPlatformUUID not found in ioreg output")
+	}
+	return string(match[1]), nil
+}
+
+// StaticHostUUID always returns the same UUID. It is used in tests and for
+// preference directories copied from another machine.
+type StaticHostUUID string
+
+func (s StaticHostUUID) HostUUID(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+var (
+	hostUUIDMu     sync.RWMutex
+	activeHostUUID HostUUIDProvider = IORegHostUUID{}
+)
+
+// SetHostUUIDProvider replaces the provider used to resolve CurrentHost.
+func SetHostUUIDProvider(p HostUUIDProvider) {
+	hostUUIDMu.Lock()
+	defer hostUUIDMu.Unlock()
+	activeHostUUID = p
+}
+
+func GetHostUUIDProvider() HostUUIDProvider {
+	hostUUIDMu.RLock()
+	defer hostUUIDMu.RUnlock()
+	return activeHostUUID
+}
+
+// resolveHost returns the name host's ByHost files carry: the hardware UUID
+// for CurrentHost, or the host name itself.
+func resolveHost(ctx context.Context, host Host) (string, error) {
+	if host != CurrentHost {
+		return string(host), nil
+	}
+
+	uuid, err := GetHostUUIDProvider().HostUUID(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve current host: %w", err)
+	}
+	return uuid, nil
+}
+
+func newByHostBackend(ctx context.Context, backend Backend, host Host) (Backend, error) {
+	name, err := resolveHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	// ~/Library/Preferences/ByHost/<domain>.<host>.plist
+	return &mappedBackend{Backend: backend, domain: func(domain string) string {
+		if isGlobalDomain(domain) {
+			domain = globalDomainFile
+		}
+		return "ByHost/" + domain + "." + name
+	}}, nil
+}
@@ -0,0 +1,101 @@
+package defaults
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+)
+
+const testHostUUID = "00000000-0000-0000-0000-0000000000AA"
+
+func withHostUUID(t *testing.T, uuid string) {
+	t.Helper()
+	previous := GetHostUUIDProvider()
+	SetHostUUIDProvider(StaticHostUUID(uuid))
+	t.Cleanup(func() { SetHostUUIDProvider(previous) })
+}
+
+func TestHost_Args(t *testing.T) {
+	tests := []struct {
+		host Host
+		want []string
+	}{
+		{host: AnyHost, want: nil},
+		{host: CurrentHost, want: []string{"-currentHost"}},
+		{host: "build-01", want: []string{"-host", "build-01"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host.String(), func(t *testing.T) {
+			backend, err := NewCLIBackend().ForHost(context.Background(), tt.host)
+			if err != nil {
+				t.Fatalf("ForHost() error = %v", err)
+			}
+			got := backend.(*CLIBackend).defaultsArgs("delete", "com.apple.screensaver", "idleTime")
+			want := append(slices.Clone(tt.want), "delete", "com.apple.screensaver", "idleTime")
+			if !slices.Equal(got, want) {
+				t.Errorf("defaultsArgs() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPlistDirBackend_ByHost(t *testing.T) {
+	withHostUUID(t, testHostUUID)
+	dir := t.TempDir()
+	withBackend(t, NewPlistDirBackend(dir))
+	ctx := context.Background()
+
+	commands := []Command{
+		{Domain: "com.apple.screensaver", Key: "idleTime", Value: &IntValue{Value: 300}, Host: CurrentHost},
+		{Domain: "NSGlobalDomain", Key: "com.apple.mouse.tapBehavior", Value: &IntValue{Value: 1}, Host: CurrentHost},
+	}
+	if _, err := (&BatchExecutor{commands: commands}).Apply(ctx, nopLogger{}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	for _, name := range []string{"com.apple.screensaver." + testHostUUID, ".GlobalPreferences." + testHostUUID} {
+		if _, err := os.Stat(filepath.Join(dir, "ByHost", name+".plist")); err != nil {
+			t.Errorf("ByHost file %s not written: %v", name, err)
+		}
+	}
+
+	if _, err := GetBackend().Read(ctx, "com.apple.screensaver", "idleTime"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Read() from any-host domain error = %v, want ErrKeyNotFound", err)
+	}
+
+	change, err := PlanCommand(ctx, commands[0])
+	if err != nil {
+		t.Fatalf("PlanCommand() error = %v", err)
+	}
+	if change.Kind != ChangeNone {
+		t.Errorf("PlanCommand() after Apply() kind = %s, want none", change.Kind)
+	}
+}
+
+func TestMemoryBackend_NamedHost(t *testing.T) {
+	withHostUUID(t, testHostUUID)
+	mem := NewMemoryBackend()
+	withBackend(t, mem)
+	ctx := context.Background()
+
+	cmd := Command{Domain: "com.apple.screensaver", Key: "idleTime", Value: &IntValue{Value: 60}, Host: "build-01"}
+	if err := cmd.Execute(ctx, nopLogger{}); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	current, err := BackendFor(ctx, UserScope, CurrentHost)
+	if err != nil {
+		t.Fatalf("BackendFor() error = %v", err)
+	}
+	if _, err := current.Read(ctx, "com.apple.screensaver", "idleTime"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Read() from current host error = %v, want ErrKeyNotFound", err)
+	}
+	if got, err := mem.Read(ctx, "ByHost/com.apple.screensaver.build-01", "idleTime"); err != nil || got.String() != "60" {
+		t.Errorf("named host value = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,238 @@
+package defaults
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+)
+
+// A section field names the preference it is written to in a defaults tag:
+//
+//	Autohide *bool `toml:"autohide,omitempty" defaults:"domain=com.apple.dock,key=autohide,restart=Dock"`
+//
+// The tag is a comma-separated list of options:
+//
+//	domain=<domain>  preferences domain of the key, required
+//	key=<key>        key within the domain, required
+//	restart=<name>   process to restart after the key changed, may be repeated
+//	if-running       only restart the processes if they are running
+//	invert           write the negation of a bool field
+//	native           the field has the type the owning app reads the key as,
+//	                 see Command.NativeType
+//
+// Tagged fields are pointers, nil when not configured, to a bool, integer,
+// float or string type. A type with a Names method is an enum and is written
+// as its String. Fields without a defaults tag are left to the section.
+
+// FieldMapping maps a section field onto a preference.
+type FieldMapping struct {
+	// Name is the field's TOML key.
+	Name     string
+	Domain   string
+	Key      string
+	Restarts []Restart
+	Invert   bool
+	Native   bool
+
+	index int
+}
+
+// Mapping holds the field mappings of a section struct, in field order.
+type Mapping struct {
+	Fields []FieldMapping
+}
+
+// names is implemented by enum field types.
+type names interface {
+	Names() []string
+}
+
+var mappings sync.Map
+
+// MappingOf returns the mapping of config, a pointer to a section struct,
+// and an empty mapping for pointers to other types. Mappings are parsed once
+// per type. A malformed tag panics, as it can only be a programming error.
+func MappingOf(config any) *Mapping {
+	typ := reflect.TypeOf(config).Elem()
+	if m, ok := mappings.Load(typ); ok {
+		return m.(*Mapping)
+	}
+	m, _ := mappings.LoadOrStore(typ, parseMapping(typ))
+	return m.(*Mapping)
+}
+
+func parseMapping(typ reflect.Type) *Mapping {
+	m := &Mapping{}
+	if typ.Kind() != reflect.Struct {
+		return m
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, ok := field.Tag.Lookup("defaults")
+		if !ok {
+			continue
+		}
+		f, err := parseFieldMapping(field, tag)
+		if err != nil {
+			panic(fmt.Sprintf("invalid defaults tag %q on field %s.%s: %v", tag, typ.Name(), field.Name, err))
+		}
+		f.index = i
+		m.Fields = append(m.Fields, f)
+	}
+	return m
+}
+
+func parseFieldMapping(field reflect.StructField, tag string) (FieldMapping, error) {
+	name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+	f := FieldMapping{Name: name}
+	onlyIfRunning := false
+	for _, option := range strings.Split(tag, ",") {
+		option, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+		switch option {
+		case "domain":
+			f.Domain = value
+		case "key":
+			f.Key = value
+		case "restart":
+			f.Restarts = append(f.Restarts, Restart{Process: value})
+		case "if-running":
+			onlyIfRunning = true
+		case "invert":
+			f.Invert = true
+		case "native":
+			f.Native = true
+		default:
+			return f, fmt.Errorf("unknown option %q", option)
+		}
+	}
+	for i := range f.Restarts {
+		f.Restarts[i].OnlyIfRunning = onlyIfRunning
+	}
+
+	switch {
+	case f.Name == "":
+		return f, fmt.Errorf("field has no toml key")
+	case f.Domain == "" || f.Key == "":
+		return f, fmt.Errorf("domain and key are required")
+	case field.Type.Kind() != reflect.Pointer:
+		return f, fmt.Errorf("field must be a pointer")
+	}
+	elem := field.Type.Elem()
+	if f.Invert && elem.Kind() != reflect.Bool {
+		return f, fmt.Errorf("invert needs a bool field")
+	}
+	if _, ok := reflect.Zero(elem).Interface().(names); ok {
+		if _, ok := reflect.Zero(elem).Interface().(fmt.Stringer); !ok && elem.Kind() != reflect.String {
+			return f, fmt.Errorf("enum type %s has no String method", elem)
+		}
+		return f, nil
+	}
+	switch elem.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64, reflect.String:
+		return f, nil
+	}
+	return f, fmt.Errorf("unsupported type %s", elem)
+}
+
+// Command returns the command that writes value, the field's value.
+func (f FieldMapping) Command(value reflect.Value) (Command, error) {
+	cmd := Command{Domain: f.Domain, Key: f.Key}
+	if enum, ok := value.Interface().(names); ok {
+		s := value.String()
+		if stringer, ok := enum.(fmt.Stringer); ok {
+			s = stringer.String()
+		}
+		cmd.Value = NewEnumValue(s, enum.Names())
+		return cmd, nil
+	}
+
+	var err error
+	switch value.Kind() {
+	case reflect.Bool:
+		cmd.Value = NewBoolValue(value.Bool() != f.Invert)
+	case reflect.Int, reflect.Int64:
+		cmd.Value, err = NewIntValue(value.Int())
+	case reflect.Float64:
+		cmd.Value, err = NewFloatValue(value.Float())
+	case reflect.String:
+		cmd.Value = NewStringValue(value.String())
+	}
+	if err != nil {
+		return cmd, err
+	}
+	if f.Native {
+		cmd.NativeType = cmd.Value.Type()
+	}
+	return cmd, nil
+}
+
+// Batch returns the commands that write every field set in config.
+func (m *Mapping) Batch(config any) (*BatchExecutor, error) {
+	v := reflect.ValueOf(config).Elem()
+	batch := NewBatchExecutor()
+	multiErr := errors.NewMultiError()
+	for _, f := range m.Fields {
+		value := v.Field(f.index)
+		if value.IsNil() {
+			continue
+		}
+		cmd, err := f.Command(value.Elem())
+		if err != nil {
+			multiErr.Add(errors.WrapConfigError(f.Domain, "add_command", f.Name, value.Elem().Interface(), err))
+			continue
+		}
+		batch.AddCommand(cmd)
+	}
+	if err := multiErr.ToError(); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// Restarts returns the processes any of the fields needs restarted, each
+// once.
+func (m *Mapping) Restarts() []Restart {
+	var restarts []Restart
+	for _, f := range m.Fields {
+		restarts = append(restarts, f.Restarts...)
+	}
+	if len(restarts) == 0 {
+		return nil
+	}
+	return CoalesceRestarts(restarts)
+}
+
+// BatchOf returns the commands that write the tagged fields set in config,
+// a pointer to a section struct.
+func BatchOf(config any) (*BatchExecutor, error) {
+	return MappingOf(config).Batch(config)
+}
+
+// FieldsOf returns every field set in config, a pointer to a section
+// struct, by TOML key. Fields without a defaults tag are included, so that a
+// section's Fields shows all of its configuration.
+func FieldsOf(config any) map[string]any {
+	v := reflect.ValueOf(config).Elem()
+	fields := make(map[string]any)
+	if v.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("toml"), ",")
+		value := v.Field(i)
+		if name == "" || name == "-" || value.Kind() != reflect.Pointer || value.IsNil() {
+			continue
+		}
+		fields[name] = value.Elem().Interface()
+	}
+	return fields
+}
+
+// RestartsOf returns the processes the tagged fields of config need
+// restarted after they changed.
+func RestartsOf(config any) []Restart {
+	return MappingOf(config).Restarts()
+}
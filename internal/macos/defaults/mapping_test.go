@@ -0,0 +1,107 @@
+package defaults
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testSize string
+
+func (s testSize) Names() []string { return []string{"small", "large"} }
+
+type testSection struct {
+	Enabled  *bool     `toml:"enabled,omitempty" defaults:"domain=com.example.app,key=Enabled,restart=Example"`
+	Linear   *bool     `toml:"acceleration,omitempty" defaults:"domain=NSGlobalDomain,key=com.example.linear,invert"`
+	Count    *int64    `toml:"count,omitempty" defaults:"domain=com.example.app,key=Count,restart=Example,restart=Helper,if-running"`
+	Delay    *float64  `toml:"delay,omitempty" defaults:"domain=com.example.app,key=Delay,native"`
+	Size     *testSize `toml:"size,omitempty" defaults:"domain=com.example.app,key=Size"`
+	Location *string   `toml:"location,omitempty"`
+}
+
+func TestBatchOf(t *testing.T) {
+	enabled, linear, count, delay, size, location := true, true, int64(3), 0.5, testSize("large"), "~/Desktop"
+	section := &testSection{Enabled: &enabled, Linear: &linear, Count: &count, Delay: &delay, Size: &size, Location: &location}
+
+	batch, err := BatchOf(section)
+	if err != nil {
+		t.Fatalf("BatchOf() error = %v", err)
+	}
+	want := []struct {
+		name   string
+		value  string
+		native ValueType
+	}{
+		{"com.example.app Enabled", "true", ""},
+		{"NSGlobalDomain com.example.linear", "false", ""},
+		{"com.example.app Count", "3", ""},
+		{"com.example.app Delay", "0.5", FloatType},
+		{"com.example.app Size", "large", ""},
+	}
+	commands := batch.Commands()
+	if len(commands) != len(want) {
+		t.Fatalf("BatchOf() returned %d commands, want %d", len(commands), len(want))
+	}
+	for i, w := range want {
+		cmd := commands[i]
+		if cmd.Name() != w.name || cmd.Value.String() != w.value || cmd.NativeType != w.native {
+			t.Errorf("command %d = %s %s (native %q), want %s %s (native %q)", i, cmd.Name(), cmd.Value, cmd.NativeType, w.name, w.value, w.native)
+		}
+	}
+	if err := commands[4].Value.Validate(); err != nil {
+		t.Errorf("enum value does not validate: %v", err)
+	}
+
+	empty, err := BatchOf(&testSection{})
+	if err != nil || empty.Len() != 0 {
+		t.Errorf("BatchOf() of an empty section = %d commands, %v, want none", empty.Len(), err)
+	}
+}
+
+func TestFieldsOf(t *testing.T) {
+	linear, location := true, "~/Desktop"
+	fields := FieldsOf(&testSection{Linear: &linear, Location: &location})
+	want := map[string]any{"acceleration": true, "location": "~/Desktop"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("FieldsOf() = %v, want %v", fields, want)
+	}
+}
+
+func TestRestartsOf(t *testing.T) {
+	want := []Restart{{Process: "Example"}, {Process: "Helper", OnlyIfRunning: true}}
+	if got := RestartsOf(&testSection{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("RestartsOf() = %v, want %v", got, want)
+	}
+}
+
+func TestMappingOf_InvalidTags(t *testing.T) {
+	tests := []struct {
+		name   string
+		config any
+	}{
+		{"missing key", &struct {
+			A *bool `toml:"a" defaults:"domain=com.example.app"`
+		}{}},
+		{"unknown option", &struct {
+			A *bool `toml:"a" defaults:"domain=com.example.app,key=A,restrat=Dock"`
+		}{}},
+		{"not a pointer", &struct {
+			A bool `toml:"a" defaults:"domain=com.example.app,key=A"`
+		}{}},
+		{"invert on a number", &struct {
+			A *int64 `toml:"a" defaults:"domain=com.example.app,key=A,invert"`
+		}{}},
+		{"unsupported type", &struct {
+			A *[]string `toml:"a" defaults:"domain=com.example.app,key=A"`
+		}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("MappingOf() did not panic")
+				}
+			}()
+			MappingOf(tt.config)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package defaults
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+)
+
+type ChangeKind int
+
+const (
+	// ChangeNone means the key already holds the desired value, or a reset
+	// targets a key that is not set.
+	ChangeNone ChangeKind = iota
+	ChangeWrite
+	ChangeDelete
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeWrite:
+		return "write"
+	case ChangeDelete:
+		return "delete"
+	default:
+		return "none"
+	}
+}
+
+// Change describes what applying a Command would do to the current state.
+// For commands with a merge strategy, Command.Value is the resolved value
+// the key will hold.
+type Change struct {
+	Command Command
+	Current Value
+	Kind    ChangeKind
+	// CreateDir is set when the directory the command names in CreateDir
+	// is missing and is created before the key is written.
+	CreateDir bool
+}
+
+// Exists reports whether the key currently has a value.
+func (c Change) Exists() bool {
+	return c.Current != nil
+}
+
+// Pending reports whether applying the change does anything, which may only
+// be creating the directory of a key that is already set.
+func (c Change) Pending() bool {
+	return c.Kind != ChangeNone || c.CreateDir
+}
+
+// PlanCommand reads the current value of the command's key and classifies
+// the change without writing anything.
+func PlanCommand(ctx context.Context, cmd Command) (Change, error) {
+	backend, err := BackendFor(ctx, cmd.Scope, cmd.Host)
+	if err != nil {
+		return Change{}, fmt.Errorf("failed to read %s: %w", cmd.Name(), err)
+	}
+
+	current, err := backend.Read(ctx, cmd.Domain, cmd.Key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return Change{}, fmt.Errorf("failed to read %s: %w", cmd.Name(), err)
+	}
+
+	change := Change{Command: cmd, Current: current}
+	if resetter, ok := cmd.Value.(ResetValue); ok && resetter.IsReset() {
+		if change.Exists() {
+			change.Kind = ChangeDelete
+		}
+		return change, nil
+	}
+
+	if cmd.CreateDir != "" {
+		exists, err := backend.DirExists(ctx, cmd.CreateDir)
+		if err != nil {
+			return Change{}, fmt.Errorf("failed to check %s for %s: %w", cmd.CreateDir, cmd.Name(), err)
+		}
+		change.CreateDir = !exists
+	}
+
+	desired, err := cmd.Strategy.Resolve(current, cmd.Value)
+	if err != nil {
+		return Change{}, fmt.Errorf("failed to resolve %s: %w", cmd.Name(), err)
+	}
+	if desired == nil {
+		return change, nil
+	}
+	if cmd.NativeType != "" {
+		desired, err = Coerce(desired, cmd.NativeType)
+		if err != nil {
+			return Change{}, fmt.Errorf("failed to resolve %s: %w", cmd.Name(), err)
+		}
+	}
+	change.Command.Value = desired
+
+	if !change.Exists() || !Equal(current, desired) {
+		change.Kind = ChangeWrite
+	}
+	return change, nil
+}
+
+// ErrTypeMismatch is reported when a write would change the type a key is
+// stored with.
+var ErrTypeMismatch = errors.New("type mismatch")
+
+// TypeChanged reports whether the write stores the key with a different
+// type than it currently has.
+func (c Change) TypeChanged() bool {
+	return c.Kind == ChangeWrite && c.Exists() && c.Current.Type() != c.Command.Value.Type()
+}
+
+// TypeMismatch reports whether the write changes the key's type without the
+// section declaring the native type, which may confuse the owning app.
+func (c Change) TypeMismatch() bool {
+	return c.TypeChanged() && c.Command.NativeType == ""
+}
+
+// Details lists the elements a write adds to, removes from or changes in an
+// array or dict, e.g. `+ "de"`. It returns nil unless both the current and
+// the new value are collections of the same type.
+func (c Change) Details() []string {
+	if c.Kind != ChangeWrite || c.Current == nil {
+		return nil
+	}
+
+	switch current := c.Current.(type) {
+	case *ArrayValue:
+		desired, ok := c.Command.Value.(*ArrayValue)
+		if !ok {
+			return nil
+		}
+		var details []string
+		for _, v := range current.Values {
+			if !containsValue(desired.Values, v) {
+				details = append(details, "- "+elementString(v))
+			}
+		}
+		for _, v := range desired.Values {
+			if !containsValue(current.Values, v) {
+				details = append(details, "+ "+elementString(v))
+			}
+		}
+		if details == nil {
+			details = append(details, "reordered")
+		}
+		return details
+
+	case *DictValue:
+		desired, ok := c.Command.Value.(*DictValue)
+		if !ok {
+			return nil
+		}
+		var details []string
+		for _, k := range current.Keys() {
+			if _, ok := desired.Values[k]; !ok {
+				details = append(details, fmt.Sprintf("- %q", k))
+			}
+		}
+		for _, k := range desired.Keys() {
+			old, ok := current.Values[k]
+			switch {
+			case !ok:
+				details = append(details, fmt.Sprintf("+ %q = %s", k, elementString(desired.Values[k])))
+			case !Equal(old, desired.Values[k]):
+				details = append(details, fmt.Sprintf("~ %q: %s → %s", k, elementString(old), elementString(desired.Values[k])))
+			}
+		}
+		return details
+	}
+	return nil
+}
+
+func (b *BatchExecutor) Plan(ctx context.Context) ([]Change, error) {
+	changes := make([]Change, 0, len(b.commands))
+	for _, cmd := range b.commands {
+		change, err := PlanCommand(ctx, cmd)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
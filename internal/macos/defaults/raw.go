@@ -3,7 +3,13 @@ package defaults
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/RATIU5/fjrd/internal/errors"
 )
 
 type DefaultsType string
@@ -13,12 +19,42 @@ const (
 	TypeBool   DefaultsType = "bool"
 	TypeInt    DefaultsType = "int"
 	TypeFloat  DefaultsType = "float"
+	TypeArray  DefaultsType = "array"
+	TypeDict   DefaultsType = "dict"
+	TypeData   DefaultsType = "data"
+	TypeDate   DefaultsType = "date"
 )
 
+// Names lists the types a raw entry can be written as.
+func (t DefaultsType) Names() []string {
+	return []string{"string", "bool", "int", "float", "array", "dict", "data", "date"}
+}
+
+func (t DefaultsType) Validate() error {
+	if !slices.Contains(t.Names(), string(t)) {
+		return fmt.Errorf("unknown type %q, must be one of: %s", string(t), strings.Join(t.Names(), ", "))
+	}
+	return nil
+}
+
+// RawEntry is a single raw default. Domain and Key are set explicitly in the
+// [[macos.defaultsRaw.entries]] form and derived from the table key in the
+// "domain.key" form.
 type RawEntry struct {
-	RawValue any          `toml:"value"`
-	Type     DefaultsType `toml:"type"`
-	Reset    *bool        `toml:"reset,omitempty"`
+	Domain   string       `toml:"domain,omitempty" doc:"Preferences domain, e.g. com.apple.dock"`
+	Key      string       `toml:"key,omitempty" doc:"Key within the domain"`
+	Host     Host         `toml:"host,omitempty" doc:"Write a per-host preference: currentHost or a host name"`
+	RawValue any          `toml:"value" doc:"Value to write, or \"default\" to delete the key"`
+	Type     DefaultsType `toml:"type" doc:"Type the value is written as"`
+	Reset    *bool        `toml:"reset,omitempty" doc:"Delete the key instead of writing it"`
+	Strategy Strategy     `toml:"strategy,omitempty" doc:"How the value is combined with the current one"`
+	Scope    Scope        `toml:"scope,omitempty" doc:"Write the user's preferences or the system-wide ones"`
+}
+
+// Name identifies the entry the same way Command.Name does.
+func (e *RawEntry) Name() string {
+	cmd := Command{Domain: e.Domain, Key: e.Key, Host: e.Host, Scope: e.Scope}
+	return cmd.Name()
 }
 
 func (e *RawEntry) GetStringValue() (string, bool) {
@@ -42,36 +78,85 @@ func (e *RawEntry) GetBoolValue() (bool, bool) {
 	return false, false
 }
 
-func (e *RawEntry) GetIntValue() (int16, bool) {
+// GetIntValue returns the value as an int64. Values that do not fit are
+// rejected rather than truncated.
+func (e *RawEntry) GetIntValue() (int64, bool) {
 	if e.Type == TypeInt {
 		if e.IsDefaultString() {
 			return 0, true
 		}
-		switch v := e.RawValue.(type) {
-		case int16:
+		if v, err := toInt64(e.RawValue); err == nil {
 			return v, true
-		case int:
-			return int16(v), true
-		case int64:
-			return int16(v), true
 		}
 	}
 	return 0, false
 }
 
-func (e *RawEntry) GetFloatValue() (float32, bool) {
+// GetFloatValue returns the value as a float64. Integers are accepted when
+// they convert exactly.
+func (e *RawEntry) GetFloatValue() (float64, bool) {
 	if e.Type == TypeFloat {
 		if e.IsDefaultString() {
-			return 0.0, true
+			return 0, true
 		}
-		switch v := e.RawValue.(type) {
-		case float32:
+		if v, err := toFloat64(e.RawValue); err == nil {
 			return v, true
-		case float64:
-			return float32(v), true
 		}
 	}
-	return 0., false
+	return 0, false
+}
+
+// GetArrayValue converts a TOML array into an ArrayValue.
+func (e *RawEntry) GetArrayValue() (*ArrayValue, bool) {
+	if e.Type == TypeArray {
+		if _, ok := e.RawValue.([]any); ok {
+			if v, err := fromTOML(e.RawValue); err == nil {
+				return v.(*ArrayValue), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// GetDictValue converts a TOML inline table into a DictValue.
+func (e *RawEntry) GetDictValue() (*DictValue, bool) {
+	if e.Type == TypeDict {
+		if _, ok := e.RawValue.(map[string]any); ok {
+			if v, err := fromTOML(e.RawValue); err == nil {
+				return v.(*DictValue), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// GetDataValue decodes a hex string such as "0a1b" or "<0a1b>".
+func (e *RawEntry) GetDataValue() ([]byte, bool) {
+	if e.Type == TypeData {
+		if v, ok := e.RawValue.(string); ok {
+			if data, err := parseData(v); err == nil {
+				return data, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// GetDateValue accepts a TOML date or date-time, or an RFC 3339 string.
+func (e *RawEntry) GetDateValue() (time.Time, bool) {
+	if e.Type == TypeDate {
+		switch v := e.RawValue.(type) {
+		case time.Time:
+			return v.UTC(), true
+		case localDateTime:
+			return v.AsTime(time.UTC), true
+		case string:
+			if t, err := parseDate(v); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
 }
 
 func (e *RawEntry) String() string {
@@ -90,7 +175,23 @@ func (e *RawEntry) String() string {
 		}
 	case TypeFloat:
 		if v, ok := e.GetFloatValue(); ok {
-			return fmt.Sprintf("float: %f", v)
+			return fmt.Sprintf("float: %s", strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	case TypeArray:
+		if v, ok := e.GetArrayValue(); ok {
+			return fmt.Sprintf("array: %s", v)
+		}
+	case TypeDict:
+		if v, ok := e.GetDictValue(); ok {
+			return fmt.Sprintf("dict: %s", v)
+		}
+	case TypeData:
+		if v, ok := e.GetDataValue(); ok {
+			return fmt.Sprintf("data: %s", NewDataValue(v))
+		}
+	case TypeDate:
+		if v, ok := e.GetDateValue(); ok {
+			return fmt.Sprintf("date: %s", NewDateValue(v))
 		}
 	}
 	return fmt.Sprintf("%s: <invalid>", e.Type)
@@ -117,7 +218,11 @@ func (e *RawEntry) ShouldReset() bool {
 
 func (e *RawEntry) Validate() error {
 	if e.ShouldReset() {
-		return nil
+		return e.Type.Validate()
+	}
+
+	if err := e.Strategy.ValidFor(ValueType("-" + e.Type)); err != nil {
+		return err
 	}
 
 	switch e.Type {
@@ -126,44 +231,332 @@ func (e *RawEntry) Validate() error {
 			return fmt.Errorf("%v is not of expected type string", e.RawValue)
 		}
 	case TypeInt:
-		if _, isValid := e.GetIntValue(); !isValid {
-			return fmt.Errorf("%v is not of expected type int", e.RawValue)
+		if _, err := toInt64(e.RawValue); err != nil {
+			return fmt.Errorf("%v is not of expected type int: %w", e.RawValue, err)
 		}
 	case TypeFloat:
-		if _, isValid := e.GetFloatValue(); !isValid {
-			return fmt.Errorf("%v is not of expected type float", e.RawValue)
+		if _, err := toFloat64(e.RawValue); err != nil {
+			return fmt.Errorf("%v is not of expected type float: %w", e.RawValue, err)
 		}
 	case TypeBool:
 		if _, isValid := e.GetBoolValue(); !isValid {
 			return fmt.Errorf("%v is not of expected type bool", e.RawValue)
 		}
+	case TypeArray:
+		v, isValid := e.GetArrayValue()
+		if !isValid {
+			return fmt.Errorf("%v is not of expected type array", e.RawValue)
+		}
+		return v.Validate()
+	case TypeDict:
+		v, isValid := e.GetDictValue()
+		if !isValid {
+			return fmt.Errorf("%v is not of expected type dict", e.RawValue)
+		}
+		return v.Validate()
+	case TypeData:
+		if _, isValid := e.GetDataValue(); !isValid {
+			return fmt.Errorf("%v is not of expected type data (hex string)", e.RawValue)
+		}
+	case TypeDate:
+		if _, isValid := e.GetDateValue(); !isValid {
+			return fmt.Errorf("%v is not of expected type date", e.RawValue)
+		}
+	default:
+		return e.Type.Validate()
 	}
 	return nil
 }
 
-type Raw map[string]RawEntry
+// rawEntriesKey holds the [[macos.defaultsRaw.entries]] array. It cannot clash
+// with the map form, whose keys always contain a dot.
+const rawEntriesKey = "entries"
+
+// Raw is the [macos.defaultsRaw] table as decoded. It holds both forms:
+//
+//	"com.apple.dock.autohide" = { value = true, type = "bool" }
+//
+//	[[macos.defaultsRaw.entries]]
+//	domain = "NSGlobalDomain"
+//	key = "com.apple.mouse.scaling"
+//
+// The map form splits on the last dot and so cannot address keys that
+// contain dots; the entries form can.
+type Raw map[string]any
+
+// Entries returns every raw entry with its domain and key resolved, map form
+// first sorted by name so that plans and logs are stable between runs, then
+// the entries form in file order.
+func (r Raw) Entries() ([]RawEntry, error) {
+	entries, _, err := r.entries()
+	return entries, err
+}
+
+// entries returns the entries as Entries does, along with the path of each
+// below the defaultsRaw table, e.g. entries[0].
+func (r Raw) entries() ([]RawEntry, []string, error) {
+	domainKeys := make([]string, 0, len(r))
+	for domainKey := range r {
+		if domainKey != rawEntriesKey {
+			domainKeys = append(domainKeys, domainKey)
+		}
+	}
+	sort.Strings(domainKeys)
+
+	entries := make([]RawEntry, 0, len(r))
+	paths := make([]string, 0, len(r))
+	for _, domainKey := range domainKeys {
+		entry, err := decodeRawEntry(r[domainKey])
+		if err != nil {
+			return nil, nil, fmt.Errorf("defaultsRaw %q: %w", domainKey, err)
+		}
+		if entry.Domain != "" || entry.Key != "" {
+			return nil, nil, fmt.Errorf("defaultsRaw %q: domain and key are only allowed in [[macos.defaultsRaw.entries]]", domainKey)
+		}
+
+		lastDot := strings.LastIndex(domainKey, ".")
+		if lastDot <= 0 || lastDot == len(domainKey)-1 {
+			return nil, nil, fmt.Errorf("invalid domain format %s, expected format: com.apple.domain.key", domainKey)
+		}
+		entry.Domain = domainKey[:lastDot]
+		entry.Key = domainKey[lastDot+1:]
+		entries = append(entries, entry)
+		paths = append(paths, strconv.Quote(domainKey))
+	}
+
+	var items []any
+	switch list := r[rawEntriesKey].(type) {
+	case nil:
+	case []any:
+		items = list
+	case []RawEntry:
+		for _, entry := range list {
+			items = append(items, entry)
+		}
+	default:
+		return nil, nil, fmt.Errorf("defaultsRaw entries must be an array of tables, got %T", list)
+	}
+
+	for i, item := range items {
+		entry, err := decodeRawEntry(item)
+		if err != nil {
+			return nil, nil, fmt.Errorf("defaultsRaw entries[%d]: %w", i, err)
+		}
+		if entry.Domain == "" || entry.Key == "" {
+			return nil, nil, fmt.Errorf("defaultsRaw entries[%d]: domain and key are required", i)
+		}
+		entries = append(entries, entry)
+		paths = append(paths, fmt.Sprintf("%s[%d]", rawEntriesKey, i))
+	}
+
+	return entries, paths, nil
+}
+
+// decodeRawEntry builds a RawEntry from a decoded TOML table.
+func decodeRawEntry(v any) (RawEntry, error) {
+	switch t := v.(type) {
+	case RawEntry:
+		return t, nil
+	case map[string]any:
+		var entry RawEntry
+		for field, value := range t {
+			var ok bool
+			switch field {
+			case "domain":
+				entry.Domain, ok = value.(string)
+			case "key":
+				entry.Key, ok = value.(string)
+			case "host":
+				var h string
+				h, ok = value.(string)
+				entry.Host = Host(h)
+			case "value":
+				entry.RawValue, ok = value, true
+			case "type":
+				var s string
+				s, ok = value.(string)
+				entry.Type = DefaultsType(s)
+			case "reset":
+				var b bool
+				b, ok = value.(bool)
+				entry.Reset = &b
+			case "scope":
+				var s string
+				if s, ok = value.(string); ok {
+					scope, err := ParseScope(s)
+					if err != nil {
+						return RawEntry{}, err
+					}
+					entry.Scope = scope
+				}
+			case "strategy":
+				var s string
+				s, ok = value.(string)
+				entry.Strategy = Strategy(s)
+			default:
+				return RawEntry{}, fmt.Errorf("unknown field %q", field)
+			}
+			if !ok {
+				return RawEntry{}, fmt.Errorf("invalid %s %v", field, value)
+			}
+		}
+		return entry, nil
+	default:
+		return RawEntry{}, fmt.Errorf("expected a table, got %T", v)
+	}
+}
 
 func (r Raw) String() string {
-	if len(r) == 0 {
+	entries, err := r.Entries()
+	if err != nil {
+		return fmt.Sprintf("DefaultsRaw{<invalid: %v>}", err)
+	}
+	if len(entries) == 0 {
 		return "DefaultsRaw{}"
 	}
 
 	var parts []string
-	for key, entry := range r {
-		parts = append(parts, fmt.Sprintf("  %q: %s", key, entry.String()))
+	for _, entry := range entries {
+		parts = append(parts, fmt.Sprintf("  %q: %s", entry.Name(), entry.String()))
 	}
 	return fmt.Sprintf("DefaultsRaw{\n%s\n}", strings.Join(parts, "\n"))
 }
 
 func (r Raw) Validate() error {
-	for _, value := range r {
-		if err := value.Validate(); err != nil {
-			return err
+	entries, paths, err := r.entries()
+	if err != nil {
+		return err
+	}
+
+	errs := errors.NewMultiError()
+	seen := make(map[string]bool)
+	for i, entry := range entries {
+		if seen[entry.Name()] {
+			errs.Add(fmt.Errorf("defaultsRaw %s is set more than once", entry.Name()))
+			continue
+		}
+		seen[entry.Name()] = true
+
+		if err := entry.Host.Validate(); err != nil {
+			errs.Add(fmt.Errorf("defaultsRaw %s: %w", entry.Name(), err))
+		}
+		if err := entry.Scope.Validate(); err != nil {
+			errs.Add(fmt.Errorf("defaultsRaw %s: %w", entry.Name(), err))
+		}
+		if entry.Scope != UserScope && entry.Host != AnyHost {
+			errs.Add(fmt.Errorf("defaultsRaw %s: host cannot be combined with the %s scope", entry.Name(), entry.Scope))
+		}
+		if err := entry.Type.Validate(); err != nil {
+			errs.Add(errors.NewValidationError("macos.defaultsRaw."+paths[i]+".type", entry.Type, "", err))
+			continue
+		}
+		if err := entry.Validate(); err != nil {
+			errs.Add(fmt.Errorf("defaultsRaw %s: %w", entry.Name(), err))
 		}
 	}
+	return errs.ToError()
+}
+
+func (r Raw) Restarts() []Restart {
 	return nil
 }
 
+// Batch converts the raw entries into defaults commands.
+func (r Raw) Batch() (*BatchExecutor, error) {
+	batch := NewBatchExecutor()
+
+	entries, err := r.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		value, err := entry.Value()
+		if err != nil {
+			return nil, err
+		}
+
+		batch.AddCommand(Command{
+			Domain:   entry.Domain,
+			Key:      entry.Key,
+			Value:    value,
+			Strategy: entry.Strategy,
+			Host:     entry.Host,
+			Scope:    entry.Scope,
+		})
+	}
+
+	return batch, nil
+}
+
+// Value converts the entry into the Value it writes, or a reset value if it
+// deletes the key.
+func (e *RawEntry) Value() (Value, error) {
+	name := e.Name()
+	if e.ShouldReset() {
+		switch e.Type {
+		case TypeString:
+			return NewResetStringValue(), nil
+		case TypeBool:
+			return NewResetBoolValue(), nil
+		case TypeInt:
+			return NewResetIntValue(), nil
+		case TypeFloat:
+			return NewResetFloatValue(), nil
+		case TypeArray, TypeDict, TypeData, TypeDate:
+			return NewResetCollectionValue(ValueType("-" + e.Type)), nil
+		default:
+			return nil, fmt.Errorf("unsupported type %s for reset of %s", e.Type, name)
+		}
+	}
+
+	switch e.Type {
+	case TypeString:
+		if v, ok := e.GetStringValue(); ok {
+			return NewStringValue(v), nil
+		}
+	case TypeBool:
+		if v, ok := e.GetBoolValue(); ok {
+			return NewBoolValue(v), nil
+		}
+	case TypeInt:
+		if v, ok := e.GetIntValue(); ok {
+			value, err := NewIntValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create int value for %s: %w", name, err)
+			}
+			return value, nil
+		}
+	case TypeFloat:
+		if v, ok := e.GetFloatValue(); ok {
+			value, err := NewFloatValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create float value for %s: %w", name, err)
+			}
+			return value, nil
+		}
+	case TypeArray:
+		if v, ok := e.GetArrayValue(); ok {
+			return v, nil
+		}
+	case TypeDict:
+		if v, ok := e.GetDictValue(); ok {
+			return v, nil
+		}
+	case TypeData:
+		if v, ok := e.GetDataValue(); ok {
+			return NewDataValue(v), nil
+		}
+	case TypeDate:
+		if v, ok := e.GetDateValue(); ok {
+			return NewDateValue(v), nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %s for %s", e.Type, name)
+	}
+	return nil, fmt.Errorf("invalid %s value for %s", e.Type, name)
+}
+
 func (r Raw) Execute(ctx context.Context, log interface {
 	Info(string, ...any)
 	Debug(string, ...any)
@@ -174,86 +567,17 @@ func (r Raw) Execute(ctx context.Context, log interface {
 		return nil
 	}
 
-	log.Debug("Processing raw defaults", "count", len(r))
-	batch := NewBatchExecutor()
-
-	for domainKey, entry := range r {
-		log.Debug("Processing raw default", "domain_key", domainKey, "type", entry.Type)
-		domainParts := strings.Split(domainKey, ".")
-		if len(domainParts) < 2 {
-			return fmt.Errorf("invalid domain format %s, expected format: com.apple.domain.key", domainKey)
-		}
-
-		key := domainParts[len(domainParts)-1]
-		macosDomain := strings.Join(domainParts[:len(domainParts)-1], ".")
-		log.Debug("Parsed domain and key", "domain", macosDomain, "key", key)
-
-		var value Value
-		var err error
-
-		if entry.ShouldReset() {
-			log.Debug("Creating reset value", "domain_key", domainKey, "type", entry.Type)
-			switch entry.Type {
-			case TypeString:
-				value = NewResetStringValue()
-			case TypeBool:
-				value = NewResetBoolValue()
-			case TypeInt:
-				value = NewResetIntValue()
-			case TypeFloat:
-				value = NewResetFloatValue()
-			default:
-				return fmt.Errorf("unsupported type %s for reset of domain %s", entry.Type, domainKey)
-			}
-		} else {
-			switch entry.Type {
-			case TypeString:
-				if v, ok := entry.GetStringValue(); ok {
-					value = NewStringValue(v)
-				} else {
-					return fmt.Errorf("invalid string value for domain %s", domainKey)
-				}
-			case TypeBool:
-				if v, ok := entry.GetBoolValue(); ok {
-					value = NewBoolValue(v)
-				} else {
-					return fmt.Errorf("invalid bool value for domain %s", domainKey)
-				}
-			case TypeInt:
-				if v, ok := entry.GetIntValue(); ok {
-					value, err = NewIntValue(v)
-					if err != nil {
-						return fmt.Errorf("failed to create int value for domain %s: %w", domainKey, err)
-					}
-				} else {
-					return fmt.Errorf("invalid int value for domain %s", domainKey)
-				}
-			case TypeFloat:
-				if v, ok := entry.GetFloatValue(); ok {
-					value, err = NewFloatValue(v)
-					if err != nil {
-						return fmt.Errorf("failed to create float value for domain %s: %w", domainKey, err)
-					}
-				} else {
-					return fmt.Errorf("invalid float value for domain %s", domainKey)
-				}
-			default:
-				return fmt.Errorf("unsupported type %s for domain %s", entry.Type, domainKey)
-			}
-		}
-
-		batch.AddCommand(Command{
-			Domain: macosDomain,
-			Key:    key,
-			Value:  value,
-		})
+	batch, err := r.Batch()
+	if err != nil {
+		return err
 	}
+	log.Debug("Processing raw defaults", "count", batch.Len())
 
 	log.Debug("Executing raw defaults batch")
 	if err := batch.Execute(ctx, log); err != nil {
 		return fmt.Errorf("failed to execute raw defaults: %w", err)
 	}
 
-	log.Debug("Raw defaults applied successfully", "count", len(r))
+	log.Debug("Raw defaults applied successfully", "count", batch.Len())
 	return nil
 }
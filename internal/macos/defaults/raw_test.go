@@ -0,0 +1,118 @@
+package defaults
+
+import (
+	"testing"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+func TestRaw_Entries(t *testing.T) {
+	const doc = `
+[macos.defaultsRaw]
+"com.apple.dock.autohide" = { value = true, type = "bool" }
+
+[[macos.defaultsRaw.entries]]
+domain = "NSGlobalDomain"
+key = "com.apple.mouse.scaling"
+type = "float"
+value = 1.5
+
+[[macos.defaultsRaw.entries]]
+domain = "NSGlobalDomain"
+key = "com.apple.swipescrolldirection"
+type = "bool"
+reset = true
+`
+	var cfg struct {
+		Macos struct {
+			DefaultsRaw Raw `toml:"defaultsRaw"`
+		} `toml:"macos"`
+	}
+	if err := toml.Unmarshal([]byte(doc), &cfg); err != nil {
+		t.Fatalf("toml.Unmarshal() error = %v", err)
+	}
+	raw := cfg.Macos.DefaultsRaw
+	if err := raw.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	batch, err := raw.Batch()
+	if err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+
+	want := []string{
+		"com.apple.dock autohide true",
+		"NSGlobalDomain com.apple.mouse.scaling 1.5",
+		"NSGlobalDomain com.apple.swipescrolldirection default",
+	}
+	commands := batch.Commands()
+	if len(commands) != len(want) {
+		t.Fatalf("Batch() produced %d commands, want %d", len(commands), len(want))
+	}
+	for i, cmd := range commands {
+		if got := cmd.Domain + " " + cmd.Key + " " + cmd.Value.String(); got != want[i] {
+			t.Errorf("command %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestRaw_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     Raw
+		wantErr bool
+	}{
+		{
+			name:    "map form without dot",
+			raw:     Raw{"autohide": RawEntry{RawValue: true, Type: TypeBool}},
+			wantErr: true,
+		},
+		{
+			name:    "entry without key",
+			raw:     Raw{"entries": []any{map[string]any{"domain": "com.apple.dock", "type": "bool", "value": true}}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			raw:     Raw{"com.apple.dock.autohide": map[string]any{"type": "bool", "value": true, "valu": false}},
+			wantErr: true,
+		},
+		{
+			name:    "domain in map form",
+			raw:     Raw{"com.apple.dock.autohide": map[string]any{"domain": "com.apple.dock", "type": "bool", "value": true}},
+			wantErr: true,
+		},
+		{
+			name: "same key in both forms",
+			raw: Raw{
+				"com.apple.dock.autohide": RawEntry{RawValue: true, Type: TypeBool},
+				"entries":                 []RawEntry{{Domain: "com.apple.dock", Key: "autohide", RawValue: false, Type: TypeBool}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			raw:     Raw{"com.apple.dock.tilesize": map[string]any{"type": "integer", "value": int64(48)}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown type of a reset",
+			raw:     Raw{"entries": []any{map[string]any{"domain": "com.apple.dock", "key": "tilesize", "type": "integer", "reset": true}}},
+			wantErr: true,
+		},
+		{
+			name:    "reset",
+			raw:     Raw{"com.apple.dock.tilesize": map[string]any{"type": "int", "value": "default"}},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.raw.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -90,6 +90,32 @@ func (r *ResetFloatValue) Validate() error {
 	return nil
 }
 
+// ResetCollectionValue resets an array, dict, data or date key. Unlike the
+// scalar resets it carries its type, since all four share one implementation.
+type ResetCollectionValue struct {
+	valueType ValueType
+}
+
+func NewResetCollectionValue(valueType ValueType) *ResetCollectionValue {
+	return &ResetCollectionValue{valueType: valueType}
+}
+
+func (r *ResetCollectionValue) Type() ValueType {
+	return r.valueType
+}
+
+func (r *ResetCollectionValue) String() string {
+	return "default"
+}
+
+func (r *ResetCollectionValue) IsReset() bool {
+	return true
+}
+
+func (r *ResetCollectionValue) Validate() error {
+	return nil
+}
+
 func NewValueOrReset(value any, valueType ValueType, isNull bool) (Value, error) {
 	if isNull {
 		switch valueType {
@@ -101,6 +127,8 @@ func NewValueOrReset(value any, valueType ValueType, isNull bool) (Value, error)
 			return NewResetIntValue(), nil
 		case FloatType:
 			return NewResetFloatValue(), nil
+		case ArrayType, DictType, DataType, DateType:
+			return NewResetCollectionValue(valueType), nil
 		default:
 			return nil, fmt.Errorf("unsupported value type for reset: %s", valueType)
 		}
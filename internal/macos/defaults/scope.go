@@ -0,0 +1,205 @@
+package defaults
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+)
+
+// Scope selects between the user's preferences and the system-wide ones in
+// /Library/Preferences, which only root can write.
+type Scope string
+
+const (
+	// UserScope is the current user's domain. It is the zero value.
+	UserScope Scope = ""
+	// SystemScope is /Library/Preferences/<domain>.
+	SystemScope Scope = "system"
+)
+
+func (s Scope) String() string {
+	if s == UserScope {
+		return "user"
+	}
+	return string(s)
+}
+
+// Names lists the scopes ParseScope accepts.
+func (s Scope) Names() []string {
+	return []string{"user", "system"}
+}
+
+// ParseScope accepts "user" or "system". An empty string is the user scope.
+func ParseScope(s string) (Scope, error) {
+	if s == "user" {
+		return UserScope, nil
+	}
+	scope := Scope(s)
+	return scope, scope.Validate()
+}
+
+func (s Scope) Validate() error {
+	switch s {
+	case UserScope, SystemScope:
+		return nil
+	}
+	return fmt.Errorf("unknown scope %q, must be one of: user, system", string(s))
+}
+
+// Privileged reports whether writing in this scope needs root.
+func (s Scope) Privileged() bool {
+	return s == SystemScope
+}
+
+// systemPreferencesDir holds the system-wide domains.
+const systemPreferencesDir = "/Library/Preferences"
+
+// SystemDomainPath returns the path defaults uses to address a system domain.
+func SystemDomainPath(domain string) string {
+	if isGlobalDomain(domain) {
+		domain = globalDomainFile
+	}
+	return path.Join(systemPreferencesDir, domain)
+}
+
+// SystemBackend is implemented by backends that can reach system domains.
+type SystemBackend interface {
+	// ForSystem returns a view of the backend that addresses system domains.
+	// Reads need no privileges. Writes through the view escalate on their
+	// own, once per write; use Escalate to write several keys.
+	ForSystem(ctx context.Context) (Backend, error)
+	// Escalate runs every command against system domains in one privileged
+	// step, so that the user is asked for credentials at most once.
+	Escalate(ctx context.Context, commands []Command) error
+}
+
+// BackendFor returns the active backend scoped to scope and host.
+func BackendFor(ctx context.Context, scope Scope, host Host) (Backend, error) {
+	backend := GetBackend()
+
+	if scope == SystemScope {
+		if host != AnyHost {
+			return nil, fmt.Errorf("%s preferences cannot be combined with the system scope", host)
+		}
+		systemBackend, ok := backend.(SystemBackend)
+		if !ok {
+			return nil, fmt.Errorf("backend %T does not support system preferences", backend)
+		}
+		return systemBackend.ForSystem(ctx)
+	}
+
+	if host == AnyHost {
+		return backend, nil
+	}
+	hostBackend, ok := backend.(HostBackend)
+	if !ok {
+		return nil, fmt.Errorf("backend %T does not support %s preferences", backend, host)
+	}
+	return hostBackend.ForHost(ctx, host)
+}
+
+// newSystemBackend keeps system domains under System/ in the wrapped backend,
+// for backends that only simulate the preferences system.
+func newSystemBackend(backend Backend) Backend {
+	return &mappedBackend{Backend: backend, domain: func(domain string) string {
+		if isGlobalDomain(domain) {
+			domain = globalDomainFile
+		}
+		return "System/" + domain
+	}}
+}
+
+// executeAll runs commands one by one against backend. It is the escalation
+// step of backends that need no privileges.
+func executeAll(ctx context.Context, backend Backend, commands []Command) error {
+	for _, cmd := range commands {
+		var err error
+		if resetter, ok := cmd.Value.(ResetValue); ok && resetter.IsReset() {
+			// A key that is already missing is reset.
+			if err = backend.Delete(ctx, cmd.Domain, cmd.Key); errors.Is(err, ErrKeyNotFound) {
+				err = nil
+			}
+		} else {
+			err = backend.Write(ctx, cmd.Domain, cmd.Key, cmd.Value)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", cmd.Name(), err)
+		}
+	}
+	return nil
+}
+
+// SplitPrivileged separates the commands that need privileges from the rest.
+func (b *BatchExecutor) SplitPrivileged() (*BatchExecutor, []Command) {
+	user := NewBatchExecutor()
+	var privileged []Command
+	for _, cmd := range b.commands {
+		if cmd.Scope.Privileged() {
+			privileged = append(privileged, cmd)
+		} else {
+			user.AddCommand(cmd)
+		}
+	}
+	return user, privileged
+}
+
+// ApplyPrivileged runs every command that would change something in a single
+// escalation. Outcomes are returned in command order; if the escalation
+// fails, every change it carried is marked failed.
+func ApplyPrivileged(ctx context.Context, commands []Command, log interface {
+	Info(string, ...any)
+	Debug(string, ...any)
+}) (Result, error) {
+	var result Result
+	if len(commands) == 0 {
+		return result, nil
+	}
+
+	// Reading system domains needs no privileges.
+	changes, err := (&BatchExecutor{commands: commands}).Plan(ctx)
+	if err != nil {
+		return result, fmt.Errorf("privileged execution failed: %w", err)
+	}
+
+	var pending []Command
+	for _, change := range changes {
+		if change.Kind == ChangeNone {
+			continue
+		}
+		if err := change.Command.Value.Validate(); err != nil {
+			return result, errors.NewValidationError(change.Command.Key, change.Command.Value, "", err)
+		}
+		pending = append(pending, change.Command)
+	}
+
+	var escalateErr error
+	if len(pending) > 0 {
+		backend := GetBackend()
+		systemBackend, ok := backend.(SystemBackend)
+		if !ok {
+			return result, fmt.Errorf("backend %T does not support system preferences", backend)
+		}
+		log.Info("Writing system preferences with elevated privileges", "keys", len(pending))
+		escalateErr = systemBackend.Escalate(ctx, pending)
+	}
+
+	for _, change := range changes {
+		outcome := Outcome{Change: change}
+		switch {
+		case change.Kind == ChangeNone:
+			result.Unchanged++
+		case escalateErr != nil:
+			outcome.Err = escalateErr
+		default:
+			result.Changed++
+		}
+		result.Outcomes = append(result.Outcomes, outcome)
+	}
+
+	if escalateErr != nil {
+		return result, fmt.Errorf("privileged execution failed: %w", escalateErr)
+	}
+	return result, nil
+}
@@ -0,0 +1,132 @@
+package defaults
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+)
+
+func TestApplyPrivileged(t *testing.T) {
+	mem := NewMemoryBackend()
+	withBackend(t, mem)
+	ctx := context.Background()
+
+	commands := []Command{
+		{Domain: "com.apple.loginwindow", Key: "GuestEnabled", Value: NewBoolValue(false), Scope: SystemScope},
+		{Domain: "com.apple.SoftwareUpdate", Key: "AutomaticCheckEnabled", Value: NewBoolValue(true), Scope: SystemScope},
+	}
+
+	result, err := ApplyPrivileged(ctx, commands, nopLogger{})
+	if err != nil {
+		t.Fatalf("ApplyPrivileged() error = %v", err)
+	}
+	if result.Changed != 2 || mem.Escalations() != 1 {
+		t.Errorf("ApplyPrivileged() changed %d keys in %d escalations, want 2 in 1", result.Changed, mem.Escalations())
+	}
+
+	system, err := BackendFor(ctx, SystemScope, AnyHost)
+	if err != nil {
+		t.Fatalf("BackendFor() error = %v", err)
+	}
+	if got, err := system.Read(ctx, "com.apple.loginwindow", "GuestEnabled"); err != nil || got.String() != "false" {
+		t.Errorf("system GuestEnabled = %v, %v", got, err)
+	}
+
+	result, err = ApplyPrivileged(ctx, commands, nopLogger{})
+	if err != nil {
+		t.Fatalf("second ApplyPrivileged() error = %v", err)
+	}
+	if result.Unchanged != 2 || mem.Escalations() != 1 {
+		t.Errorf("second ApplyPrivileged() unchanged %d, escalations %d, want 2 and 1", result.Unchanged, mem.Escalations())
+	}
+}
+
+func TestEscalate_ResetOfMissingKey(t *testing.T) {
+	mem := NewMemoryBackend()
+	ctx := context.Background()
+
+	globalstate, _ := NewIntValue(1)
+	commands := []Command{
+		{Domain: "com.apple.loginwindow", Key: "GuestEnabled", Value: NewResetBoolValue(), Scope: SystemScope},
+		{Domain: "com.apple.alf", Key: "globalstate", Value: globalstate, Scope: SystemScope},
+	}
+	if err := mem.Escalate(ctx, commands); err != nil {
+		t.Fatalf("Escalate() error = %v", err)
+	}
+	system, _ := mem.ForSystem(ctx)
+	if got, err := system.Read(ctx, "com.apple.alf", "globalstate"); err != nil || got.String() != "1" {
+		t.Errorf("globalstate after a reset of a missing key = %v, %v, want 1", got, err)
+	}
+}
+
+func TestEscalationCommands(t *testing.T) {
+	commands := []Command{
+		{Domain: "com.apple.loginwindow", Key: "GuestEnabled", Value: NewResetBoolValue(), Scope: SystemScope},
+		{Domain: "NSGlobalDomain", Key: "AppleShowAllExtensions", Value: NewBoolValue(true), Scope: SystemScope},
+	}
+	got, err := EscalationCommands(commands)
+	if err != nil {
+		t.Fatalf("EscalationCommands() error = %v", err)
+	}
+	want := []string{
+		"sudo '/usr/bin/defaults' 'delete' '/Library/Preferences/com.apple.loginwindow' 'GuestEnabled'",
+		"sudo '/usr/bin/defaults' 'write' '/Library/Preferences/.GlobalPreferences' 'AppleShowAllExtensions' '-bool' 'true'",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("EscalationCommands() = %q, want %q", got, want)
+	}
+}
+
+func TestSnapshot_RestoreSystemKeys(t *testing.T) {
+	mem := NewMemoryBackend()
+	withBackend(t, mem)
+	ctx := context.Background()
+
+	system, err := BackendFor(ctx, SystemScope, AnyHost)
+	if err != nil {
+		t.Fatalf("BackendFor() error = %v", err)
+	}
+	system.Write(ctx, "com.apple.loginwindow", "GuestEnabled", NewBoolValue(true))
+
+	commands := []Command{
+		{Domain: "com.apple.loginwindow", Key: "GuestEnabled", Value: NewBoolValue(false), Scope: SystemScope},
+		{Domain: "com.apple.SoftwareUpdate", Key: "AutomaticCheckEnabled", Value: NewBoolValue(true), Scope: SystemScope},
+	}
+	snapshot, err := TakeSnapshot(ctx, commands)
+	if err != nil {
+		t.Fatalf("TakeSnapshot() error = %v", err)
+	}
+	if _, err := ApplyPrivileged(ctx, commands, nopLogger{}); err != nil {
+		t.Fatalf("ApplyPrivileged() error = %v", err)
+	}
+
+	if err := snapshot.Restore(ctx, nopLogger{}); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if mem.Escalations() != 2 {
+		t.Errorf("apply and restore escalated %d times, want 2", mem.Escalations())
+	}
+	if got, err := system.Read(ctx, "com.apple.loginwindow", "GuestEnabled"); err != nil || got.String() != "true" {
+		t.Errorf("restored GuestEnabled = %v, %v, want true", got, err)
+	}
+	if _, err := system.Read(ctx, "com.apple.SoftwareUpdate", "AutomaticCheckEnabled"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("AutomaticCheckEnabled should be deleted by restore, got %v", err)
+	}
+}
+
+func TestBackendFor_SystemWithHost(t *testing.T) {
+	withBackend(t, NewMemoryBackend())
+	if _, err := BackendFor(context.Background(), SystemScope, CurrentHost); err == nil {
+		t.Error("BackendFor() with system scope and current host should fail")
+	}
+}
+
+func TestShellJoin(t *testing.T) {
+	got := shellJoin([]string{"/usr/bin/defaults", "write", "/Library/Preferences/com.apple.loginwindow", "LoginwindowText", "It's mine"})
+	want := `'/usr/bin/defaults' 'write' '/Library/Preferences/com.apple.loginwindow' 'LoginwindowText' 'It'\''s mine'`
+	if got != want {
+		t.Errorf("shellJoin() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,119 @@
+package defaults
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+)
+
+// KeyState is the value a key held when a snapshot was taken. A nil Value
+// means the key did not exist.
+type KeyState struct {
+	Domain string
+	Key    string
+	Host   Host
+	Scope  Scope
+	Value  Value
+}
+
+// Snapshot records the prior state of a set of keys so that they can be put
+// back exactly as they were, including removing keys that did not exist.
+type Snapshot struct {
+	keys []KeyState
+}
+
+// TakeSnapshot reads the current value of every key the commands touch.
+func TakeSnapshot(ctx context.Context, commands []Command) (*Snapshot, error) {
+	snapshot := &Snapshot{}
+	seen := make(map[string]bool)
+
+	for _, cmd := range commands {
+		id := cmd.Domain + "\x00" + cmd.Key + "\x00" + string(cmd.Host) + "\x00" + string(cmd.Scope)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		backend, err := BackendFor(ctx, cmd.Scope, cmd.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", cmd.Name(), err)
+		}
+		current, err := backend.Read(ctx, cmd.Domain, cmd.Key)
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", cmd.Name(), err)
+		}
+		snapshot.keys = append(snapshot.keys, KeyState{Domain: cmd.Domain, Key: cmd.Key, Host: cmd.Host, Scope: cmd.Scope, Value: current})
+	}
+	return snapshot, nil
+}
+
+func (s *Snapshot) Keys() []KeyState {
+	keys := make([]KeyState, len(s.keys))
+	copy(keys, s.keys)
+	return keys
+}
+
+func (s *Snapshot) Len() int {
+	return len(s.keys)
+}
+
+// command returns the command that puts the key back into its state.
+func (k KeyState) command() Command {
+	cmd := Command{Domain: k.Domain, Key: k.Key, Host: k.Host, Scope: k.Scope, Value: k.Value}
+	if k.Value == nil {
+		cmd.Value = NewResetStringValue()
+	}
+	return cmd
+}
+
+// Restore writes back every recorded value and deletes keys that did not
+// exist when the snapshot was taken. Keys already in their recorded state are
+// left untouched. System keys are restored in a single escalation, as they
+// were written. Restore keeps going after a failure so that as much as
+// possible is put back.
+func (s *Snapshot) Restore(ctx context.Context, log interface {
+	Info(string, ...any)
+	Debug(string, ...any)
+}) error {
+	multiErr := errors.NewMultiError()
+
+	var privileged []Command
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		state := s.keys[i]
+		if state.Scope.Privileged() {
+			privileged = append(privileged, state.command())
+			continue
+		}
+
+		backend, err := BackendFor(ctx, state.Scope, state.Host)
+		if err != nil {
+			multiErr.Add(fmt.Errorf("failed to read %s %s: %w", state.Domain, state.Key, err))
+			continue
+		}
+		current, err := backend.Read(ctx, state.Domain, state.Key)
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			multiErr.Add(fmt.Errorf("failed to read %s %s: %w", state.Domain, state.Key, err))
+			continue
+		}
+
+		switch {
+		case state.Value == nil && current == nil:
+			continue
+		case state.Value == nil:
+			err = backend.Delete(ctx, state.Domain, state.Key)
+		case current != nil && Equal(current, state.Value):
+			continue
+		default:
+			err = backend.Write(ctx, state.Domain, state.Key, state.Value)
+		}
+		if err != nil {
+			multiErr.Add(fmt.Errorf("failed to restore %s %s: %w", state.Domain, state.Key, err))
+		}
+	}
+
+	if _, err := ApplyPrivileged(ctx, privileged, log); err != nil {
+		multiErr.Add(fmt.Errorf("failed to restore system preferences: %w", err))
+	}
+	return multiErr.ToError()
+}
@@ -0,0 +1,115 @@
+package defaults
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Strategy decides how a command's value is combined with the value a key
+// already holds. The desired value is resolved against the current one at
+// plan time, so only the resulting difference is written.
+type Strategy string
+
+const (
+	// StrategyReplace owns the whole value. It is the default.
+	StrategyReplace Strategy = "replace"
+	// StrategyEnsureContains appends the array elements that are missing.
+	StrategyEnsureContains Strategy = "ensure-contains"
+	// StrategyEnsureMissing removes the given elements from an array.
+	StrategyEnsureMissing Strategy = "ensure-missing"
+	// StrategyMergeDict sets the given keys and keeps all others.
+	StrategyMergeDict Strategy = "merge-dict"
+)
+
+var strategies = []Strategy{StrategyReplace, StrategyEnsureContains, StrategyEnsureMissing, StrategyMergeDict}
+
+// Names lists the strategies a raw entry accepts.
+func (s Strategy) Names() []string {
+	names := make([]string, len(strategies))
+	for i, strategy := range strategies {
+		names[i] = string(strategy)
+	}
+	return names
+}
+
+func (s Strategy) IsValid() bool {
+	return s == "" || slices.Contains(strategies, s)
+}
+
+// ValidFor reports whether the strategy can be used with values of type t.
+func (s Strategy) ValidFor(t ValueType) error {
+	if !s.IsValid() {
+		return fmt.Errorf("unknown strategy %q, must be one of: %v", s, strategies)
+	}
+
+	switch s {
+	case StrategyEnsureContains, StrategyEnsureMissing:
+		if t != ArrayType {
+			return fmt.Errorf("strategy %s requires an array value", s)
+		}
+	case StrategyMergeDict:
+		if t != DictType {
+			return fmt.Errorf("strategy %s requires a dict value", s)
+		}
+	}
+	return nil
+}
+
+// Resolve returns the value the key should hold after applying value to
+// current with this strategy. current is nil if the key is unset. A nil
+// result means the key is left as it is.
+func (s Strategy) Resolve(current, value Value) (Value, error) {
+	if s == "" || s == StrategyReplace {
+		return value, nil
+	}
+	if err := s.ValidFor(value.Type()); err != nil {
+		return nil, err
+	}
+	if current != nil && current.Type() != value.Type() {
+		return nil, fmt.Errorf("strategy %s cannot be applied to the current %s value", s, current.Type())
+	}
+
+	switch s {
+	case StrategyEnsureContains:
+		if current == nil {
+			return value, nil
+		}
+		elements := slices.Clone(current.(*ArrayValue).Values)
+		for _, v := range value.(*ArrayValue).Values {
+			if !containsValue(elements, v) {
+				elements = append(elements, v)
+			}
+		}
+		return NewArrayValue(elements...), nil
+
+	case StrategyEnsureMissing:
+		if current == nil {
+			return nil, nil
+		}
+		unwanted := value.(*ArrayValue).Values
+		var elements []Value
+		for _, v := range current.(*ArrayValue).Values {
+			if !containsValue(unwanted, v) {
+				elements = append(elements, v)
+			}
+		}
+		return NewArrayValue(elements...), nil
+
+	case StrategyMergeDict:
+		if current == nil {
+			return value, nil
+		}
+		merged := make(map[string]Value)
+		maps.Copy(merged, current.(*DictValue).Values)
+		maps.Copy(merged, value.(*DictValue).Values)
+		return NewDictValue(merged), nil
+	}
+	return value, nil
+}
+
+func containsValue(values []Value, v Value) bool {
+	return slices.ContainsFunc(values, func(item Value) bool {
+		return Equal(item, v)
+	})
+}
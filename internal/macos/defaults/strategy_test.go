@@ -0,0 +1,125 @@
+package defaults
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func stringArray(values ...string) *ArrayValue {
+	array := NewArrayValue()
+	for _, v := range values {
+		array.Values = append(array.Values, NewStringValue(v))
+	}
+	return array
+}
+
+func TestStrategy_Resolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy Strategy
+		current  Value
+		value    Value
+		want     Value
+		wantErr  bool
+	}{
+		{
+			name:    "replace by default",
+			current: stringArray("en-US", "fr"),
+			value:   stringArray("de"),
+			want:    stringArray("de"),
+		},
+		{
+			name:     "ensure-contains appends missing",
+			strategy: StrategyEnsureContains,
+			current:  stringArray("en-US", "fr"),
+			value:    stringArray("fr", "de"),
+			want:     stringArray("en-US", "fr", "de"),
+		},
+		{
+			name:     "ensure-contains on unset key",
+			strategy: StrategyEnsureContains,
+			value:    stringArray("de"),
+			want:     stringArray("de"),
+		},
+		{
+			name:     "ensure-missing removes",
+			strategy: StrategyEnsureMissing,
+			current:  stringArray("en-US", "fr", "de"),
+			value:    stringArray("fr"),
+			want:     stringArray("en-US", "de"),
+		},
+		{
+			name:     "ensure-missing on unset key",
+			strategy: StrategyEnsureMissing,
+			value:    stringArray("fr"),
+		},
+		{
+			name:     "merge-dict keeps other keys",
+			strategy: StrategyMergeDict,
+			current:  NewDictValue(map[string]Value{"Hide": NewStringValue("@h"), "Quit": NewStringValue("@q")}),
+			value:    NewDictValue(map[string]Value{"Hide": NewStringValue("@H")}),
+			want:     NewDictValue(map[string]Value{"Hide": NewStringValue("@H"), "Quit": NewStringValue("@q")}),
+		},
+		{
+			name:     "current type mismatch",
+			strategy: StrategyEnsureContains,
+			current:  NewStringValue("en-US"),
+			value:    stringArray("de"),
+			wantErr:  true,
+		},
+		{
+			name:     "merge-dict on array",
+			strategy: StrategyMergeDict,
+			value:    stringArray("de"),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.strategy.Resolve(tt.current, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !Equal(got, tt.want) {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanCommand_Strategy(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryBackend()
+	withBackend(t, mem)
+	if err := mem.Write(ctx, "NSGlobalDomain", "AppleLanguages", stringArray("en-US", "fr")); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := Command{Domain: "NSGlobalDomain", Key: "AppleLanguages", Value: stringArray("de"), Strategy: StrategyEnsureContains}
+	change, err := PlanCommand(ctx, cmd)
+	if err != nil {
+		t.Fatalf("PlanCommand() error = %v", err)
+	}
+	if change.Kind != ChangeWrite {
+		t.Fatalf("PlanCommand() kind = %s, want write", change.Kind)
+	}
+	if want := []string{`+ "de"`}; !slices.Equal(change.Details(), want) {
+		t.Errorf("Details() = %q, want %q", change.Details(), want)
+	}
+
+	if _, err := (&BatchExecutor{commands: []Command{cmd}}).Apply(ctx, nopLogger{}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	change, err = PlanCommand(ctx, cmd)
+	if err != nil {
+		t.Fatalf("PlanCommand() error = %v", err)
+	}
+	if change.Kind != ChangeNone {
+		t.Errorf("PlanCommand() after Apply() kind = %s, want none", change.Kind)
+	}
+	if got, _ := mem.Read(ctx, "NSGlobalDomain", "AppleLanguages"); got.String() != `("en-US", "fr", "de")` {
+		t.Errorf("AppleLanguages = %s", got)
+	}
+}
@@ -2,8 +2,10 @@ package defaults
 
 import (
 	"fmt"
+	"math"
 	"slices"
 	"strconv"
+	"strings"
 )
 
 type ValueType string
@@ -13,8 +15,17 @@ const (
 	StringType ValueType = "-string"
 	IntType    ValueType = "-int"
 	FloatType  ValueType = "-float"
+	ArrayType  ValueType = "-array"
+	DictType   ValueType = "-dict"
+	DataType   ValueType = "-data"
+	DateType   ValueType = "-date"
 )
 
+// Name returns the type without the flag dash, e.g. "int".
+func (t ValueType) Name() string {
+	return strings.TrimPrefix(string(t), "-")
+}
+
 type Value interface {
 	Type() ValueType
 	String() string
@@ -87,36 +98,10 @@ type IntValue struct {
 }
 
 func NewIntValue(value any) (*IntValue, error) {
-	var intVal int64
-
-	switch v := value.(type) {
-	case int:
-		intVal = int64(v)
-	case int8:
-		intVal = int64(v)
-	case int16:
-		intVal = int64(v)
-	case int32:
-		intVal = int64(v)
-	case int64:
-		intVal = v
-	case uint:
-		intVal = int64(v)
-	case uint8:
-		intVal = int64(v)
-	case uint16:
-		intVal = int64(v)
-	case uint32:
-		intVal = int64(v)
-	case uint64:
-		if v > 9223372036854775807 {
-			return nil, fmt.Errorf("value %d is too large for int64", v)
-		}
-		intVal = int64(v)
-	default:
-		return nil, fmt.Errorf("cannot convert %T to int", value)
+	intVal, err := toInt64(value)
+	if err != nil {
+		return nil, err
 	}
-
 	return &IntValue{Value: intVal}, nil
 }
 
@@ -133,40 +118,23 @@ func (i *IntValue) Validate() error {
 }
 
 type FloatValue struct {
-	Value     float64
+	Value float64
+	// Precision is the number of decimals written. A negative precision
+	// writes the shortest representation that reads back as Value.
 	Precision int
 }
 
+// NewFloatValue returns a value that is written exactly as configured, so
+// 0.125 stays 0.125.
 func NewFloatValue(value any) (*FloatValue, error) {
-	return NewFloatValueWithPrecision(value, 2)
+	return NewFloatValueWithPrecision(value, -1)
 }
 
 func NewFloatValueWithPrecision(value any, precision int) (*FloatValue, error) {
-	var floatVal float64
-
-	switch v := value.(type) {
-	case float32:
-		floatVal = float64(v)
-	case float64:
-		floatVal = v
-	case int:
-		floatVal = float64(v)
-	case int8:
-		floatVal = float64(v)
-	case int16:
-		floatVal = float64(v)
-	case int32:
-		floatVal = float64(v)
-	case int64:
-		floatVal = float64(v)
-	default:
-		return nil, fmt.Errorf("cannot convert %T to float", value)
+	floatVal, err := toFloat64(value)
+	if err != nil {
+		return nil, err
 	}
-
-	if precision < 0 {
-		precision = 2
-	}
-
 	return &FloatValue{Value: floatVal, Precision: precision}, nil
 }
 
@@ -179,6 +147,9 @@ func (f *FloatValue) String() string {
 }
 
 func (f *FloatValue) Validate() error {
+	if math.IsNaN(f.Value) || math.IsInf(f.Value, 0) {
+		return fmt.Errorf("float value must be finite, got %v", f.Value)
+	}
 	return nil
 }
 
@@ -235,6 +206,16 @@ func (f *ValueFactory) CreateValue(value any, valueType ValueType) (Value, error
 	case FloatType:
 		return NewFloatValue(value)
 
+	case ArrayType, DictType, DataType, DateType:
+		v, err := fromTOML(value)
+		if err != nil {
+			return nil, err
+		}
+		if v.Type() != valueType {
+			return nil, fmt.Errorf("expected %s, got %T", strings.TrimPrefix(string(valueType), "-"), value)
+		}
+		return v, nil
+
 	default:
 		return nil, fmt.Errorf("unsupported value type: %s", valueType)
 	}
@@ -251,6 +232,8 @@ func (f *ValueFactory) CreateValueWithReset(value any, valueType ValueType, isNu
 			return NewResetIntValue(), nil
 		case FloatType:
 			return NewResetFloatValue(), nil
+		case ArrayType, DictType, DataType, DateType:
+			return NewResetCollectionValue(valueType), nil
 		default:
 			return nil, fmt.Errorf("unsupported value type for reset: %s", valueType)
 		}
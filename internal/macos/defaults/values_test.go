@@ -0,0 +1,124 @@
+package defaults
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestRawEntry_Numbers(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   RawEntry
+		want    string
+		wantErr bool
+	}{
+		{name: "int beyond int16", entry: RawEntry{Type: TypeInt, RawValue: int64(86400)}, want: "86400"},
+		{name: "uint64 in range", entry: RawEntry{Type: TypeInt, RawValue: uint64(math.MaxInt64)}, want: "9223372036854775807"},
+		{name: "uint64 overflow", entry: RawEntry{Type: TypeInt, RawValue: uint64(math.MaxInt64) + 1}, wantErr: true},
+		{name: "float kept exactly", entry: RawEntry{Type: TypeFloat, RawValue: 0.125}, want: "0.125"},
+		{name: "float32 widened", entry: RawEntry{Type: TypeFloat, RawValue: float32(0.1)}, want: "0.1"},
+		{name: "int as float", entry: RawEntry{Type: TypeFloat, RawValue: int64(2)}, want: "2"},
+		{name: "inexact int as float", entry: RawEntry{Type: TypeFloat, RawValue: int64(1<<53 + 1)}, wantErr: true},
+		{name: "float as int", entry: RawEntry{Type: TypeInt, RawValue: 1.5}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.entry.Domain, tt.entry.Key = "com.example", "n"
+			err := tt.entry.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			value, err := tt.entry.Value()
+			if err != nil {
+				t.Fatalf("Value() error = %v", err)
+			}
+			if got := value.String(); got != tt.want {
+				t.Errorf("Value() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFloatValueWithPrecision(t *testing.T) {
+	v, err := NewFloatValueWithPrecision(0.125, 2)
+	if err != nil {
+		t.Fatalf("NewFloatValueWithPrecision() error = %v", err)
+	}
+	if got := v.String(); got != "0.12" {
+		t.Errorf("String() = %s, want 0.12", got)
+	}
+
+	if err := (&FloatValue{Value: math.Inf(1), Precision: -1}).Validate(); err == nil {
+		t.Error("Validate() accepted an infinite float")
+	}
+}
+
+func TestCoerce(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   Value
+		to      ValueType
+		want    string
+		wantErr bool
+	}{
+		{name: "bool to int", value: NewBoolValue(true), to: IntType, want: "1"},
+		{name: "int to bool", value: &IntValue{Value: 0}, to: BoolType, want: "false"},
+		{name: "int 2 to bool", value: &IntValue{Value: 2}, to: BoolType, wantErr: true},
+		{name: "int to float", value: &IntValue{Value: 3}, to: FloatType, want: "3"},
+		{name: "integral float to int", value: &FloatValue{Value: 2, Precision: -1}, to: IntType, want: "2"},
+		{name: "fractional float to int", value: &FloatValue{Value: 0.5, Precision: -1}, to: IntType, wantErr: true},
+		{name: "string to int", value: NewStringValue("42"), to: IntType, want: "42"},
+		{name: "array to string", value: NewArrayValue(), to: StringType, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Coerce(tt.value, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Coerce() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Type() != tt.to || got.String() != tt.want {
+				t.Errorf("Coerce() = %s %s, want %s %s", got.Type(), got, tt.to, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanCommand_NativeType(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryBackend()
+	withBackend(t, mem)
+	if err := mem.Write(ctx, "com.apple.dock", "autohide-delay", &IntValue{Value: 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := Command{Domain: "com.apple.dock", Key: "autohide-delay", Value: &IntValue{Value: 1}}
+	change, err := PlanCommand(ctx, cmd)
+	if err != nil {
+		t.Fatalf("PlanCommand() error = %v", err)
+	}
+	if change.TypeChanged() {
+		t.Errorf("PlanCommand() reported a type change for an int write")
+	}
+
+	cmd.NativeType = FloatType
+	change, err = PlanCommand(ctx, cmd)
+	if err != nil {
+		t.Fatalf("PlanCommand() error = %v", err)
+	}
+	if got := change.Command.Value; got.Type() != FloatType || got.String() != "1" {
+		t.Errorf("PlanCommand() value = %s %s, want -float 1", got.Type(), got)
+	}
+	if !change.TypeChanged() || change.TypeMismatch() {
+		t.Errorf("TypeChanged() = %t, TypeMismatch() = %t, want true, false", change.TypeChanged(), change.TypeMismatch())
+	}
+}
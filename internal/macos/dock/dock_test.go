@@ -2,6 +2,8 @@ package dock
 
 import (
 	"testing"
+
+	"github.com/RATIU5/fjrd/internal/macos/section"
 )
 
 func TestConfig_Validate(t *testing.T) {
@@ -20,7 +22,7 @@ func TestConfig_Validate(t *testing.T) {
 			config: &Config{
 				Autohide:    boolPtr(true),
 				Orientation: positionPtr(PositionLeft),
-				TileSize:    int16Ptr(64),
+				TileSize:    int64Ptr(64),
 			},
 			wantErr: false,
 		},
@@ -38,11 +40,32 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "tile size out of range",
+			config: &Config{
+				TileSize: int64Ptr(86400),
+			},
+			wantErr: true,
+		},
+		{
+			name: "fractional autohide delay",
+			config: &Config{
+				AutohideDelay: float64Ptr(0.125),
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative autohide time",
+			config: &Config{
+				AutohideTime: float64Ptr(-0.5),
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := tt.config.Validate()
+			err := sectionOf(t, tt.config).Validate()
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -66,7 +89,7 @@ func TestConfig_String(t *testing.T) {
 			config: &Config{
 				Autohide:    boolPtr(true),
 				Orientation: positionPtr(PositionLeft),
-				TileSize:    int16Ptr(64),
+				TileSize:    int64Ptr(64),
 			},
 			contains: []string{"Dock{", "autohide", "orientation", "tilesize"},
 		},
@@ -74,7 +97,7 @@ func TestConfig_String(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := tt.config.String()
+			result := sectionOf(t, tt.config).String()
 			for _, contains := range tt.contains {
 				if !containsString(result, contains) {
 					t.Errorf("Config.String() = %v, should contain %v", result, contains)
@@ -88,23 +111,23 @@ func TestConfig_Fields(t *testing.T) {
 	config := &Config{
 		Autohide:    boolPtr(true),
 		Orientation: positionPtr(PositionLeft),
-		TileSize:    int16Ptr(64),
+		TileSize:    int64Ptr(64),
 	}
 
-	fields := config.Fields()
-	
+	fields := sectionOf(t, config).Fields()
+
 	if fields["autohide"] == nil {
 		t.Error("Fields() should include autohide")
 	}
-	
+
 	if fields["orientation"] == nil {
 		t.Error("Fields() should include orientation")
 	}
-	
+
 	if fields["tilesize"] == nil {
 		t.Error("Fields() should include tilesize")
 	}
-	
+
 	if len(fields) != 3 {
 		t.Errorf("Fields() should have 3 fields, got %d", len(fields))
 	}
@@ -137,19 +160,19 @@ func TestConfig_Execute_WithMocks(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Test validation
-			err := tt.config.Validate()
+			err := sectionOf(t, tt.config).Validate()
 			if err != nil {
 				t.Errorf("Config.Validate() error = %v", err)
 			}
-			
+
 			// Test that string representation works
-			str := tt.config.String()
+			str := sectionOf(t, tt.config).String()
 			if str == "" {
 				t.Error("Config.String() should not be empty")
 			}
-			
+
 			// Test fields method
-			fields := tt.config.Fields()
+			fields := sectionOf(t, tt.config).Fields()
 			if tt.expectCmds > 0 && len(fields) == 0 {
 				t.Error("Config.Fields() should return fields when config has values")
 			}
@@ -157,15 +180,25 @@ func TestConfig_Execute_WithMocks(t *testing.T) {
 	}
 }
 
+// sectionOf binds config to the registered dock section.
+func sectionOf(t *testing.T, config *Config) section.Section {
+	t.Helper()
+	r, ok := section.Lookup("dock")
+	if !ok {
+		t.Fatal("dock section is not registered")
+	}
+	return section.Section{Registration: r, Config: config}
+}
+
 func boolPtr(b bool) *bool {
 	return &b
 }
 
-func int16Ptr(i int16) *int16 {
+func int64Ptr(i int64) *int64 {
 	return &i
 }
 
-func float32Ptr(f float32) *float32 {
+func float64Ptr(f float64) *float64 {
 	return &f
 }
 
@@ -178,12 +211,12 @@ func minEffectPtr(e MinEffect) *MinEffect {
 }
 
 func containsString(s, substr string) bool {
-	return len(s) >= len(substr) && 
-		   (s == substr || 
-		    len(s) > len(substr) && 
-		    (s[:len(substr)] == substr || 
-		     s[len(s)-len(substr):] == substr ||
-		     findSubstring(s, substr)))
+	return len(s) >= len(substr) &&
+		(s == substr ||
+			len(s) > len(substr) &&
+				(s[:len(substr)] == substr ||
+					s[len(s)-len(substr):] == substr ||
+					findSubstring(s, substr)))
 }
 
 func findSubstring(s, substr string) bool {
@@ -193,4 +226,4 @@ func findSubstring(s, substr string) bool {
 		}
 	}
 	return false
-}
\ No newline at end of file
+}
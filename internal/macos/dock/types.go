@@ -42,6 +42,15 @@ func (p Position) String() string {
 	}
 }
 
+// Names lists the positions orientation accepts.
+func (p Position) Names() []string {
+	var names []string
+	for _, position := range AllPositions() {
+		names = append(names, position.String())
+	}
+	return names
+}
+
 func (p *Position) UnmarshalText(text []byte) error {
 	parsed, err := ParsePosition(string(text))
 	if err != nil {
@@ -77,6 +86,15 @@ func (e MinEffect) String() string {
 	}
 }
 
+// Names lists the effects min-effect accepts.
+func (e MinEffect) Names() []string {
+	var names []string
+	for _, effect := range AllMinEffects() {
+		names = append(names, effect.String())
+	}
+	return names
+}
+
 func (e *MinEffect) UnmarshalText(text []byte) error {
 	parsed, err := ParseMinEffect(string(text))
 	if err != nil {
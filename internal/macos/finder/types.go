@@ -2,6 +2,8 @@ package finder
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 )
 
@@ -54,6 +56,17 @@ func (p PreferredViewStyle) IsValid() bool {
 	}
 }
 
+// Names lists the aliases and codes preferred-view-style accepts.
+func (p PreferredViewStyle) Names() []string {
+	names := slices.Sorted(maps.Keys(preferredViewStyleAliases))
+	for _, view := range AllPreferredViewStyles() {
+		if !slices.Contains(names, string(view)) {
+			names = append(names, string(view))
+		}
+	}
+	return names
+}
+
 func (s DefaultSearchScope) String() string {
 	return string(s)
 }
@@ -67,6 +80,17 @@ func (s DefaultSearchScope) IsValid() bool {
 	}
 }
 
+// Names lists the aliases and codes default-search-scope accepts.
+func (s DefaultSearchScope) Names() []string {
+	names := slices.Sorted(maps.Keys(defaultSearchScopeAliases))
+	for _, scope := range AllDefaultSearchScopes() {
+		if !slices.Contains(names, string(scope)) {
+			names = append(names, string(scope))
+		}
+	}
+	return names
+}
+
 func ParsePreferredViewStyle(s string) (PreferredViewStyle, error) {
 	normalized := strings.ToLower(strings.TrimSpace(s))
 
@@ -36,6 +36,15 @@ func (b FnBehavior) String() string {
 	}
 }
 
+// Names lists the behaviors fn-key-behavior accepts.
+func (b FnBehavior) Names() []string {
+	var names []string
+	for _, behavior := range AllFnBehaviors() {
+		names = append(names, behavior.String())
+	}
+	return names
+}
+
 func (b *FnBehavior) UnmarshalText(text []byte) error {
 	parsed, err := ParseFnBehavior(string(text))
 	if err != nil {
@@ -1,60 +1,17 @@
 package menubar
 
-import (
-	"context"
-
-	"github.com/RATIU5/fjrd/internal/errors"
-	"github.com/RATIU5/fjrd/internal/logger"
-	"github.com/RATIU5/fjrd/internal/macos/defaults"
-	"github.com/RATIU5/fjrd/internal/shared"
-)
+import "github.com/RATIU5/fjrd/internal/macos/section"
 
 type Config struct {
-	ClockFlashDateSeparators *bool   `toml:"clock-flash-date-separators,omitmepty"`
-	ClockDateFormat          *string `toml:"clock-date-format,omitempty"`
-}
-
-func (m *Config) Validate() error {
-	return nil
-}
-
-func (m *Config) String() string {
-	return shared.FormatConfig("Menubar", m)
-}
-
-func (m *Config) Fields() map[string]any {
-	fields := make(map[string]any)
-
-	if m.ClockFlashDateSeparators != nil {
-		fields["clock-flash-date-separators"] = m.ClockFlashDateSeparators
-	}
-	if m.ClockDateFormat != nil {
-		fields["clock-date-format"] = m.ClockDateFormat
-	}
-
-	return fields
+	ClockFlashDateSeparators *bool   `toml:"clock-flash-date-separators,omitmepty" doc:"Flash the time separators of the menu bar clock" defaults:"domain=com.apple.menuextra.clock,key=FlashDateSeparators,restart=SystemUIServer"`
+	ClockDateFormat          *string `toml:"clock-date-format,omitempty" doc:"Date and time format of the menu bar clock, e.g. \"EEE d MMM HH:mm:ss\"" defaults:"domain=com.apple.menuextra.clock,key=DateFormat,restart=SystemUIServer"`
 }
 
-func (m *Config) Execute(ctx context.Context, log *logger.Logger) error {
-	log = log.WithComponent("menubar")
-	log.Debug("Configuring menubar settings")
-
-	batch := defaults.NewBatchExecutor()
-	const clockDomain = "com.apple.menuextra.clock"
-
-	if m.ClockFlashDateSeparators != nil {
-		batch.AddBool(clockDomain, "FlashDateSeparators", *m.ClockFlashDateSeparators)
-	}
-
-	if m.ClockDateFormat != nil {
-		batch.AddString(clockDomain, "DateFormat", *m.ClockDateFormat)
-	}
-
-	log.Debug("Applying menubar defaults")
-	if err := batch.Execute(ctx, log); err != nil {
-		return errors.WrapConfigError("menubar", "execute_batch", "", nil, err)
-	}
-
-	log.Debug("Menubar configuration applied successfully")
-	return nil
+func init() {
+	section.Register(section.Registration{
+		Key:         "menubar",
+		Name:        "Menu Bar",
+		Description: "Menu bar appearance and behavior",
+		New:         func() any { return &Config{} },
+	})
 }
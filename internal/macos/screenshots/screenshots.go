@@ -1,98 +1,74 @@
 package screenshots
 
 import (
-	"context"
 	"fmt"
+	"path/filepath"
 
 	"github.com/RATIU5/fjrd/internal/errors"
-	"github.com/RATIU5/fjrd/internal/logger"
 	"github.com/RATIU5/fjrd/internal/macos/defaults"
+	"github.com/RATIU5/fjrd/internal/macos/section"
 	"github.com/RATIU5/fjrd/internal/shared"
 )
 
 type Config struct {
-	DisableShadow *bool   `toml:"disable-shadow,omitempty"`
-	IncludeDate   *bool   `toml:"include-date,omitempty"`
-	SaveLocation  *string `toml:"save-location,omitempty"`
-	ShowThumbnail *bool   `toml:"show-thumbnail,omitempty"`
-	Format        *Format `toml:"format,omitempty"`
+	DisableShadow *bool `toml:"disable-shadow,omitempty" doc:"Leave out the shadow of window screenshots" defaults:"domain=com.apple.screencapture,key=disable-shadow,restart=SystemUIServer"`
+	IncludeDate   *bool `toml:"include-date,omitempty" doc:"Include the date in screenshot file names" defaults:"domain=com.apple.screencapture,key=include-date,restart=SystemUIServer"`
+	// SaveLocation is a directory. A leading ~ is expanded to the home
+	// directory.
+	SaveLocation *string `toml:"save-location,omitempty" doc:"Directory screenshots are saved to. A leading ~ is expanded to the home directory"`
+	// Create creates SaveLocation if it does not exist.
+	Create        *bool   `toml:"create,omitempty" doc:"Create save-location if it does not exist"`
+	ShowThumbnail *bool   `toml:"show-thumbnail,omitempty" doc:"Show a floating thumbnail after a capture" defaults:"domain=com.apple.screencapture,key=show-thumbnail,restart=SystemUIServer"`
+	Format        *Format `toml:"format,omitempty" doc:"Image format of screenshots" defaults:"domain=com.apple.screencapture,key=type,restart=SystemUIServer"`
 }
 
-func (s *Config) Validate() error {
-	if s.Format != nil && !s.Format.IsValid() {
-		return errors.WrapConfigError("screenshots", "validate", "format", *s.Format, fmt.Errorf("invalid format: %s", *s.Format))
-	}
-	return nil
-}
-
-func (s *Config) String() string {
-	return shared.FormatConfig("Screenshots", s)
+func init() {
+	section.Register(section.Registration{
+		Key:         "screenshots",
+		Name:        "Screenshots",
+		Description: "Screenshot behavior and formatting",
+		New:         func() any { return &Config{} },
+	})
 }
 
-func (s *Config) Fields() map[string]any {
-	fields := make(map[string]any)
-
-	if s.DisableShadow != nil {
-		fields["disable-shadow"] = *s.DisableShadow
-	}
-	if s.IncludeDate != nil {
-		fields["include-date"] = *s.IncludeDate
-	}
+func (s *Config) Validate() error {
+	errs := errors.NewMultiError(shared.CheckFields("macos.screenshots", s))
 	if s.SaveLocation != nil {
-		fields["save-location"] = *s.SaveLocation
-	}
-	if s.ShowThumbnail != nil {
-		fields["show-thumbnail"] = *s.ShowThumbnail
+		location, err := shared.ExpandPath(*s.SaveLocation)
+		switch {
+		case err != nil:
+			errs.Add(errors.WrapConfigError("screenshots", "validate", "save-location", *s.SaveLocation, err))
+		case !filepath.IsAbs(location):
+			errs.Add(errors.WrapConfigError("screenshots", "validate", "save-location", *s.SaveLocation, fmt.Errorf("must be an absolute path or start with ~")))
+		}
 	}
-	if s.Format != nil {
-		fields["format"] = s.Format.String()
+	if s.Create != nil && *s.Create && s.SaveLocation == nil {
+		errs.Add(errors.WrapConfigError("screenshots", "validate", "create", *s.Create, fmt.Errorf("requires save-location")))
 	}
-
-	return fields
+	return errs.ToError()
 }
 
-func (s *Config) Execute(ctx context.Context, log *logger.Logger) error {
-	log = log.WithComponent("screenshots")
-	log.Debug("Configuring screenshot settings")
-
-	multiErr := &errors.MultiError{}
-	batch := defaults.NewBatchExecutor()
-	const screenshotDomain = "com.apple.screencapture"
-
-	if s.DisableShadow != nil {
-		batch.AddBool(screenshotDomain, "disable-shadow", *s.DisableShadow)
-	}
-
-	if s.IncludeDate != nil {
-		batch.AddBool(screenshotDomain, "include-date", *s.IncludeDate)
+func (s *Config) Batch() (*defaults.BatchExecutor, error) {
+	batch, err := defaults.BatchOf(s)
+	if err != nil {
+		return nil, err
 	}
 
 	if s.SaveLocation != nil {
-		batch.AddString(screenshotDomain, "location", *s.SaveLocation)
-	}
-
-	if s.ShowThumbnail != nil {
-		batch.AddBool(screenshotDomain, "show-thumbnail", *s.ShowThumbnail)
-	}
-
-	if s.Format != nil {
-		format := defaults.NewEnumValue(string(s.Format.String()), []string{"png", "jpg", "jpeg", "pdf", "psd", "gif", "tga", "tiff", "bmp", "heic"})
-		batch.AddCommand(defaults.Command{
-			Domain: screenshotDomain,
-			Key:    "type",
-			Value:  format,
-		})
-	}
-
-	log.Debug("Applying screenshot defaults")
-	if err := batch.Execute(ctx, log); err != nil {
-		multiErr.Add(errors.WrapConfigError("screenshots", "batch_execute", "screenshot_defaults", nil, err))
-	}
-
-	if err := multiErr.ToError(); err != nil {
-		return err
+		location, err := shared.ExpandPath(*s.SaveLocation)
+		if err != nil {
+			return nil, errors.WrapConfigError("screenshots", "batch", "save-location", *s.SaveLocation, err)
+		}
+		cmd := defaults.Command{
+			Domain: "com.apple.screencapture",
+			Key:    "location",
+			Value:  defaults.NewStringValue(location),
+		}
+		if s.Create != nil && *s.Create {
+			cmd.CreateDir = location
+		}
+		batch.AddCommand(cmd)
 	}
 
-	log.Debug("Screenshot configuration applied successfully")
-	return nil
+	return batch, nil
 }
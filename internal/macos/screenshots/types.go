@@ -33,6 +33,15 @@ func (f Format) String() string {
 	return string(f)
 }
 
+// Names lists the formats format accepts.
+func (f Format) Names() []string {
+	var names []string
+	for _, format := range AllFormats() {
+		names = append(names, format.String())
+	}
+	return names
+}
+
 func ParseFormat(s string) (Format, error) {
 	format := Format(strings.ToLower(s))
 	if !format.IsValid() {
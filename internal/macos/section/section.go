@@ -0,0 +1,374 @@
+// Package section keeps the registry of the sections of the macos table.
+// A section registers itself from an init function of its package, and the
+// configuration decodes, validates, applies and documents every section that
+// is registered:
+//
+//	func init() {
+//		section.Register(section.Registration{
+//			Key:         "dock",
+//			Name:        "Dock",
+//			Description: "Dock appearance, behavior and animations",
+//			New:         func() any { return &Config{} },
+//		})
+//	}
+//
+// The package of a section is linked in with a blank import.
+package section
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/RATIU5/fjrd/internal/macos/defaults"
+	"github.com/RATIU5/fjrd/internal/shared"
+)
+
+// Section is a table of the macos configuration, decoded into the struct
+// its registration returns from New. The fields of the struct are validated
+// against their enum types and range tags and written to the preferences
+// their defaults tags name, see defaults.MappingOf. A struct that needs more
+// than its tags implements Validator, Batcher or Restarter, whose methods
+// then replace what the tags derive.
+//
+// Restarts are not run by the section itself: the macos configuration
+// restarts each distinct process once, after every section has been written.
+// A section declares that a key needs privileges by giving its command
+// defaults.SystemScope; those commands are written together in a single
+// escalation after the user scope ones.
+type Section struct {
+	Registration
+	// Config is the struct the table was decoded into.
+	Config any
+}
+
+// Validator is implemented by sections that check more than their fields'
+// enums and ranges, e.g. fields that depend on each other.
+type Validator interface {
+	Validate() error
+}
+
+// Batcher is implemented by sections that write keys no single field maps
+// onto.
+type Batcher interface {
+	Batch() (*defaults.BatchExecutor, error)
+}
+
+// Restarter is implemented by sections that restart processes other than
+// the ones their defaults tags name.
+type Restarter interface {
+	Restarts() []defaults.Restart
+}
+
+func (s Section) Validate() error {
+	if v, ok := s.Config.(Validator); ok {
+		return v.Validate()
+	}
+	return shared.CheckFields("macos."+s.Key, s.Config)
+}
+
+// Batch returns the commands that write the section.
+func (s Section) Batch() (*defaults.BatchExecutor, error) {
+	if b, ok := s.Config.(Batcher); ok {
+		return b.Batch()
+	}
+	return defaults.BatchOf(s.Config)
+}
+
+// Restarts returns the processes to restart once the section changed a key.
+func (s Section) Restarts() []defaults.Restart {
+	if r, ok := s.Config.(Restarter); ok {
+		return r.Restarts()
+	}
+	return defaults.RestartsOf(s.Config)
+}
+
+// Fields returns every field set in the section by TOML key.
+func (s Section) Fields() map[string]any {
+	return defaults.FieldsOf(s.Config)
+}
+
+func (s Section) String() string {
+	if stringer, ok := s.Config.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return shared.FormatConfig(s.Name, s)
+}
+
+// RestartsForKey returns the processes to restart after key of domain was
+// changed outside of the sections, e.g. by an undo: what the fields written
+// to the key restart, or for a key no field is written to, such as one a
+// section writes itself, what the fields of its domain restart.
+func RestartsForKey(domain, key string) []defaults.Restart {
+	var restarts, domainRestarts []defaults.Restart
+	mapped := false
+	for _, r := range All() {
+		for _, field := range r.Fields() {
+			if field.Mapping == nil || field.Mapping.Domain != domain {
+				continue
+			}
+			domainRestarts = append(domainRestarts, field.Mapping.Restarts...)
+			if field.Mapping.Key == key {
+				mapped = true
+				restarts = append(restarts, field.Mapping.Restarts...)
+			}
+		}
+	}
+	if !mapped {
+		restarts = domainRestarts
+	}
+	return defaults.CoalesceRestarts(restarts)
+}
+
+// RestartsForDomains returns the processes to restart after domains were
+// changed as a whole, e.g. by a restore: what the fields of the domains
+// restart.
+func RestartsForDomains(domains []string) []defaults.Restart {
+	var restarts []defaults.Restart
+	for _, r := range All() {
+		for _, field := range r.Fields() {
+			if field.Mapping != nil && slices.Contains(domains, field.Mapping.Domain) {
+				restarts = append(restarts, field.Mapping.Restarts...)
+			}
+		}
+	}
+	return defaults.CoalesceRestarts(restarts)
+}
+
+// Everything in After stands for every other section, except the ones that
+// name this section or Everything in their own After.
+const Everything = "*"
+
+// Registration describes a section.
+type Registration struct {
+	// Key is the table of the section below macos, e.g. "mission-control".
+	Key string
+	// Name is the title of the section, e.g. "Mission Control".
+	Name string
+	// Description is a one-line summary for help output and editors.
+	Description string
+	// New returns a pointer to an empty section struct for the section's
+	// table to be decoded into.
+	New func() any
+	// After lists the keys of the sections that have to be applied before
+	// this one. Sections that do not depend on each other are applied in
+	// builtinOrder, then in the order of their keys.
+	After []string
+}
+
+// builtinOrder is the order the built-in sections have always been applied
+// in. It only ranks sections that do not depend on each other, and does not
+// make a section depend on another one; sections it does not list come after
+// the ones it does.
+var builtinOrder = []string{
+	"dock",
+	"finder",
+	"desktop",
+	"safari",
+	"screenshots",
+	"menubar",
+	"mouse",
+	"trackpad",
+	"keyboard",
+	"mission-control",
+}
+
+// Empty returns the section with nothing configured.
+func (r Registration) Empty() Section {
+	return Section{Registration: r, Config: r.New()}
+}
+
+// Field describes a key of a section, from the tags of the struct field it
+// is decoded into.
+type Field struct {
+	// Key is the TOML key of the field.
+	Key string
+	// Description is the doc tag of the field.
+	Description string
+	// Enum lists the names of an enum field, and is nil for other types.
+	Enum []string
+	// StructField is the field of the section struct.
+	StructField reflect.StructField
+	// Mapping is the preference the field is written to, from its defaults
+	// tag, or nil if the section writes the field itself.
+	Mapping *defaults.FieldMapping
+}
+
+// enum is implemented by the enum types of section fields.
+type enum interface {
+	Names() []string
+}
+
+// Fields returns the keys of the section in the order of its struct fields.
+// It is nil for a section that is not decoded into a struct, such as raw
+// defaults.
+func (r Registration) Fields() []Field {
+	config := r.New()
+	typ := reflect.TypeOf(config).Elem()
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	mappings := make(map[string]*defaults.FieldMapping)
+	for _, mapping := range defaults.MappingOf(config).Fields {
+		mappings[mapping.Name] = &mapping
+	}
+
+	var fields []Field
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+		if !field.IsExported() || key == "" || key == "-" {
+			continue
+		}
+		f := Field{
+			Key:         key,
+			Description: field.Tag.Get("doc"),
+			StructField: field,
+			Mapping:     mappings[key],
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if e, ok := reflect.Zero(fieldType).Interface().(enum); ok {
+			f.Enum = e.Names()
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+type registry struct {
+	mu      sync.Mutex
+	byKey   map[string]Registration
+	ordered []Registration
+}
+
+var registered = &registry{byKey: make(map[string]Registration)}
+
+// Register adds a section. Registering a key twice, or without a factory,
+// panics, as it can only be a programming error.
+func Register(r Registration) {
+	registered.register(r)
+}
+
+// Lookup returns the section registered for key.
+func Lookup(key string) (Registration, bool) {
+	return registered.lookup(key)
+}
+
+// All returns every registered section, in the order they are applied. A
+// dependency on a section that is not registered, or a cycle, panics.
+func All() []Registration {
+	return registered.all()
+}
+
+func (reg *registry) register(r Registration) {
+	if r.Key == "" || r.New == nil {
+		panic(fmt.Sprintf("section %q registered without a key or a factory", r.Key))
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if _, ok := reg.byKey[r.Key]; ok {
+		panic(fmt.Sprintf("section %q registered twice", r.Key))
+	}
+	reg.byKey[r.Key] = r
+	reg.ordered = nil
+}
+
+func (reg *registry) lookup(key string) (Registration, bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	r, ok := reg.byKey[key]
+	return r, ok
+}
+
+func (reg *registry) all() []Registration {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.ordered == nil {
+		reg.ordered = reg.order()
+	}
+	return slices.Clone(reg.ordered)
+}
+
+// order sorts the sections topologically, taking the first section in
+// builtinOrder, or else the smallest key, among the sections whose
+// dependencies have all been applied.
+func (reg *registry) order() []Registration {
+	after := make(map[string][]string, len(reg.byKey))
+	for key, r := range reg.byKey {
+		for _, dep := range r.After {
+			switch {
+			case dep == Everything:
+				for other, o := range reg.byKey {
+					if other != key && !slices.Contains(o.After, key) && !slices.Contains(o.After, Everything) {
+						after[key] = append(after[key], other)
+					}
+				}
+			case reg.byKey[dep].New == nil:
+				panic(fmt.Sprintf("section %q is applied after %q, which is not registered", key, dep))
+			default:
+				after[key] = append(after[key], dep)
+			}
+		}
+	}
+
+	pending := make(map[string]int, len(reg.byKey))
+	before := make(map[string][]string)
+	var ready []string
+	for key := range reg.byKey {
+		deps := slices.Compact(slices.Sorted(slices.Values(after[key])))
+		pending[key] = len(deps)
+		for _, dep := range deps {
+			before[dep] = append(before[dep], key)
+		}
+		if len(deps) == 0 {
+			ready = append(ready, key)
+		}
+	}
+
+	ordered := make([]Registration, 0, len(reg.byKey))
+	for len(ready) > 0 {
+		slices.SortFunc(ready, compareKeys)
+		key := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, reg.byKey[key])
+		for _, next := range before[key] {
+			if pending[next]--; pending[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+	if len(ordered) != len(reg.byKey) {
+		var cycle []string
+		for key, n := range pending {
+			if n > 0 {
+				cycle = append(cycle, key)
+			}
+		}
+		slices.Sort(cycle)
+		panic(fmt.Sprintf("sections %v depend on each other", cycle))
+	}
+	return ordered
+}
+
+// compareKeys orders the keys of sections by builtinOrder, then by key.
+func compareKeys(a, b string) int {
+	if c := cmp.Compare(builtinRank(a), builtinRank(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+func builtinRank(key string) int {
+	if i := slices.Index(builtinOrder, key); i >= 0 {
+		return i
+	}
+	return len(builtinOrder)
+}
@@ -0,0 +1,128 @@
+package section
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/RATIU5/fjrd/internal/macos/defaults"
+)
+
+type testSection struct {
+	restarts []defaults.Restart
+}
+
+func (s *testSection) Restarts() []defaults.Restart {
+	return s.restarts
+}
+
+func testRegistration(key string, after ...string) Registration {
+	return Registration{Key: key, New: func() any { return &testSection{} }, After: after}
+}
+
+func keys(registrations []Registration) []string {
+	var keys []string
+	for _, r := range registrations {
+		keys = append(keys, r.Key)
+	}
+	return keys
+}
+
+func TestRegistry_Order(t *testing.T) {
+	tests := []struct {
+		name          string
+		registrations []Registration
+		want          []string
+	}{
+		{
+			name:          "no dependencies",
+			registrations: []Registration{testRegistration("mouse"), testRegistration("dock"), testRegistration("finder")},
+			want:          []string{"dock", "finder", "mouse"},
+		},
+		{
+			name:          "built-in order",
+			registrations: []Registration{testRegistration("keyboard"), testRegistration("alpha"), testRegistration("mouse")},
+			want:          []string{"mouse", "keyboard", "alpha"},
+		},
+		{
+			name:          "dependencies before the built-in order",
+			registrations: []Registration{testRegistration("dock", "zoom"), testRegistration("finder"), testRegistration("zoom")},
+			want:          []string{"finder", "zoom", "dock"},
+		},
+		{
+			name:          "dependencies first",
+			registrations: []Registration{testRegistration("dock", "mouse"), testRegistration("finder"), testRegistration("mouse", "finder")},
+			want:          []string{"finder", "mouse", "dock"},
+		},
+		{
+			name:          "everything",
+			registrations: []Registration{testRegistration("raw", Everything), testRegistration("zoom"), testRegistration("dock")},
+			want:          []string{"dock", "zoom", "raw"},
+		},
+		{
+			name:          "after everything",
+			registrations: []Registration{testRegistration("raw", Everything), testRegistration("cleanup", "raw"), testRegistration("dock")},
+			want:          []string{"dock", "raw", "cleanup"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := &registry{byKey: make(map[string]Registration)}
+			for _, r := range tt.registrations {
+				reg.register(r)
+			}
+			if got := keys(reg.all()); !slices.Equal(got, tt.want) {
+				t.Errorf("all() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSection_Restarts(t *testing.T) {
+	type tagged struct {
+		Autohide *bool `toml:"autohide,omitempty" defaults:"domain=com.apple.dock,key=autohide,restart=Dock"`
+	}
+	want := []defaults.Restart{{Process: "Dock"}}
+	tests := []struct {
+		name   string
+		config any
+	}{
+		{"from the tags", &tagged{}},
+		{"from the section", &testSection{restarts: want}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Section{Registration: Registration{Key: "dock"}, Config: tt.config}
+			if got := s.Restarts(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Restarts() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRegistry_Panics(t *testing.T) {
+	tests := []struct {
+		name          string
+		registrations []Registration
+	}{
+		{"no key", []Registration{{New: func() any { return &testSection{} }}}},
+		{"no factory", []Registration{{Key: "dock"}}},
+		{"twice", []Registration{testRegistration("dock"), testRegistration("dock")}},
+		{"unknown dependency", []Registration{testRegistration("dock", "finder")}},
+		{"cycle", []Registration{testRegistration("dock", "finder"), testRegistration("finder", "dock")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("registry did not panic")
+				}
+			}()
+			reg := &registry{byKey: make(map[string]Registration)}
+			for _, r := range tt.registrations {
+				reg.register(r)
+			}
+			reg.all()
+		})
+	}
+}
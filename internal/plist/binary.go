@@ -0,0 +1,500 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+	"unicode/utf16"
+)
+
+const binaryMagic = "bplist00"
+
+// binaryTrailerSize is the fixed size of the trailer at the end of a bplist00
+// file.
+const binaryTrailerSize = 32
+
+// maxBinaryObjects and maxBinaryDepth bound decoding. Objects can be
+// referenced from many containers, so a small file can describe a value
+// that is exponentially larger than itself.
+const (
+	maxBinaryObjects = 1 << 20
+	maxBinaryDepth   = 512
+)
+
+// appleEpoch is the reference date binary plists count seconds from.
+var appleEpoch = time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// UnmarshalBinary decodes a bplist00 property list.
+func UnmarshalBinary(data []byte) (any, error) {
+	if len(data) < len(binaryMagic)+binaryTrailerSize || string(data[:len(binaryMagic)]) != binaryMagic {
+		return nil, fmt.Errorf("plist: not a binary property list")
+	}
+
+	trailer := data[len(data)-binaryTrailerSize:]
+	d := &binaryDecoder{
+		data:       data,
+		offsetSize: int(trailer[6]),
+		refSize:    int(trailer[7]),
+		numObjects: binary.BigEndian.Uint64(trailer[8:16]),
+		visiting:   make(map[uint64]bool),
+	}
+	topObject := binary.BigEndian.Uint64(trailer[16:24])
+	d.tableOffset = binary.BigEndian.Uint64(trailer[24:32])
+
+	if d.offsetSize < 1 || d.offsetSize > 8 || d.refSize < 1 || d.refSize > 8 {
+		return nil, fmt.Errorf("plist: invalid trailer sizes")
+	}
+	// The object count is bounded by the room before the trailer before it
+	// is multiplied, so that the end of the table cannot wrap around.
+	tableEnd := uint64(len(data) - binaryTrailerSize)
+	if d.tableOffset < uint64(len(binaryMagic)) || d.tableOffset > tableEnd || d.numObjects > (tableEnd-d.tableOffset)/uint64(d.offsetSize) {
+		return nil, fmt.Errorf("plist: offset table out of range")
+	}
+	if topObject >= d.numObjects {
+		return nil, fmt.Errorf("plist: top object %d out of range", topObject)
+	}
+
+	v, err := d.object(topObject)
+	if err != nil {
+		return nil, fmt.Errorf("plist: %w", err)
+	}
+	return v, nil
+}
+
+type binaryDecoder struct {
+	data        []byte
+	offsetSize  int
+	refSize     int
+	numObjects  uint64
+	tableOffset uint64
+	visiting    map[uint64]bool
+	decoded     int
+}
+
+func (d *binaryDecoder) object(ref uint64) (any, error) {
+	if ref >= d.numObjects {
+		return nil, fmt.Errorf("object reference %d out of range", ref)
+	}
+	if d.visiting[ref] {
+		return nil, fmt.Errorf("object %d references itself", ref)
+	}
+	if len(d.visiting) >= maxBinaryDepth {
+		return nil, fmt.Errorf("objects nested more than %d deep", maxBinaryDepth)
+	}
+	if d.decoded++; d.decoded > maxBinaryObjects {
+		return nil, fmt.Errorf("more than %d objects", maxBinaryObjects)
+	}
+	d.visiting[ref] = true
+	defer delete(d.visiting, ref)
+
+	index := d.tableOffset + ref*uint64(d.offsetSize)
+	if index+uint64(d.offsetSize) > uint64(len(d.data)-binaryTrailerSize) {
+		return nil, fmt.Errorf("object %d offset out of range", ref)
+	}
+	offset := readUint(d.data[index:], d.offsetSize)
+	if offset >= d.tableOffset {
+		return nil, fmt.Errorf("object %d offset out of range", ref)
+	}
+	pos := int(offset)
+
+	marker := d.data[pos]
+	kind, info := marker>>4, int(marker&0x0f)
+	pos++
+
+	switch kind {
+	case 0x0:
+		switch marker {
+		case 0x08:
+			return false, nil
+		case 0x09:
+			return true, nil
+		default:
+			return nil, fmt.Errorf("unsupported marker 0x%02x", marker)
+		}
+	case 0x1:
+		return d.integer(pos, info)
+	case 0x2:
+		size := 1 << info
+		if err := d.need(pos, size); err != nil {
+			return nil, err
+		}
+		switch size {
+		case 4:
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(d.data[pos:]))), nil
+		case 8:
+			return math.Float64frombits(binary.BigEndian.Uint64(d.data[pos:])), nil
+		default:
+			return nil, fmt.Errorf("unsupported real size %d", size)
+		}
+	case 0x3:
+		if marker != 0x33 {
+			return nil, fmt.Errorf("unsupported marker 0x%02x", marker)
+		}
+		if err := d.need(pos, 8); err != nil {
+			return nil, err
+		}
+		seconds := math.Float64frombits(binary.BigEndian.Uint64(d.data[pos:]))
+		whole, frac := math.Modf(seconds)
+		return appleEpoch.Add(time.Duration(whole)*time.Second + time.Duration(frac*float64(time.Second))), nil
+	case 0x4:
+		n, pos, err := d.length(pos, info)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.need(pos, n); err != nil {
+			return nil, err
+		}
+		out := make([]byte, n)
+		copy(out, d.data[pos:pos+n])
+		return out, nil
+	case 0x5:
+		n, pos, err := d.length(pos, info)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.need(pos, n); err != nil {
+			return nil, err
+		}
+		return string(d.data[pos : pos+n]), nil
+	case 0x6:
+		n, pos, err := d.length(pos, info)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.need(pos, n*2); err != nil {
+			return nil, err
+		}
+		units := make([]uint16, n)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(d.data[pos+i*2:])
+		}
+		return string(utf16.Decode(units)), nil
+	case 0xA:
+		n, pos, err := d.length(pos, info)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.need(pos, n*d.refSize); err != nil {
+			return nil, err
+		}
+		out := make([]any, n)
+		for i := range out {
+			v, err := d.object(readUint(d.data[pos+i*d.refSize:], d.refSize))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	case 0xD:
+		n, pos, err := d.length(pos, info)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.need(pos, 2*n*d.refSize); err != nil {
+			return nil, err
+		}
+		out := make(map[string]any, n)
+		for i := 0; i < n; i++ {
+			k, err := d.object(readUint(d.data[pos+i*d.refSize:], d.refSize))
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("dictionary key of type %T", k)
+			}
+			v, err := d.object(readUint(d.data[pos+(n+i)*d.refSize:], d.refSize))
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", key, err)
+			}
+			out[key] = v
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported marker 0x%02x", marker)
+	}
+}
+
+func (d *binaryDecoder) integer(pos, info int) (any, error) {
+	size := 1 << info
+	if err := d.need(pos, size); err != nil {
+		return nil, err
+	}
+
+	switch size {
+	case 1, 2, 4:
+		return int64(readUint(d.data[pos:], size)), nil
+	case 8:
+		return int64(binary.BigEndian.Uint64(d.data[pos:])), nil
+	case 16:
+		high := binary.BigEndian.Uint64(d.data[pos:])
+		low := binary.BigEndian.Uint64(d.data[pos+8:])
+		if high != 0 && high != math.MaxUint64 {
+			return nil, fmt.Errorf("integer does not fit in 64 bits")
+		}
+		if high == math.MaxUint64 {
+			return int64(low), nil
+		}
+		return normalizeUint(low), nil
+	default:
+		return nil, fmt.Errorf("unsupported integer size %d", size)
+	}
+}
+
+// length decodes the element count of a variable-length object, following
+// the 0xF escape to an integer object when needed.
+func (d *binaryDecoder) length(pos, info int) (int, int, error) {
+	if info != 0x0f {
+		return info, pos, nil
+	}
+	if err := d.need(pos, 1); err != nil {
+		return 0, 0, err
+	}
+
+	marker := d.data[pos]
+	if marker>>4 != 0x1 {
+		return 0, 0, fmt.Errorf("invalid length marker 0x%02x", marker)
+	}
+	v, err := d.integer(pos+1, int(marker&0x0f))
+	if err != nil {
+		return 0, 0, err
+	}
+	n, ok := v.(int64)
+	if !ok || n < 0 || n > int64(len(d.data)) {
+		return 0, 0, fmt.Errorf("invalid length %v", v)
+	}
+	return int(n), pos + 1 + 1<<(marker&0x0f), nil
+}
+
+func (d *binaryDecoder) need(pos, n int) error {
+	if n < 0 || uint64(pos+n) > d.tableOffset {
+		return fmt.Errorf("object data out of range")
+	}
+	return nil
+}
+
+func readUint(b []byte, size int) uint64 {
+	var v uint64
+	for i := 0; i < size; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+// MarshalBinary encodes v as a bplist00 property list. Scalars are uniqued
+// and dictionary keys are written in sorted order, so encoding the same value
+// always produces the same bytes.
+func MarshalBinary(v any) ([]byte, error) {
+	n, err := Normalize(v)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &binaryEncoder{unique: make(map[any]uint64)}
+	e.flatten(n)
+
+	refSize := bytesFor(uint64(len(e.objects)))
+
+	var buf bytes.Buffer
+	buf.WriteString(binaryMagic)
+	offsets := make([]uint64, len(e.objects))
+	for i, obj := range e.objects {
+		offsets[i] = uint64(buf.Len())
+		e.writeObject(&buf, obj, refSize)
+	}
+
+	tableOffset := uint64(buf.Len())
+	offsetSize := bytesFor(tableOffset)
+	for _, off := range offsets {
+		writeUint(&buf, off, offsetSize)
+	}
+
+	trailer := make([]byte, binaryTrailerSize)
+	trailer[6] = byte(offsetSize)
+	trailer[7] = byte(refSize)
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(e.objects)))
+	binary.BigEndian.PutUint64(trailer[16:], 0)
+	binary.BigEndian.PutUint64(trailer[24:], tableOffset)
+	buf.Write(trailer)
+
+	return buf.Bytes(), nil
+}
+
+type binaryEncoder struct {
+	objects []binaryObject
+	unique  map[any]uint64
+}
+
+type binaryObject struct {
+	value any
+	refs  []uint64
+}
+
+// uniqueKey returns a comparable key for scalars that can be shared between
+// references, or nil for values that must get their own object.
+func uniqueKey(v any) any {
+	switch t := v.(type) {
+	case string, bool, int64, uint64:
+		return t
+	case float64:
+		return struct{ f uint64 }{math.Float64bits(t)}
+	case time.Time:
+		return struct{ d int64 }{t.UnixNano()}
+	case []byte:
+		return struct{ b string }{string(t)}
+	default:
+		return nil
+	}
+}
+
+func (e *binaryEncoder) flatten(v any) uint64 {
+	key := uniqueKey(v)
+	if key != nil {
+		if ref, ok := e.unique[key]; ok {
+			return ref
+		}
+	}
+
+	ref := uint64(len(e.objects))
+	e.objects = append(e.objects, binaryObject{value: v})
+	if key != nil {
+		e.unique[key] = ref
+	}
+
+	switch t := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		refs := make([]uint64, 0, 2*len(keys))
+		for _, k := range keys {
+			refs = append(refs, e.flatten(k))
+		}
+		for _, k := range keys {
+			refs = append(refs, e.flatten(t[k]))
+		}
+		e.objects[ref].refs = refs
+	case []any:
+		refs := make([]uint64, 0, len(t))
+		for _, item := range t {
+			refs = append(refs, e.flatten(item))
+		}
+		e.objects[ref].refs = refs
+	}
+
+	return ref
+}
+
+func (e *binaryEncoder) writeObject(buf *bytes.Buffer, obj binaryObject, refSize int) {
+	switch t := obj.value.(type) {
+	case map[string]any:
+		writeMarker(buf, 0xD, len(obj.refs)/2)
+		for _, ref := range obj.refs {
+			writeUint(buf, ref, refSize)
+		}
+	case []any:
+		writeMarker(buf, 0xA, len(obj.refs))
+		for _, ref := range obj.refs {
+			writeUint(buf, ref, refSize)
+		}
+	case bool:
+		if t {
+			buf.WriteByte(0x09)
+		} else {
+			buf.WriteByte(0x08)
+		}
+	case int64:
+		writeInteger(buf, t)
+	case uint64:
+		buf.WriteByte(0x14)
+		writeUint(buf, 0, 8)
+		writeUint(buf, t, 8)
+	case float64:
+		buf.WriteByte(0x23)
+		writeUint(buf, math.Float64bits(t), 8)
+	case time.Time:
+		buf.WriteByte(0x33)
+		seconds := t.Sub(appleEpoch).Seconds()
+		writeUint(buf, math.Float64bits(seconds), 8)
+	case []byte:
+		writeMarker(buf, 0x4, len(t))
+		buf.Write(t)
+	case string:
+		if isASCII(t) {
+			writeMarker(buf, 0x5, len(t))
+			buf.WriteString(t)
+			return
+		}
+		units := utf16.Encode([]rune(t))
+		writeMarker(buf, 0x6, len(units))
+		for _, u := range units {
+			writeUint(buf, uint64(u), 2)
+		}
+	}
+}
+
+func writeMarker(buf *bytes.Buffer, kind byte, n int) {
+	if n < 0x0f {
+		buf.WriteByte(kind<<4 | byte(n))
+		return
+	}
+	buf.WriteByte(kind<<4 | 0x0f)
+	writeInteger(buf, int64(n))
+}
+
+// writeInteger uses the smallest unsigned width for non-negative values and
+// eight signed bytes otherwise, as CoreFoundation does.
+func writeInteger(buf *bytes.Buffer, i int64) {
+	switch {
+	case i < 0:
+		buf.WriteByte(0x13)
+		writeUint(buf, uint64(i), 8)
+	case i <= math.MaxUint8:
+		buf.WriteByte(0x10)
+		writeUint(buf, uint64(i), 1)
+	case i <= math.MaxUint16:
+		buf.WriteByte(0x11)
+		writeUint(buf, uint64(i), 2)
+	case i <= math.MaxUint32:
+		buf.WriteByte(0x12)
+		writeUint(buf, uint64(i), 4)
+	default:
+		buf.WriteByte(0x13)
+		writeUint(buf, uint64(i), 8)
+	}
+}
+
+func writeUint(buf *bytes.Buffer, v uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		buf.WriteByte(byte(v >> (8 * i)))
+	}
+}
+
+func bytesFor(v uint64) int {
+	switch {
+	case v <= math.MaxUint8:
+		return 1
+	case v <= math.MaxUint16:
+		return 2
+	case v <= math.MaxUint32:
+		return 4
+	default:
+		return 8
+	}
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
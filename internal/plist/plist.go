@@ -0,0 +1,137 @@
+// Package plist reads and writes Apple property lists.
+//
+// Values are represented with plain Go types:
+//
+//	dict    -> map[string]any
+//	array   -> []any
+//	string  -> string
+//	integer -> int64 (uint64 for values above math.MaxInt64)
+//	real    -> float64
+//	bool    -> bool
+//	data    -> []byte
+//	date    -> time.Time
+package plist
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Dict is the top-level value of a preferences domain.
+type Dict = map[string]any
+
+// Format identifies how a property list is serialized.
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatXML
+	FormatBinary
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatXML:
+		return "xml"
+	case FormatBinary:
+		return "binary"
+	default:
+		return "unknown"
+	}
+}
+
+// DetectFormat inspects the leading bytes of data.
+func DetectFormat(data []byte) Format {
+	if bytes.HasPrefix(data, []byte(binaryMagic)) {
+		return FormatBinary
+	}
+	trimmed := bytes.TrimLeft(data, "\xef\xbb\xbf \t\r\n")
+	if bytes.HasPrefix(trimmed, []byte("<")) {
+		return FormatXML
+	}
+	return FormatUnknown
+}
+
+// Unmarshal decodes an XML or binary property list and reports which format
+// it was stored in.
+func Unmarshal(data []byte) (any, Format, error) {
+	switch format := DetectFormat(data); format {
+	case FormatBinary:
+		v, err := UnmarshalBinary(data)
+		return v, format, err
+	case FormatXML:
+		v, err := UnmarshalXML(data)
+		return v, format, err
+	default:
+		return nil, FormatUnknown, fmt.Errorf("plist: unrecognized format")
+	}
+}
+
+// Marshal encodes v in the requested format.
+func Marshal(v any, format Format) ([]byte, error) {
+	switch format {
+	case FormatBinary:
+		return MarshalBinary(v)
+	case FormatXML:
+		return MarshalXML(v)
+	default:
+		return nil, fmt.Errorf("plist: cannot marshal to format %s", format)
+	}
+}
+
+// Normalize converts v into the canonical Go representation used by this
+// package, widening sized integers and floats and rejecting unsupported types.
+func Normalize(v any) (any, error) {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, item := range t {
+			n, err := Normalize(item)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", k, err)
+			}
+			out[k] = n
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(t))
+		for i, item := range t {
+			n, err := Normalize(item)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			out[i] = n
+		}
+		return out, nil
+	case string, bool, int64, uint64, float64, []byte, time.Time:
+		return t, nil
+	case int:
+		return int64(t), nil
+	case int8:
+		return int64(t), nil
+	case int16:
+		return int64(t), nil
+	case int32:
+		return int64(t), nil
+	case uint:
+		return normalizeUint(uint64(t)), nil
+	case uint8:
+		return int64(t), nil
+	case uint16:
+		return int64(t), nil
+	case uint32:
+		return int64(t), nil
+	case float32:
+		return float64(t), nil
+	default:
+		return nil, fmt.Errorf("unsupported plist type %T", v)
+	}
+}
+
+func normalizeUint(u uint64) any {
+	if u > 1<<63-1 {
+		return u
+	}
+	return int64(u)
+}
@@ -0,0 +1,221 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fixtureBinary and fixtureXML encode fixtureValue exactly as
+// CoreFoundation-compatible writers do (sorted keys, uniqued scalars).
+const fixtureBinary = "62706c6973743030d80102030405060708090d0e0f101114155461707073586175746f6869646554626c6f625564656c6179546e616d65566e65737465645874696c6573697a65547768656ea30a0b0c516113ffffffffffffffff13000001000000000009460001666a7264233fc0000000000000660044006f0063006b002000e9d11213516b0810303341c5f136a400000008191e272c32373e474c50525b64656c75828587888a0000000000000101000000000000001600000000000000000000000000000093"
+
+const fixtureXML = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>apps</key>
+	<array>
+		<string>a</string>
+		<integer>-1</integer>
+		<integer>1099511627776</integer>
+	</array>
+	<key>autohide</key>
+	<true/>
+	<key>blob</key>
+	<data>
+	AAFmanJk
+	</data>
+	<key>delay</key>
+	<real>0.125</real>
+	<key>name</key>
+	<string>Dock é</string>
+	<key>nested</key>
+	<dict>
+		<key>k</key>
+		<false/>
+	</dict>
+	<key>tilesize</key>
+	<integer>48</integer>
+	<key>when</key>
+	<date>2024-05-01T12:30:00Z</date>
+</dict>
+</plist>
+`
+
+func fixtureValue() map[string]any {
+	return map[string]any{
+		"apps":     []any{"a", int64(-1), int64(1 << 40)},
+		"autohide": true,
+		"blob":     []byte("\x00\x01fjrd"),
+		"delay":    0.125,
+		"name":     "Dock é",
+		"nested":   map[string]any{"k": false},
+		"tilesize": int64(48),
+		"when":     time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+	}
+}
+
+func TestUnmarshal_Fixtures(t *testing.T) {
+	bin, _ := hex.DecodeString(fixtureBinary)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format Format
+	}{
+		{name: "binary", data: bin, format: FormatBinary},
+		{name: "xml", data: []byte(fixtureXML), format: FormatXML},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, format, err := Unmarshal(tt.data)
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if format != tt.format {
+				t.Errorf("Unmarshal() format = %v, want %v", format, tt.format)
+			}
+			if !reflect.DeepEqual(got, fixtureValue()) {
+				t.Errorf("Unmarshal() = %#v, want %#v", got, fixtureValue())
+			}
+		})
+	}
+}
+
+func TestMarshal_ByteExact(t *testing.T) {
+	bin, _ := hex.DecodeString(fixtureBinary)
+
+	tests := []struct {
+		name   string
+		format Format
+		want   []byte
+	}{
+		{name: "binary", format: FormatBinary, want: bin},
+		{name: "xml", format: FormatXML, want: []byte(fixtureXML)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(fixtureValue(), tt.format)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Marshal() output differs\ngot:  %x\nwant: %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	long := make([]any, 40)
+	for i := range long {
+		long[i] = int64(i * 1000)
+	}
+
+	values := []any{
+		map[string]any{},
+		map[string]any{"empty": []any{}, "long": long},
+		map[string]any{"big": uint64(1<<63 + 5), "neg": int64(-70000), "f": 1e-7},
+		map[string]any{"s": "a string that is longer than fifteen bytes", "u": "ümlaut ✓"},
+	}
+
+	for _, format := range []Format{FormatXML, FormatBinary} {
+		for i, v := range values {
+			data, err := Marshal(v, format)
+			if err != nil {
+				t.Fatalf("%s #%d: Marshal() error = %v", format, i, err)
+			}
+			got, _, err := Unmarshal(data)
+			if err != nil {
+				t.Fatalf("%s #%d: Unmarshal() error = %v", format, i, err)
+			}
+			if !reflect.DeepEqual(got, v) {
+				t.Errorf("%s #%d: round trip = %#v, want %#v", format, i, got, v)
+			}
+		}
+	}
+}
+
+func TestUnmarshalBinary_Corrupt(t *testing.T) {
+	bin, _ := hex.DecodeString(fixtureBinary)
+
+	corrupt := append([]byte{}, bin...)
+	corrupt[len(corrupt)-1] = 0xff
+
+	for _, data := range [][]byte{[]byte("bplist00"), corrupt, bin[:40]} {
+		if _, err := UnmarshalBinary(data); err == nil {
+			t.Errorf("UnmarshalBinary(%x) should fail", data)
+		}
+	}
+}
+
+// TestUnmarshalBinary_OffsetTableOverflow decodes a trailer whose object
+// count wraps the end of the offset table around to inside the file.
+func TestUnmarshalBinary_OffsetTableOverflow(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString(binaryMagic)
+	// An array referencing object 5.
+	buf.Write([]byte{0xA1, 0x05})
+	binary.Write(&buf, binary.BigEndian, uint64(len(binaryMagic)))
+	trailer := make([]byte, binaryTrailerSize)
+	trailer[6], trailer[7] = 8, 1
+	binary.BigEndian.PutUint64(trailer[8:], 1<<61+1)
+	binary.BigEndian.PutUint64(trailer[24:], uint64(len(binaryMagic)+2))
+	buf.Write(trailer)
+
+	if _, err := UnmarshalBinary(buf.Bytes()); err == nil {
+		t.Error("UnmarshalBinary() of an overflowing offset table should fail")
+	}
+}
+
+// binaryArrays encodes a bplist00 of n arrays, each holding refs references
+// to the next one, ending in an empty string.
+func binaryArrays(n, refs int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(binaryMagic)
+	offsets := make([]uint16, n+1)
+	for i := 0; i < n; i++ {
+		offsets[i] = uint16(buf.Len())
+		buf.WriteByte(0xA0 | byte(refs))
+		for j := 0; j < refs; j++ {
+			binary.Write(&buf, binary.BigEndian, uint16(i+1))
+		}
+	}
+	offsets[n] = uint16(buf.Len())
+	buf.WriteByte(0x50)
+
+	tableOffset := uint64(buf.Len())
+	binary.Write(&buf, binary.BigEndian, offsets)
+	trailer := make([]byte, binaryTrailerSize)
+	trailer[6], trailer[7] = 2, 2
+	binary.BigEndian.PutUint64(trailer[8:], uint64(n+1))
+	binary.BigEndian.PutUint64(trailer[24:], tableOffset)
+	buf.Write(trailer)
+	return buf.Bytes()
+}
+
+func TestUnmarshalBinary_SharedReferences(t *testing.T) {
+	v, err := UnmarshalBinary(binaryArrays(3, 2))
+	if err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	leaf := []any{"", ""}
+	want := []any{[]any{leaf, leaf}, []any{leaf, leaf}}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("UnmarshalBinary() = %v, want %v", v, want)
+	}
+
+	// 2^40 arrays if every reference were expanded.
+	if _, err := UnmarshalBinary(binaryArrays(40, 2)); err == nil {
+		t.Error("UnmarshalBinary() of exponentially shared references should fail")
+	}
+	if _, err := UnmarshalBinary(binaryArrays(maxBinaryDepth+1, 1)); err == nil {
+		t.Error("UnmarshalBinary() of deeply nested arrays should fail")
+	}
+}
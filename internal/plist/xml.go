@@ -0,0 +1,387 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+`
+
+const xmlFooter = "</plist>\n"
+
+// xmlDateLayout is the ISO 8601 form CoreFoundation writes for <date>.
+const xmlDateLayout = "2006-01-02T15:04:05Z"
+
+// MarshalXML encodes v as an XML property list using the same layout
+// CoreFoundation produces: tab indentation and sorted dictionary keys.
+func MarshalXML(v any) ([]byte, error) {
+	n, err := Normalize(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xmlHeader)
+	if err := writeXMLValue(&buf, n, 0); err != nil {
+		return nil, err
+	}
+	buf.WriteString(xmlFooter)
+	return buf.Bytes(), nil
+}
+
+// MarshalXMLFragment encodes v as a bare XML plist element without the
+// document header, the form `defaults write` accepts for arrays and dicts.
+func MarshalXMLFragment(v any) ([]byte, error) {
+	n, err := Normalize(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := writeXMLValue(&buf, n, 0); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+func writeXMLValue(buf *bytes.Buffer, v any, depth int) error {
+	indent := strings.Repeat("\t", depth)
+
+	switch t := v.(type) {
+	case map[string]any:
+		if len(t) == 0 {
+			buf.WriteString(indent + "<dict/>\n")
+			return nil
+		}
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteString(indent + "<dict>\n")
+		for _, k := range keys {
+			buf.WriteString(indent + "\t<key>")
+			writeEscaped(buf, k)
+			buf.WriteString("</key>\n")
+			if err := writeXMLValue(buf, t[k], depth+1); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(indent + "</dict>\n")
+	case []any:
+		if len(t) == 0 {
+			buf.WriteString(indent + "<array/>\n")
+			return nil
+		}
+		buf.WriteString(indent + "<array>\n")
+		for _, item := range t {
+			if err := writeXMLValue(buf, item, depth+1); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(indent + "</array>\n")
+	case string:
+		buf.WriteString(indent + "<string>")
+		writeEscaped(buf, t)
+		buf.WriteString("</string>\n")
+	case bool:
+		if t {
+			buf.WriteString(indent + "<true/>\n")
+		} else {
+			buf.WriteString(indent + "<false/>\n")
+		}
+	case int64:
+		fmt.Fprintf(buf, "%s<integer>%d</integer>\n", indent, t)
+	case uint64:
+		fmt.Fprintf(buf, "%s<integer>%d</integer>\n", indent, t)
+	case float64:
+		fmt.Fprintf(buf, "%s<real>%s</real>\n", indent, formatReal(t))
+	case []byte:
+		writeXMLData(buf, t, indent)
+	case time.Time:
+		fmt.Fprintf(buf, "%s<date>%s</date>\n", indent, t.UTC().Format(xmlDateLayout))
+	default:
+		return fmt.Errorf("unsupported plist type %T", v)
+	}
+	return nil
+}
+
+// writeXMLData wraps base64 output at 68 columns, matching CoreFoundation.
+func writeXMLData(buf *bytes.Buffer, data []byte, indent string) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	buf.WriteString(indent + "<data>\n")
+	for len(encoded) > 0 {
+		n := min(68, len(encoded))
+		buf.WriteString(indent + encoded[:n] + "\n")
+		encoded = encoded[n:]
+	}
+	buf.WriteString(indent + "</data>\n")
+}
+
+func formatReal(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+infinity"
+	case math.IsInf(f, -1):
+		return "-infinity"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func writeEscaped(buf *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
+
+// UnmarshalXML decodes an XML property list into its Go representation.
+func UnmarshalXML(data []byte) (any, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = true
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("plist: missing <plist> element")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("plist: %w", err)
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "plist":
+			v, err := readPlistBody(dec)
+			if err != nil {
+				return nil, fmt.Errorf("plist: %w", err)
+			}
+			return v, nil
+		default:
+			// Accept bare fragments such as "<dict>...</dict>".
+			v, err := readXMLValue(dec, start)
+			if err != nil {
+				return nil, fmt.Errorf("plist: %w", err)
+			}
+			return v, nil
+		}
+	}
+}
+
+func readPlistBody(dec *xml.Decoder) (any, error) {
+	var value any
+	seen := false
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if seen {
+				return nil, fmt.Errorf("unexpected second root element <%s>", t.Name.Local)
+			}
+			value, err = readXMLValue(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			seen = true
+		case xml.EndElement:
+			if !seen {
+				return map[string]any{}, nil
+			}
+			return value, nil
+		}
+	}
+}
+
+func readXMLValue(dec *xml.Decoder, start xml.StartElement) (any, error) {
+	switch start.Name.Local {
+	case "dict":
+		return readXMLDict(dec)
+	case "array":
+		return readXMLArray(dec)
+	case "true":
+		return true, dec.Skip()
+	case "false":
+		return false, dec.Skip()
+	}
+
+	text, err := readXMLText(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	switch start.Name.Local {
+	case "string":
+		return text, nil
+	case "integer":
+		return parseInteger(strings.TrimSpace(text))
+	case "real":
+		return parseReal(strings.TrimSpace(text))
+	case "data":
+		cleaned := strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+				return -1
+			}
+			return r
+		}, text)
+		b, err := base64.StdEncoding.DecodeString(cleaned)
+		if err != nil {
+			return nil, fmt.Errorf("invalid <data>: %w", err)
+		}
+		return b, nil
+	case "date":
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid <date>: %w", err)
+		}
+		return t.UTC(), nil
+	default:
+		return nil, fmt.Errorf("unknown element <%s>", start.Name.Local)
+	}
+}
+
+func readXMLDict(dec *xml.Decoder) (map[string]any, error) {
+	out := make(map[string]any)
+	var key *string
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if key == nil {
+				if t.Name.Local != "key" {
+					return nil, fmt.Errorf("expected <key> in <dict>, got <%s>", t.Name.Local)
+				}
+				k, err := readXMLText(dec)
+				if err != nil {
+					return nil, err
+				}
+				key = &k
+				continue
+			}
+			v, err := readXMLValue(dec, t)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", *key, err)
+			}
+			out[*key] = v
+			key = nil
+		case xml.EndElement:
+			if key != nil {
+				return nil, fmt.Errorf("key %q has no value", *key)
+			}
+			return out, nil
+		}
+	}
+}
+
+func readXMLArray(dec *xml.Decoder) ([]any, error) {
+	out := make([]any, 0)
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			v, err := readXMLValue(dec, t)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", len(out), err)
+			}
+			out = append(out, v)
+		case xml.EndElement:
+			return out, nil
+		}
+	}
+}
+
+func readXMLText(dec *xml.Decoder) (string, error) {
+	var sb strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+
+		switch t := tok.(type) {
+		case xml.CharData:
+			sb.Write(t)
+		case xml.StartElement:
+			return "", fmt.Errorf("unexpected element <%s> in text", t.Name.Local)
+		case xml.EndElement:
+			return sb.String(), nil
+		}
+	}
+}
+
+func parseInteger(s string) (any, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		u, err := strconv.ParseUint(s[2:], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid <integer> %q: %w", s, err)
+		}
+		return normalizeUint(u), nil
+	}
+
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+
+	u, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid <integer> %q: %w", s, err)
+	}
+	return u, nil
+}
+
+func parseReal(s string) (float64, error) {
+	switch strings.ToLower(s) {
+	case "+infinity", "infinity", "inf":
+		return math.Inf(1), nil
+	case "-infinity", "-inf":
+		return math.Inf(-1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid <real> %q: %w", s, err)
+	}
+	return f, nil
+}
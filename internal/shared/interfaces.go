@@ -5,6 +5,8 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+
+	"github.com/RATIU5/fjrd/internal/errors"
 )
 
 type Validator interface {
@@ -21,13 +23,14 @@ type ConfigFields interface {
 
 type CompositeValidator []Validator
 
+// Validate runs every validator and combines their errors, so that one
+// invalid value does not hide the others.
 func (cv CompositeValidator) Validate() error {
+	errs := errors.NewMultiError()
 	for _, v := range cv {
-		if err := v.Validate(); err != nil {
-			return err
-		}
+		errs.Add(v.Validate())
 	}
-	return nil
+	return errs.ToError()
 }
 
 func ValidateAll(validators ...Validator) error {
@@ -0,0 +1,73 @@
+package shared
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/RATIU5/fjrd/internal/errors"
+)
+
+// FieldRange returns the bounds of a numeric config field, given in its
+// range tag as `range:"min,max"`. ok is false if the field has no range.
+func FieldRange(field reflect.StructField) (min, max float64, ok bool) {
+	tag, ok := field.Tag.Lookup("range")
+	if !ok {
+		return 0, 0, false
+	}
+	lo, hi, _ := strings.Cut(tag, ",")
+	min, errMin := strconv.ParseFloat(lo, 64)
+	max, errMax := strconv.ParseFloat(hi, 64)
+	if errMin != nil || errMax != nil {
+		panic(fmt.Sprintf("invalid range tag %q on field %s", tag, field.Name))
+	}
+	return min, max, true
+}
+
+// CheckFields validates every field of the struct config points to that is
+// set: enums must hold one of their values and numbers must lie within their
+// range tag. The errors name the field's key below prefix, e.g.
+// macos.dock.tilesize.
+func CheckFields(prefix string, config any) error {
+	v := reflect.ValueOf(config).Elem()
+	errs := errors.NewMultiError()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Type.Kind() != reflect.Pointer || v.Field(i).IsNil() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+		key := prefix + "." + name
+		value := v.Field(i).Elem()
+
+		if enum, ok := value.Interface().(Enum); ok && !enum.IsValid() {
+			errs.Add(errors.NewValidationError(key, value.Interface(), "", fmt.Errorf("invalid value")))
+		}
+
+		min, max, ok := FieldRange(field)
+		if !ok {
+			continue
+		}
+		var f float64
+		switch value.Kind() {
+		case reflect.Int64:
+			f = float64(value.Int())
+		case reflect.Float64:
+			f = value.Float()
+		default:
+			panic(fmt.Sprintf("range tag on non-numeric field %s", field.Name))
+		}
+		if f < min || f > max {
+			errs.Add(errors.NewValidationError(key, value.Interface(), fmt.Sprintf("%v to %v", min, max), fmt.Errorf("value out of range")))
+		}
+	}
+	return errs.ToError()
+}
+
+// Enum is the type of config fields limited to a set of named values.
+type Enum interface {
+	IsValid() bool
+	// Names lists every string the type decodes from, aliases included.
+	Names() []string
+}
@@ -2,12 +2,15 @@ package testing
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/RATIU5/fjrd/internal/backup"
 	"github.com/RATIU5/fjrd/internal/logger"
 	"github.com/RATIU5/fjrd/internal/macos/dock"
+	"github.com/RATIU5/fjrd/internal/macos/section"
 )
 
 func TestIntegrationWithRollback(t *testing.T) {
@@ -35,14 +38,24 @@ func testDockConfiguration(ctx context.Context, log *logger.Logger) error {
 	config := &dock.Config{
 		Autohide:    boolPtr(true),
 		Orientation: positionPtr(dock.PositionLeft),
-		TileSize:    int16Ptr(48),
+		TileSize:    int64Ptr(48),
 	}
 
-	if err := config.Validate(); err != nil {
+	r, ok := section.Lookup("dock")
+	if !ok {
+		return fmt.Errorf("dock section is not registered")
+	}
+	dockSection := section.Section{Registration: r, Config: config}
+	if err := dockSection.Validate(); err != nil {
 		return err
 	}
 
-	return config.Execute(ctx, log)
+	batch, err := dockSection.Batch()
+	if err != nil {
+		return err
+	}
+	_, err = batch.Apply(ctx, log)
+	return err
 }
 
 func TestBackupAndRestore(t *testing.T) {
@@ -57,20 +70,20 @@ func TestBackupAndRestore(t *testing.T) {
 
 	domains := []string{"com.apple.dock"}
 
-	backup, err := backupManager.CreateBackup(ctx, domains)
+	created, err := backupManager.Create(ctx, domains, "test")
 	if err != nil {
 		t.Fatalf("Failed to create backup: %v", err)
 	}
 
-	if backup.BackupID == "" {
+	if created.ID == "" {
 		t.Error("Backup should have a valid ID")
 	}
 
-	if backup.DomainData == nil {
+	if len(created.Domains) != len(domains) {
 		t.Error("Backup should have domain data")
 	}
 
-	err = backupManager.RestoreBackup(ctx, backup)
+	_, err = backupManager.Restore(ctx, created, backup.Selection{})
 	if err != nil {
 		t.Fatalf("Failed to restore backup: %v", err)
 	}
@@ -116,7 +129,7 @@ func boolPtr(b bool) *bool {
 	return &b
 }
 
-func int16Ptr(i int16) *int16 {
+func int64Ptr(i int64) *int64 {
 	return &i
 }
 
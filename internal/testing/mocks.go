@@ -121,8 +121,8 @@ func (m *MockBatchExecutor) AddBool(domain, key string, value bool) {
 	})
 }
 
-func (m *MockBatchExecutor) AddInt(domain, key string, value int16) error {
-	intValue, err := defaults.NewIntValue(int64(value))
+func (m *MockBatchExecutor) AddInt(domain, key string, value int64) error {
+	intValue, err := defaults.NewIntValue(value)
 	if err != nil {
 		return err
 	}
@@ -134,8 +134,8 @@ func (m *MockBatchExecutor) AddInt(domain, key string, value int16) error {
 	return nil
 }
 
-func (m *MockBatchExecutor) AddFloat(domain, key string, value float32) error {
-	floatValue, err := defaults.NewFloatValue(float64(value))
+func (m *MockBatchExecutor) AddFloat(domain, key string, value float64) error {
+	floatValue, err := defaults.NewFloatValue(value)
 	if err != nil {
 		return err
 	}